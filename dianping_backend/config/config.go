@@ -10,10 +10,18 @@ import (
 
 // Config 全局配置结构
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	Redis    RedisConfig    `yaml:"redis"`
-	JWT      JWTConfig      `yaml:"jwt"`
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Redis     RedisConfig     `yaml:"redis"`
+	JWT       JWTConfig       `yaml:"jwt"`
+	Order     OrderConfig     `yaml:"order"`
+	Stream    StreamConfig    `yaml:"stream"`
+	Admin     AdminConfig     `yaml:"admin"`
+	Reconcile ReconcileConfig `yaml:"reconcile"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Bloom     BloomConfig     `yaml:"bloom"`
+	Geo       GeoConfig       `yaml:"geo"`
+	Review    ReviewConfig    `yaml:"review"`
 }
 
 // ServerConfig 服务器配置
@@ -46,6 +54,61 @@ type JWTConfig struct {
 	ExpireTime int    `yaml:"expire_time"`
 }
 
+// OrderConfig 订单配置
+type OrderConfig struct {
+	PayTimeout int `yaml:"pay_timeout"` // 未支付订单自动取消时间（秒），默认900
+}
+
+// StreamConfig 订单 Stream 消费配置
+type StreamConfig struct {
+	Backend            string `yaml:"backend"`              // 订单队列后端：redis（默认，Redis Stream）| memory（进程内队列，仅用于单机开发和测试）
+	MaxRetry           int    `yaml:"max_retry"`            // 单条消息最大投递次数，超过后进入死信队列，默认5
+	ClaimMinIdle       int    `yaml:"claim_min_idle"`       // pending 消息空闲超过该时间（秒）后被 XAUTOCLAIM 接管，默认60
+	ConsumerStaleAfter int    `yaml:"consumer_stale_after"` // 其他实例的消费者空闲超过该时间（秒）且无 pending 时删除，默认600
+}
+
+// ReconcileConfig 秒杀库存对账配置
+type ReconcileConfig struct {
+	Interval   int  `yaml:"interval"`    // 对账周期（秒），默认300，小于0时关闭定时对账
+	AutoRepair bool `yaml:"auto_repair"` // 定时对账发现不一致时是否自动修复，默认只报告
+}
+
+// CacheConfig 缓存配置
+type CacheConfig struct {
+	LocalSize int `yaml:"local_size"` // 热点商铺进程内 L1 缓存容量，默认1000，小于0时关闭 L1
+	LocalTTL  int `yaml:"local_ttl"`  // L1 缓存存活时间（秒），默认10
+	// 数据变更后延迟二次删除缓存的间隔（毫秒），默认1000
+	DoubleDeleteDelay int `yaml:"double_delete_delay"`
+	// 热点 key 统计与预热：采样率 (0,1] 默认0.1；预热的热点数量默认20；预热周期（秒）默认60，小于0时关闭预热
+	HotKeySampleRate float64 `yaml:"hotkey_sample_rate"`
+	HotKeyTopN       int     `yaml:"hotkey_top_n"`
+	PrewarmInterval  int     `yaml:"prewarm_interval"`
+}
+
+// BloomConfig 布隆过滤器配置
+type BloomConfig struct {
+	Backend         string `yaml:"backend"`          // 存储后端：auto（默认，探测 RedisBloom 模块）| redisbloom | bitmap（普通 Redis 位图）| memory（进程内，仅用于单机开发和测试）
+	Type            string `yaml:"type"`             // 商铺、优惠券过滤器类型：bloom（默认，删除的ID在重建时清理）| cuckoo（布谷鸟过滤器，支持删除，仅 redisbloom 后端）
+	RebuildInterval int    `yaml:"rebuild_interval"` // 全量重建周期（秒），默认86400，小于0时关闭定时重建
+}
+
+// GeoConfig 商铺 GEO 索引配置
+type GeoConfig struct {
+	ResyncInterval int `yaml:"resync_interval"` // 从 MySQL 全量校正 GEO 索引的周期（秒），默认3600，小于0时只在启动时加载一次
+}
+
+// ReviewConfig 商铺评价配置
+type ReviewConfig struct {
+	// 评分按贝叶斯平均计算：(PriorWeight*PriorMean + 总分) / (PriorWeight + 评价数)
+	PriorMean   float64 `yaml:"prior_mean"`   // 先验平均分（1-5），默认3.5
+	PriorWeight int     `yaml:"prior_weight"` // 先验权重（相当于多少条虚拟评价），默认5
+}
+
+// AdminConfig 管理后台配置
+type AdminConfig struct {
+	UserIDs []uint `yaml:"user_ids"` // 允许访问 /api/admin 的用户ID
+}
+
 var globalConfig *Config
 
 // LoadConfig 加载配置文件
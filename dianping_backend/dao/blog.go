@@ -130,6 +130,8 @@ const (
 	// 博客点赞集合的键名格式：blog_like:%d
 	blogLikeKey = "blog:liked:"
 	feedKey     = "feed:"
+	// BlogCache 博客详情缓存前缀
+	BlogCache = "cache:blog:"
 )
 
 // IsLikedMember 检查用户是否已点赞博客（使用 Redis SortedSet）
@@ -0,0 +1,49 @@
+package dao
+
+import (
+	"context"
+	"dianping/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateCacheInvalidation 记录一个待重试删除的缓存 key
+func CreateCacheInvalidation(ctx context.Context, db *gorm.DB, key, lastErr string, nextRetryAt time.Time) error {
+	return db.WithContext(ctx).Create(&models.CacheInvalidation{
+		CacheKey:    key,
+		Attempts:    1,
+		NextRetryAt: nextRetryAt,
+		LastError:   lastErr,
+	}).Error
+}
+
+// GetDueCacheInvalidations 获取到期需要重试的缓存删除任务
+func GetDueCacheInvalidations(ctx context.Context, db *gorm.DB, limit int) ([]models.CacheInvalidation, error) {
+	var items []models.CacheInvalidation
+	err := db.WithContext(ctx).Where("next_retry_at <= ?", time.Now()).
+		Order("next_retry_at").Limit(limit).Find(&items).Error
+	return items, err
+}
+
+// UpdateCacheInvalidationRetry 更新重试次数与下次重试时间
+func UpdateCacheInvalidationRetry(ctx context.Context, db *gorm.DB, id uint, attempts int, nextRetryAt time.Time, lastErr string) error {
+	return db.WithContext(ctx).Model(&models.CacheInvalidation{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":      attempts,
+			"next_retry_at": nextRetryAt,
+			"last_error":    lastErr,
+		}).Error
+}
+
+// DeleteCacheInvalidation 删除已完成的重试任务
+func DeleteCacheInvalidation(ctx context.Context, db *gorm.DB, id uint) error {
+	return db.WithContext(ctx).Delete(&models.CacheInvalidation{}, id).Error
+}
+
+// CountCacheInvalidations 统计待重试的缓存删除任务数量
+func CountCacheInvalidations(ctx context.Context, db *gorm.DB) (int64, error) {
+	var count int64
+	err := db.WithContext(ctx).Model(&models.CacheInvalidation{}).Count(&count).Error
+	return count, err
+}
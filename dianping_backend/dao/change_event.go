@@ -0,0 +1,193 @@
+package dao
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 数据变更操作类型
+const (
+	ChangeOpCreate = "create"
+	ChangeOpUpdate = "update"
+	ChangeOpDelete = "delete"
+)
+
+// ChangeEvent 表数据变更事件（类似 binlog 行事件，只包含表名、操作和主键）
+// 事件在语句执行成功后同步触发，此时所在事务可能尚未提交
+// EN: Row-change event published by the GORM callbacks after a successful write
+type ChangeEvent struct {
+	Table string
+	Op    string
+	IDs   []uint // 无法从语句中解析出主键时为空
+}
+
+// ChangeListener 数据变更监听函数，需要尽快返回，不能阻塞写操作
+type ChangeListener func(ChangeEvent)
+
+var (
+	changeListenersMu sync.RWMutex
+	changeListeners   = map[string][]ChangeListener{}
+)
+
+// OnTableChange 注册某张表的数据变更监听
+// EN: Subscribe to create/update/delete events of a table
+func OnTableChange(table string, fn ChangeListener) {
+	changeListenersMu.Lock()
+	defer changeListenersMu.Unlock()
+	changeListeners[table] = append(changeListeners[table], fn)
+}
+
+// GetExistingIDs 返回 ids 中数据库里仍然存在的主键（软删除的行按不存在处理），
+// 用于在变更事件之后确认删除是否已经提交
+// EN: Filter ids down to rows that still exist (soft-deleted rows excluded)
+func GetExistingIDs(ctx context.Context, db *gorm.DB, model interface{}, ids []uint) ([]uint, error) {
+	var existing []uint
+	if len(ids) == 0 {
+		return existing, nil
+	}
+	err := db.WithContext(ctx).Model(model).Where("id IN ?", ids).Pluck("id", &existing).Error
+	return existing, err
+}
+
+// registerChangeCallbacks 注册 GORM 回调，在增删改成功后发布变更事件
+func registerChangeCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Create().After("gorm:create").Register("dianping:change_event", changeCallback(ChangeOpCreate)); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("dianping:change_event", changeCallback(ChangeOpUpdate)); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("dianping:change_event", changeCallback(ChangeOpDelete))
+}
+
+func changeCallback(op string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Error != nil || tx.RowsAffected == 0 || tx.Statement == nil {
+			return
+		}
+		table := tx.Statement.Table
+		changeListenersMu.RLock()
+		listeners := changeListeners[table]
+		changeListenersMu.RUnlock()
+		if len(listeners) == 0 {
+			return
+		}
+
+		event := ChangeEvent{Table: table, Op: op, IDs: changedIDs(tx.Statement)}
+		if len(event.IDs) == 0 {
+			log.Printf("警告: 无法解析变更主键, table=%s, op=%s, sql=%s", table, op, tx.Statement.SQL.String())
+		}
+		for _, fn := range listeners {
+			fn(event)
+		}
+	}
+}
+
+// changedIDs 从写入的模型或 WHERE 条件中解析出被修改行的主键
+func changedIDs(stmt *gorm.Statement) []uint {
+	seen := map[uint]bool{}
+	var ids []uint
+	add := func(v interface{}) {
+		if id, ok := toUint(v); ok && id > 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	// 1) 写入的模型本身带主键（Create、Save、Updates(&model)）
+	if stmt.Schema != nil && stmt.Schema.PrioritizedPrimaryField != nil {
+		pk := stmt.Schema.PrioritizedPrimaryField
+		collect := func(rv reflect.Value) {
+			rv = reflect.Indirect(rv)
+			switch rv.Kind() {
+			case reflect.Struct:
+				if rv.Type() == stmt.Schema.ModelType {
+					if v, zero := pk.ValueOf(stmt.Context, rv); !zero {
+						add(v)
+					}
+				}
+			case reflect.Slice, reflect.Array:
+				for i := 0; i < rv.Len(); i++ {
+					elem := reflect.Indirect(rv.Index(i))
+					if elem.Kind() == reflect.Struct && elem.Type() == stmt.Schema.ModelType {
+						if v, zero := pk.ValueOf(stmt.Context, elem); !zero {
+							add(v)
+						}
+					}
+				}
+			}
+		}
+		collect(stmt.ReflectValue)
+		if stmt.Dest != nil {
+			collect(reflect.ValueOf(stmt.Dest))
+		}
+	}
+
+	// 2) WHERE 条件中的主键（Where("id = ?", id)、Delete(&model, id) 等）
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			for _, expr := range where.Exprs {
+				switch e := expr.(type) {
+				case clause.Eq:
+					if isIDColumn(e.Column) {
+						add(e.Value)
+					}
+				case clause.IN:
+					if isIDColumn(e.Column) {
+						for _, v := range e.Values {
+							add(v)
+						}
+					}
+				case clause.Expr:
+					sql := strings.ToLower(strings.Join(strings.Fields(e.SQL), " "))
+					if len(e.Vars) == 0 {
+						continue
+					}
+					if strings.HasPrefix(sql, "id = ?") {
+						add(e.Vars[0])
+					} else if strings.HasPrefix(sql, "id in ?") {
+						rv := reflect.ValueOf(e.Vars[0])
+						if rv.Kind() == reflect.Slice {
+							for i := 0; i < rv.Len(); i++ {
+								add(rv.Index(i).Interface())
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// isIDColumn 判断条件列是否为主键 id
+func isIDColumn(col interface{}) bool {
+	switch c := col.(type) {
+	case string:
+		return c == "id"
+	case clause.Column:
+		return c.Name == "id" || c.Name == clause.PrimaryKey
+	}
+	return false
+}
+
+// toUint 将各种整数类型的主键值转换为 uint
+func toUint(v interface{}) (uint, bool) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Int() < 0 {
+			return 0, false
+		}
+		return uint(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return uint(rv.Uint()), true
+	}
+	return 0, false
+}
@@ -42,11 +42,18 @@ func InitDB() error {
 	println()
 	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
+		// 将唯一键冲突等驱动错误转换为 gorm.ErrDuplicatedKey，便于按错误类型判断
+		TranslateError: true,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// 注册数据变更回调，用于缓存失效
+	if err := registerChangeCallbacks(DB); err != nil {
+		return fmt.Errorf("failed to register change callbacks: %w", err)
+	}
+
 	// 获取底层的sql.DB对象进行连接池配置
 	sqlDB, err := DB.DB()
 	if err != nil {
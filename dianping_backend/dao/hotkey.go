@@ -0,0 +1,34 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// HotKeyRankingKey 热点 key 排行（zset：key → 窗口内访问次数），用于重启后预热
+const HotKeyRankingKey = "hotkey:top:"
+
+// SaveHotKeyRanking 保存某类数据的热点排行，覆盖旧排行，保留一天
+func SaveHotKeyRanking(ctx context.Context, rds *redis.Client, name string, counts map[string]int64) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	key := HotKeyRankingKey + name
+	members := make([]*redis.Z, 0, len(counts))
+	for k, c := range counts {
+		members = append(members, &redis.Z{Member: k, Score: float64(c)})
+	}
+	pipe := rds.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.ZAdd(ctx, key, members...)
+	pipe.Expire(ctx, key, 24*time.Hour)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetHotKeyRanking 获取某类数据访问次数最多的 n 个 key
+func GetHotKeyRanking(ctx context.Context, rds *redis.Client, name string, n int) ([]string, error) {
+	return rds.ZRevRange(ctx, HotKeyRankingKey+name, 0, int64(n-1)).Result()
+}
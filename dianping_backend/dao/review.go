@@ -0,0 +1,157 @@
+package dao
+
+import (
+	"context"
+	"dianping/models"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 评价列表排序方式
+const (
+	ReviewSortNewest  = "newest"  // 最新发布
+	ReviewSortHelpful = "helpful" // 最多“有用”
+)
+
+// CreateReview 插入评价
+func CreateReview(ctx context.Context, db *gorm.DB, review *models.Review) error {
+	return db.WithContext(ctx).Create(review).Error
+}
+
+// GetReviewByIDForUpdate 在事务中查询评价并加行锁：修改和删除以锁定后的评分计算商铺评分差值，“有用”标记按评价串行
+func GetReviewByIDForUpdate(ctx context.Context, db *gorm.DB, id uint) (*models.Review, error) {
+	var review models.Review
+	if err := db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&review, id).Error; err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// GetUserShopReview 查询用户对某商铺的评价，没有时返回 (nil, nil)
+func GetUserShopReview(ctx context.Context, db *gorm.DB, userID, shopID uint) (*models.Review, error) {
+	var review models.Review
+	err := db.WithContext(ctx).Where("shop_id = ? AND user_id = ?", shopID, userID).First(&review).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &review, nil
+}
+
+// UpdateReviewFields 更新评价的指定字段，返回是否更新成功（评价不存在时为 false）
+func UpdateReviewFields(ctx context.Context, db *gorm.DB, id uint, fields map[string]interface{}) (bool, error) {
+	result := db.WithContext(ctx).Model(&models.Review{}).Where("id = ?", id).Updates(fields)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteReview 删除评价及其“有用”标记，返回是否删除成功（评价不存在时为 false）。
+// 评价直接物理删除，(shop_id, user_id) 唯一索引才能允许用户删除后重新评价
+func DeleteReview(ctx context.Context, db *gorm.DB, id uint) (bool, error) {
+	result := db.WithContext(ctx).Where("id = ?", id).Delete(&models.Review{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	if err := db.WithContext(ctx).Where("review_id = ?", id).Delete(&models.ReviewHelpful{}).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetShopReviews 分页查询商铺的评价，按最新或最多“有用”排序
+func GetShopReviews(ctx context.Context, db *gorm.DB, shopID uint, sort string, offset, limit int) ([]models.Review, int64, error) {
+	var reviews []models.Review
+	var total int64
+
+	query := db.WithContext(ctx).Model(&models.Review{}).Where("shop_id = ?", shopID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := "id DESC"
+	if sort == ReviewSortHelpful {
+		order = "helpful DESC, id DESC"
+	}
+	err := db.WithContext(ctx).Where("shop_id = ?", shopID).Order(order).Offset(offset).Limit(limit).Find(&reviews).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return reviews, total, nil
+}
+
+// UpdateShopRating 增量更新商铺的评价数量与总分，并按贝叶斯平均重新计算评分（×10 取整）；
+// 需要在事务中调用，第一条语句锁住商铺行，第二条语句读取更新后的汇总值。
+// 已删除的商铺同样更新，恢复后汇总仍然准确
+func UpdateShopRating(ctx context.Context, db *gorm.DB, shopID uint, deltaCount, deltaSum int, priorMean float64, priorWeight int) error {
+	err := db.WithContext(ctx).Unscoped().Model(&models.Shop{}).Where("id = ?", shopID).UpdateColumns(map[string]interface{}{
+		"rating_count": gorm.Expr("rating_count + ?", deltaCount),
+		"rating_sum":   gorm.Expr("rating_sum + ?", deltaSum),
+		"comments":     gorm.Expr("GREATEST(comments + ?, 0)", deltaCount),
+	}).Error
+	if err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Unscoped().Model(&models.Shop{}).Where("id = ?", shopID).UpdateColumn("score",
+		gorm.Expr("ROUND(10 * (? * ? + rating_sum) / (? + rating_count))", priorWeight, priorMean, priorWeight),
+	).Error
+}
+
+// GetReviewHelpful 查询用户对评价的“有用”标记，没有时返回 (nil, nil)
+func GetReviewHelpful(ctx context.Context, db *gorm.DB, userID, reviewID uint) (*models.ReviewHelpful, error) {
+	var helpful models.ReviewHelpful
+	err := db.WithContext(ctx).Where("user_id = ? AND review_id = ?", userID, reviewID).First(&helpful).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &helpful, nil
+}
+
+// CreateReviewHelpful 插入“有用”标记
+func CreateReviewHelpful(ctx context.Context, db *gorm.DB, helpful *models.ReviewHelpful) error {
+	return db.WithContext(ctx).Create(helpful).Error
+}
+
+// DeleteReviewHelpful 删除“有用”标记，返回是否删除成功（已被删除时为 false）
+func DeleteReviewHelpful(ctx context.Context, db *gorm.DB, id uint) (bool, error) {
+	result := db.WithContext(ctx).Delete(&models.ReviewHelpful{}, id)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// AdjustReviewHelpful 调整评价的“有用”数量
+func AdjustReviewHelpful(ctx context.Context, db *gorm.DB, reviewID uint, delta int) error {
+	return db.WithContext(ctx).Model(&models.Review{}).Where("id = ?", reviewID).
+		UpdateColumn("helpful", gorm.Expr("GREATEST(helpful + ?, 0)", delta)).Error
+}
+
+// GetHelpfulReviewIDs 查询用户在给定评价中标记过“有用”的评价ID
+func GetHelpfulReviewIDs(ctx context.Context, db *gorm.DB, userID uint, reviewIDs []uint) (map[uint]bool, error) {
+	result := make(map[uint]bool)
+	if len(reviewIDs) == 0 {
+		return result, nil
+	}
+	var ids []uint
+	err := db.WithContext(ctx).Model(&models.ReviewHelpful{}).
+		Where("user_id = ? AND review_id IN ?", userID, reviewIDs).Pluck("review_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		result[id] = true
+	}
+	return result, nil
+}
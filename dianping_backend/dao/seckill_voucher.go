@@ -8,6 +8,7 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CreateSeckillVoucher 创建秒杀券
@@ -27,22 +28,41 @@ func GetSeckillVoucherByID(voucherID uint) (*models.SeckillVoucher, error) {
 	return &seckillVoucher, nil
 }
 
-// UpdateSeckillVoucher 更新秒杀券信息
-// EN: Update seckill voucher
-func UpdateSeckillVoucher(seckillVoucher *models.SeckillVoucher) error {
-	return DB.Save(seckillVoucher).Error
+// GetSeckillVoucherForUpdate 在事务中查询秒杀券并加行锁，读到的是最新提交的库存
+// EN: Locking read of the seckill voucher row inside a transaction
+func GetSeckillVoucherForUpdate(ctx context.Context, db *gorm.DB, voucherID uint) (*models.SeckillVoucher, error) {
+	var seckillVoucher models.SeckillVoucher
+	err := db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("voucher_id = ?", voucherID).First(&seckillVoucher).Error
+	if err != nil {
+		return nil, err
+	}
+	return &seckillVoucher, nil
+}
+
+// UpdateSeckillVoucher 更新秒杀券的限购与时间窗，只写这几列，不覆盖消费者并发扣减的库存
+// EN: Update the purchase limit and sale window (never the stock column)
+func UpdateSeckillVoucher(ctx context.Context, db *gorm.DB, seckillVoucher *models.SeckillVoucher) error {
+	return db.WithContext(ctx).Model(&models.SeckillVoucher{}).
+		Where("voucher_id = ?", seckillVoucher.VoucherID).
+		Updates(map[string]interface{}{
+			"limit_per_user": seckillVoucher.LimitPerUser,
+			"begin_time":     seckillVoucher.BeginTime,
+			"end_time":       seckillVoucher.EndTime,
+			"update_time":    seckillVoucher.UpdateTime,
+		}).Error
 }
 
 // DeleteSeckillVoucher 删除秒杀券
 // EN: Delete seckill voucher by voucher ID
-func DeleteSeckillVoucher(voucherID uint) error {
-	return DB.Where("voucher_id = ?", voucherID).Delete(&models.SeckillVoucher{}).Error
+func DeleteSeckillVoucher(ctx context.Context, db *gorm.DB, voucherID uint) error {
+	return db.WithContext(ctx).Where("voucher_id = ?", voucherID).Delete(&models.SeckillVoucher{}).Error
 }
 
 // UpdateSeckillVoucherStock 更新秒杀券库存（原子操作）
 // EN: Atomically decrement seckill stock
-func UpdateSeckillVoucherStock(voucherID uint, stock int) error {
-	result := DB.Model(&models.SeckillVoucher{}).
+func UpdateSeckillVoucherStock(ctx context.Context, db *gorm.DB, voucherID uint, stock int) error {
+	result := db.WithContext(ctx).Model(&models.SeckillVoucher{}).
 		Where("voucher_id = ? AND stock >= ?", voucherID, stock).
 		Update("stock", gorm.Expr("stock - ?", stock))
 
@@ -58,6 +78,14 @@ func UpdateSeckillVoucherStock(voucherID uint, stock int) error {
 	return nil
 }
 
+// IncreaseSeckillVoucherStock 回补秒杀券库存（退款/取消订单时使用）
+// EN: Give back seckill stock inside the given transaction
+func IncreaseSeckillVoucherStock(ctx context.Context, db *gorm.DB, voucherID uint, n int) error {
+	return db.WithContext(ctx).Model(&models.SeckillVoucher{}).
+		Where("voucher_id = ?", voucherID).
+		UpdateColumn("stock", gorm.Expr("stock + ?", n)).Error
+}
+
 // CheckSeckillVoucherExists 检查秒杀券是否存在
 // EN: Check if seckill voucher exists
 func CheckSeckillVoucherExists(voucherID uint) (bool, error) {
@@ -71,30 +99,202 @@ func CheckSeckillVoucherExists(voucherID uint) (bool, error) {
 
 // ============== 秒杀券相关缓存设计 =================
 const (
-	SeckillVoucherCache = "cache:seckill_voucher:stock:"
+	SeckillVoucherCache      = "cache:seckill_voucher:stock:"
+	SeckillVoucherOrderCache = "cache:seckill_voucher:bought:" // 用户已购数量 hash（userId → 数量），与 seckill.lua 保持一致
+	SeckillVoucherMetaCache  = "cache:seckill_voucher:meta:"   // 秒杀券元数据 hash（limit 每人限购，begin/end 毫秒时间戳，status 上下架），与 seckill.lua 保持一致
 )
 
-func SetSeckillVoucherStockCache(ctx context.Context, rds *redis.Client, voucherID uint, stock int) error {
+// incrStockIfExistsScript 仅在库存 key 存在时回补，避免 key 过期后凭空创建出错误的库存
+var incrStockIfExistsScript = redis.NewScript(`
+if redis.call('exists', KEYS[1]) == 1 then
+    return redis.call('incrby', KEYS[1], ARGV[1])
+end
+return -1
+`)
+
+// adjustStockScript 按增量调整库存（保留过期时间），key 不存在时返回 nil，调整后小于0时报错
+var adjustStockScript = redis.NewScript(`
+if redis.call('exists', KEYS[1]) == 0 then
+    return false
+end
+local n = tonumber(redis.call('get', KEYS[1])) + tonumber(ARGV[1])
+if n < 0 then
+    return redis.error_reply('stock not enough')
+end
+redis.call('set', KEYS[1], n, 'KEEPTTL')
+return n
+`)
+
+// hsetIfExistsScript 仅在 hash 存在时写入字段（不改变过期时间），避免凭空创建缺少字段的元数据
+var hsetIfExistsScript = redis.NewScript(`
+if redis.call('exists', KEYS[1]) == 0 then
+    return 0
+end
+redis.call('hset', KEYS[1], unpack(ARGV))
+return 1
+`)
+
+// decrBoughtScript 扣减用户已购数量，减到0时删除该字段
+var decrBoughtScript = redis.NewScript(`
+local n = redis.call('hincrby', KEYS[1], ARGV[1], -tonumber(ARGV[2]))
+if n <= 0 then
+    redis.call('hdel', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// seckillCacheTTL 秒杀库存与元数据缓存的过期时间，两者同时写入、同时过期
+const seckillCacheTTL = time.Hour
+
+// SetSeckillVoucherCache 在同一个 MULTI 中写入秒杀库存与元数据（限购、开始/结束时间、tb_voucher 的上下架状态），
+// 使用相同的过期时间，保证库存存在时元数据也完整（seckill.lua 在元数据缺失时拒绝秒杀）
+// EN: Write the stock key and the full metadata hash (including status) atomically with one TTL
+func SetSeckillVoucherCache(ctx context.Context, rds *redis.Client, v *models.SeckillVoucher, stock, status int) error {
+	id := strconv.Itoa(int(v.VoucherID))
+	metaKey := SeckillVoucherMetaCache + id
+	limit := v.LimitPerUser
+	if limit <= 0 {
+		limit = 1
+	}
+	pipe := rds.TxPipeline()
+	pipe.Set(ctx, SeckillVoucherCache+id, strconv.Itoa(stock), seckillCacheTTL)
+	pipe.HSet(ctx, metaKey,
+		"limit", limit,
+		"begin", v.BeginTime.UnixMilli(),
+		"end", v.EndTime.UnixMilli(),
+		"status", status,
+	)
+	pipe.Expire(ctx, metaKey, seckillCacheTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetSeckillVoucherStockCache 读取 Redis 中的秒杀库存，key 不存在时 exists 为 false
+// EN: Read the cached seckill stock
+func GetSeckillVoucherStockCache(ctx context.Context, rds *redis.Client, voucherID uint) (stock int64, exists bool, err error) {
+	key := SeckillVoucherCache + strconv.Itoa(int(voucherID))
+	stock, err = rds.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return stock, true, nil
+}
+
+// IncrSeckillVoucherStockCache 回补 Redis 中的秒杀库存（key 不存在时跳过）
+// EN: Give back stock to the Redis stock key if it is still cached
+func IncrSeckillVoucherStockCache(ctx context.Context, rds *redis.Client, voucherID uint, n int) error {
+	key := SeckillVoucherCache + strconv.Itoa(int(voucherID))
+	return incrStockIfExistsScript.Run(ctx, rds, []string{key}, n).Err()
+}
+
+// SetSeckillVoucherMetaCache 更新已缓存的限购、开始/结束时间，元数据不存在时跳过（由库存重建一并写入）
+// EN: Refresh the cached purchase limit and sale window if the metadata is cached
+func SetSeckillVoucherMetaCache(ctx context.Context, rds *redis.Client, v *models.SeckillVoucher) error {
+	key := SeckillVoucherMetaCache + strconv.Itoa(int(v.VoucherID))
+	limit := v.LimitPerUser
+	if limit <= 0 {
+		limit = 1
+	}
+	return hsetIfExistsScript.Run(ctx, rds, []string{key},
+		"limit", limit,
+		"begin", v.BeginTime.UnixMilli(),
+		"end", v.EndTime.UnixMilli(),
+	).Err()
+}
+
+// SetSeckillVoucherStatusCache 更新已缓存的上下架状态（1-上架，2-下架，3-商铺已删除），元数据不存在时跳过
+// EN: Update the cached on/off-shelf status read by seckill.lua if the metadata is cached
+func SetSeckillVoucherStatusCache(ctx context.Context, rds *redis.Client, voucherID uint, status int) error {
+	key := SeckillVoucherMetaCache + strconv.Itoa(int(voucherID))
+	return hsetIfExistsScript.Run(ctx, rds, []string{key}, "status", status).Err()
+}
+
+// AdjustSeckillVoucherStockCache 按增量调整 Redis 秒杀库存，key 不存在时 exists 为 false
+// EN: Add delta to the cached stock; fails if it would drop below zero
+func AdjustSeckillVoucherStockCache(ctx context.Context, rds *redis.Client, voucherID uint, delta int) (stock int64, exists bool, err error) {
 	key := SeckillVoucherCache + strconv.Itoa(int(voucherID))
-	// data, err := json.Marshal(stock)
-	data := strconv.Itoa(stock)
-	// if err != nil {
-	// 	return err
-	// }
-	return rds.Set(ctx, key, data, time.Hour).Err()
+	stock, err = adjustStockScript.Run(ctx, rds, []string{key}, delta).Int64()
+	if err == redis.Nil {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return stock, true, nil
+}
+
+// DeleteSeckillVoucherCache 删除秒杀券的库存、元数据和已购数量缓存
+// EN: Drop every seckill cache key of a voucher
+func DeleteSeckillVoucherCache(ctx context.Context, rds *redis.Client, voucherID uint) error {
+	id := strconv.Itoa(int(voucherID))
+	return rds.Del(ctx, SeckillVoucherCache+id, SeckillVoucherMetaCache+id, SeckillVoucherOrderCache+id).Err()
+}
+
+// DecrSeckillVoucherUserBought 扣减用户已购数量，使其可以重新抢购
+// EN: Give back n units of the user's per-voucher purchase quota
+func DecrSeckillVoucherUserBought(ctx context.Context, rds *redis.Client, voucherID, userID uint, n int) error {
+	key := SeckillVoucherOrderCache + strconv.Itoa(int(voucherID))
+	return decrBoughtScript.Run(ctx, rds, []string{key}, strconv.Itoa(int(userID)), n).Err()
+}
+
+// GetSeckillVoucherUserBought 读取 Redis 中全部用户的已购数量（userID → 数量），无法解析的字段跳过
+// EN: Read the per-user purchase counters maintained by seckill.lua
+func GetSeckillVoucherUserBought(ctx context.Context, rds *redis.Client, voucherID uint) (map[uint]int, error) {
+	key := SeckillVoucherOrderCache + strconv.Itoa(int(voucherID))
+	fields, err := rds.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint]int, len(fields))
+	for field, value := range fields {
+		userID, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		result[uint(userID)] = n
+	}
+	return result, nil
+}
+
+// AdjustSeckillVoucherUserBought 按增量调整用户已购数量（对账修复使用），调整到0及以下时删除该字段
+// EN: Add delta to the user's purchase counter
+func AdjustSeckillVoucherUserBought(ctx context.Context, rds *redis.Client, voucherID, userID uint, delta int) error {
+	return DecrSeckillVoucherUserBought(ctx, rds, voucherID, userID, -delta)
+}
+
+// GetActiveSeckillVouchers 获取未结束的秒杀券
+// EN: Seckill vouchers whose sale has not ended
+func GetActiveSeckillVouchers(ctx context.Context, db *gorm.DB) ([]models.SeckillVoucher, error) {
+	var vouchers []models.SeckillVoucher
+	err := db.WithContext(ctx).Where("end_time >= ?", time.Now()).Find(&vouchers).Error
+	return vouchers, err
 }
 
 // LoadActiveSeckillVouchersToCache 将当前生效的秒杀券的库存加载到 Redis 缓存
 // EN: Preload current active seckill voucher stocks into Redis
 func LoadActiveSeckillVouchersToCache(ctx context.Context, rds *redis.Client) error {
-	var vouchers []models.SeckillVoucher
-	now := time.Now()
-	if err := DB.WithContext(ctx).Where("end_time >= ?", now).Find(&vouchers).Error; err != nil {
+	vouchers, err := GetActiveSeckillVouchers(ctx, DB)
+	if err != nil {
+		return err
+	}
+	ids := make([]uint, 0, len(vouchers))
+	for _, v := range vouchers {
+		ids = append(ids, v.VoucherID)
+	}
+	statuses, err := GetVoucherStatusMap(ctx, DB, ids)
+	if err != nil {
 		return err
 	}
 
 	for _, v := range vouchers {
-		if err := SetSeckillVoucherStockCache(ctx, rds, v.VoucherID, v.Stock); err != nil {
+		if err := SetSeckillVoucherCache(ctx, rds, &v, v.Stock, statuses[v.VoucherID]); err != nil {
 			return err
 		}
 	}
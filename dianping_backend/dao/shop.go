@@ -3,11 +3,9 @@ package dao
 import (
 	"context"
 	"dianping/models"
-	"encoding/json"
-	"errors"
 	"fmt"
+	"log"
 	"strconv"
-	"time"
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
@@ -55,141 +53,139 @@ func UpdateShop(ctx context.Context, db *gorm.DB, shop *models.Shop) error {
 	return nil
 }
 
-/* ================缓存相关================ */
-
-const (
-	ShopCache         = "cache:shop:description:"
-	ShopLocationCache = "cache:shop:location:"
-)
-
-type logicalShopCache struct {
-	Data     *models.Shop `json:"data"`
-	ExpireAt int64        `json:"expireAt"`
+// DeleteShop 软删除商铺
+func DeleteShop(ctx context.Context, db *gorm.DB, shopID uint) error {
+	return db.WithContext(ctx).Where("id = ?", shopID).Delete(&models.Shop{}).Error
 }
 
-func GetShopCacheById(ctx context.Context, rds *redis.Client, shopId uint) (*models.Shop, error) {
-	key := ShopCache + strconv.Itoa(int(shopId))
-	result := rds.Get(ctx, key)
-
-	// 1. 先判断 Redis 是否返回错误
-	if result.Err() != nil {
-		// 区分"缓存未命中"和"其他错误"
-		if errors.Is(result.Err(), redis.Nil) {
-			return nil, nil // 缓存未命中：返回 nil, nil（或自定义一个"未命中"错误）
-		}
-		// 其他错误（如连接失败）：返回 nil + 具体错误
-		return nil, fmt.Errorf("redis query failed: %w", result.Err())
-	}
-
-	// 2. Redis 键存在，获取JSON字符串
-	jsonStr, err := result.Result()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get cache result: %w", err)
-	}
-
-	// 3. JSON反序列化
+// GetDeletedShopById 查询已软删除的商铺
+func GetDeletedShopById(ctx context.Context, db *gorm.DB, shopID uint) (*models.Shop, error) {
 	shop := &models.Shop{}
-	if err := json.Unmarshal([]byte(jsonStr), shop); err != nil {
-		// 缓存数据损坏：返回 nil + 反序列化错误
-		return nil, fmt.Errorf("cache data unmarshal failed: %w", err)
+	err := db.WithContext(ctx).Unscoped().Where("id = ? AND deleted_at IS NOT NULL", shopID).First(shop).Error
+	if err != nil {
+		return nil, err
 	}
-
-	// 4. 反序列化成功：返回有效 shop 对象
 	return shop, nil
 }
 
-func SetShopCacheById(ctx context.Context, rds *redis.Client, shopId uint, shop *models.Shop) error {
-	// JSON序列化
-	jsonData, err := json.Marshal(shop)
-	if err != nil {
-		return fmt.Errorf("failed to marshal shop to json: %w", err)
+// RestoreShop 恢复已软删除的商铺，返回是否恢复成功（商铺不存在或未删除时为 false）
+func RestoreShop(ctx context.Context, db *gorm.DB, shopID uint) (bool, error) {
+	result := db.WithContext(ctx).Unscoped().Model(&models.Shop{}).
+		Where("id = ? AND deleted_at IS NOT NULL", shopID).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return false, result.Error
 	}
-
-	// 存储到Redis
-	err = rds.Set(ctx, ShopCache+strconv.Itoa(int(shopId)), jsonData, time.Hour).Err()
-	if err != nil {
-		return fmt.Errorf("failed to set cache: %w", err)
-	}
-	return nil
+	return result.RowsAffected == 1, nil
 }
 
-func GetShopCacheByIdWithLogicalExpire(ctx context.Context, rds *redis.Client, shopId uint) (*models.Shop, bool, error) {
-	key := ShopCache + strconv.Itoa(int(shopId))
-	result := rds.Get(ctx, key)
-	if result.Err() != nil {
-		if errors.Is(result.Err(), redis.Nil) {
-			return nil, false, nil
-		}
-		return nil, false, fmt.Errorf("redis query failed: %w", result.Err())
-	}
+/* ================缓存相关================ */
 
-	jsonStr, err := result.Result()
-	if err != nil {
-		return nil, false, fmt.Errorf("failed to get cache result: %w", err)
-	}
+const (
+	ShopCache         = "cache:shop:description:"
+	ShopLocationCache = "cache:shop:location:"
+)
 
-	var env logicalShopCache
-	if err := json.Unmarshal([]byte(jsonStr), &env); err != nil {
-		var shop models.Shop
-		if err2 := json.Unmarshal([]byte(jsonStr), &shop); err2 == nil {
-			return &shop, true, nil
-		}
-		return nil, false, fmt.Errorf("cache data unmarshal failed: %w", err)
-	}
+// shopGeoBatch 全量加载 GEO 索引时每批读取的商铺数量
+const shopGeoBatch = 1000
 
-	if env.Data == nil {
-		return nil, false, nil
-	}
-	return env.Data, time.Now().Unix() <= env.ExpireAt, nil
+// validShopLocation 坐标是否能写入 GEO（纬度范围受 Redis 限制为 ±85.05112878）
+func validShopLocation(shop *models.Shop) bool {
+	return shop.X >= -180 && shop.X <= 180 && shop.Y >= -85.05112878 && shop.Y <= 85.05112878
 }
 
-func SetShopCacheByIdWithLogicalExpire(ctx context.Context, rds *redis.Client, shopId uint, shop *models.Shop, expireAt int64, ttl time.Duration) error {
-	cache := logicalShopCache{Data: shop, ExpireAt: expireAt}
-	jsonData, err := json.Marshal(cache)
+// LoadShopData 分批加载店铺地理位置数据到缓存，按照类型进行存到不同key当中，
+// 返回已加载的商铺ID与类型ID的对应关系（坐标不合法的商铺不加载）
+func LoadShopData(ctx context.Context, db *gorm.DB, rds *redis.Client) (map[uint]uint, error) {
+	loaded := make(map[uint]uint)
+	var shops []models.Shop
+	err := db.WithContext(ctx).Model(&models.Shop{}).Select("id, type_id, x, y").
+		FindInBatches(&shops, shopGeoBatch, func(tx *gorm.DB, batch int) error {
+			pipe := rds.Pipeline()
+			for i := range shops {
+				shop := &shops[i]
+				if !validShopLocation(shop) {
+					log.Printf("商铺坐标不合法，跳过 GEO 索引: id=%d, x=%v, y=%v", shop.ID, shop.X, shop.Y)
+					continue
+				}
+				// 使用 GEOADD 存储店铺位置信息
+				pipe.GeoAdd(ctx, ShopLocationCache+strconv.Itoa(int(shop.TypeID)), &redis.GeoLocation{
+					Name:      strconv.Itoa(int(shop.ID)),
+					Latitude:  shop.Y,
+					Longitude: shop.X,
+				})
+				loaded[shop.ID] = shop.TypeID
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				return fmt.Errorf("failed to set geo cache: %w", err)
+			}
+			return nil
+		}).Error
 	if err != nil {
-		return fmt.Errorf("failed to marshal logical cache: %w", err)
-	}
-	if ttl <= 0 {
-		ttl = 24 * time.Hour
-	}
-	if err := rds.Set(ctx, ShopCache+strconv.Itoa(int(shopId)), jsonData, ttl).Err(); err != nil {
-		return fmt.Errorf("failed to set logical cache: %w", err)
+		return nil, fmt.Errorf("failed to load shop locations: %w", err)
 	}
-	return nil
+	return loaded, nil
 }
 
-func DelShopCacheById(ctx context.Context, rds *redis.Client, shopId uint) error {
-	err := rds.Del(ctx, ShopCache+strconv.Itoa(int(shopId))).Err()
+// UpsertShopLocation 写入商铺坐标到所属类型的 GEO key，并从其他类型的 key 中移除（处理类型变更）
+func UpsertShopLocation(ctx context.Context, rds *redis.Client, shop *models.Shop, typeIDs []uint) error {
+	if !validShopLocation(shop) {
+		return RemoveShopLocation(ctx, rds, shop.ID, typeIDs)
+	}
+	member := strconv.Itoa(int(shop.ID))
+	_, err := rds.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, typeID := range typeIDs {
+			if typeID != shop.TypeID {
+				pipe.ZRem(ctx, ShopLocationCache+strconv.Itoa(int(typeID)), member)
+			}
+		}
+		pipe.GeoAdd(ctx, ShopLocationCache+strconv.Itoa(int(shop.TypeID)), &redis.GeoLocation{
+			Name:      member,
+			Latitude:  shop.Y,
+			Longitude: shop.X,
+		})
+		return nil
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to upsert geo cache: %w", err)
 	}
 	return nil
 }
 
-// LoadShopData 加载店铺地理位置数据到缓存，按照类型进行存到不同key当中
-func LoadShopData(ctx context.Context, db *gorm.DB, rds *redis.Client) error {
-	// 1. 查询所有的店铺
-	var shops []models.Shop
-	err := db.WithContext(ctx).Model(&models.Shop{}).Find(&shops).Error
+// RemoveShopLocation 从所有类型的 GEO key 中移除商铺
+func RemoveShopLocation(ctx context.Context, rds *redis.Client, shopID uint, typeIDs []uint) error {
+	member := strconv.Itoa(int(shopID))
+	_, err := rds.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, typeID := range typeIDs {
+			pipe.ZRem(ctx, ShopLocationCache+strconv.Itoa(int(typeID)), member)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to query shops: %w", err)
+		return fmt.Errorf("failed to remove geo cache: %w", err)
 	}
+	return nil
+}
 
-	// 2. 遍历店铺，根据类型进行缓存
-	for _, shop := range shops {
-		// 2.1 使用 GEOADD 存储店铺位置信息
-		err = rds.GeoAdd(ctx, ShopLocationCache+strconv.Itoa(int(shop.TypeID)), &redis.GeoLocation{
-			Name:      strconv.Itoa(int(shop.ID)),
-			Latitude:  shop.Y,
-			Longitude: shop.X,
-		}).Err()
-
-		if err != nil {
-			return fmt.Errorf("failed to set geo cache: %w", err)
+// GetShopLocationIDs 遍历某个类型 GEO key 中的全部商铺ID
+func GetShopLocationIDs(ctx context.Context, rds *redis.Client, typeID uint) ([]uint, error) {
+	key := ShopLocationCache + strconv.Itoa(int(typeID))
+	var ids []uint
+	iter := rds.ZScan(ctx, key, 0, "", shopGeoBatch).Iterator()
+	for iter.Next(ctx) {
+		// ZSCAN 依次返回 member 和 score
+		id, err := strconv.ParseUint(iter.Val(), 10, 64)
+		if err == nil {
+			ids = append(ids, uint(id))
+		}
+		if !iter.Next(ctx) {
+			break
 		}
 	}
-
-	return nil
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan geo cache: %w", err)
+	}
+	return ids, nil
 }
 
 // GetNearbyShops 获取某个店铺的附近某个距离的所有点
@@ -214,6 +210,53 @@ func GetNearbyShops(ctx context.Context, rds *redis.Client, shop *models.Shop, r
 	return shopIds, nil
 }
 
+// ShopDistance GEO 搜索结果：商铺ID与距离（米）
+type ShopDistance struct {
+	ShopID   uint
+	Distance float64
+}
+
+// SearchShopLocations 在某个类型的 GEO key 中搜索坐标附近 radius 米内的商铺，按距离升序返回前 count 个
+func SearchShopLocations(ctx context.Context, rds *redis.Client, typeID uint, lng, lat, radius float64, count int) ([]ShopDistance, error) {
+	key := ShopLocationCache + strconv.Itoa(int(typeID))
+	locations, err := rds.GeoSearchLocation(ctx, key, &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: redis.GeoSearchQuery{
+			Longitude:  lng,
+			Latitude:   lat,
+			Radius:     radius,
+			RadiusUnit: "m",
+			Sort:       "ASC",
+			Count:      count,
+		},
+		WithDist: true,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to search geo cache: %w", err)
+	}
+
+	results := make([]ShopDistance, 0, len(locations))
+	for _, loc := range locations {
+		id, err := strconv.ParseUint(loc.Name, 10, 64)
+		if err != nil {
+			continue
+		}
+		results = append(results, ShopDistance{ShopID: uint(id), Distance: loc.Dist})
+	}
+	return results, nil
+}
+
+// GetShopsByIDs 批量查询商铺，不保证顺序，不存在的ID被忽略
+func GetShopsByIDs(ctx context.Context, db *gorm.DB, ids []uint) ([]models.Shop, error) {
+	var shops []models.Shop
+	if len(ids) == 0 {
+		return shops, nil
+	}
+	if err := db.WithContext(ctx).Where("id IN ?", ids).Find(&shops).Error; err != nil {
+		return nil, err
+	}
+	return shops, nil
+}
+
 // CreateShop 插入新的商铺记录
 func CreateShop(ctx context.Context, db *gorm.DB, shop *models.Shop) error {
 	return db.WithContext(ctx).Create(shop).Error
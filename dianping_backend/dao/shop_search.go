@@ -0,0 +1,187 @@
+package dao
+
+import (
+	"context"
+	"dianping/models"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// 商铺搜索排序方式
+const (
+	ShopSortDefault   = ""          // 有关键词时按相关度，否则按ID
+	ShopSortScore     = "score"     // 评分从高到低
+	ShopSortSold      = "sold"      // 销量从高到低
+	ShopSortComments  = "comments"  // 评论数从高到低
+	ShopSortPrice     = "price"     // 人均价格从低到高
+	ShopSortPriceDesc = "priceDesc" // 人均价格从高到低
+	ShopSortDistance  = "distance"  // 距离从近到远，需要传入坐标
+)
+
+const (
+	shopSearchIndex = "idx_shop_search"
+	// ngram 全文索引默认按2个字切词（ngram_token_size=2），更短的关键词查不到，改用 LIKE
+	shopSearchMinTokenLen = 2
+)
+
+// shopFullTextEnabled 全文索引是否可用，由 EnsureShopSearchIndex 设置
+var shopFullTextEnabled atomic.Bool
+
+// ShopSearchQuery 商铺搜索条件，零值字段表示不过滤
+type ShopSearchQuery struct {
+	Keyword  string
+	TypeID   uint
+	Area     string
+	MinPrice int
+	MaxPrice int
+	MinScore int // 与 Shop.Score 同单位
+	OpenNow  bool
+	Now      time.Time // OpenNow 判断使用的时间
+	Sort     string
+	// 坐标，HasLocation 为 true 时计算距离
+	X, Y        float64
+	HasLocation bool
+	Page, Size  int
+}
+
+// ShopSearchItem 搜索结果，Distance 单位为米，未传坐标时为空
+type ShopSearchItem struct {
+	models.Shop
+	Distance *float64 `gorm:"column:distance" json:"distance,omitempty"`
+}
+
+// EnsureShopSearchIndex 创建商铺名称、商圈、地址的 ngram 全文索引；
+// MySQL 不支持（如版本过低）时记录日志，搜索退化为 LIKE
+// EN: Create the ngram FULLTEXT index used by shop search, falling back to LIKE on failure
+func EnsureShopSearchIndex(ctx context.Context, db *gorm.DB) error {
+	var count int64
+	err := db.WithContext(ctx).Raw(
+		"SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?",
+		models.Shop{}.TableName(), shopSearchIndex,
+	).Scan(&count).Error
+	if err != nil {
+		return fmt.Errorf("failed to query shop search index: %w", err)
+	}
+
+	if count == 0 {
+		err = db.WithContext(ctx).Exec(fmt.Sprintf(
+			"ALTER TABLE %s ADD FULLTEXT INDEX %s (name, area, address) WITH PARSER ngram",
+			models.Shop{}.TableName(), shopSearchIndex,
+		)).Error
+		if err != nil {
+			shopFullTextEnabled.Store(false)
+			return fmt.Errorf("failed to create shop search index: %w", err)
+		}
+		log.Printf("已创建商铺全文索引 %s", shopSearchIndex)
+	}
+	shopFullTextEnabled.Store(true)
+	return nil
+}
+
+// SearchShops 按关键词和过滤条件分页搜索商铺，返回当前页和总数
+func SearchShops(ctx context.Context, db *gorm.DB, q *ShopSearchQuery) ([]ShopSearchItem, int64, error) {
+	var total int64
+	if err := shopSearchFilter(db.WithContext(ctx), q).Model(&models.Shop{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	selects := []string{"tb_shop.*"}
+	var selectArgs []interface{}
+	fullText, phrase := shopSearchUseFullText(q.Keyword)
+	if fullText {
+		selects = append(selects, "MATCH(name, area, address) AGAINST (? IN BOOLEAN MODE) AS relevance")
+		selectArgs = append(selectArgs, phrase)
+	}
+	if q.HasLocation {
+		// POINT(经度, 纬度)，与 GEO 缓存一致：X 为经度，Y 为纬度
+		selects = append(selects, "ST_Distance_Sphere(POINT(x, y), POINT(?, ?)) AS distance")
+		selectArgs = append(selectArgs, q.X, q.Y)
+	}
+
+	query := shopSearchFilter(db.WithContext(ctx), q).Model(&models.Shop{}).
+		Select(strings.Join(selects, ", "), selectArgs...)
+	switch q.Sort {
+	case ShopSortScore:
+		query = query.Order("score DESC")
+	case ShopSortSold:
+		query = query.Order("sold DESC")
+	case ShopSortComments:
+		query = query.Order("comments DESC")
+	case ShopSortPrice:
+		query = query.Order("avg_price ASC")
+	case ShopSortPriceDesc:
+		query = query.Order("avg_price DESC")
+	case ShopSortDistance:
+		query = query.Order("distance ASC")
+	default:
+		if fullText {
+			query = query.Order("relevance DESC")
+		}
+	}
+
+	var items []ShopSearchItem
+	err := query.Order("id").Offset((q.Page - 1) * q.Size).Limit(q.Size).Find(&items).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// shopSearchUseFullText 判断关键词能否走全文索引，能时返回布尔模式下的短语
+// （短语查询要求 ngram 连续命中，效果接近子串匹配）
+func shopSearchUseFullText(keyword string) (bool, string) {
+	keyword = strings.TrimSpace(keyword)
+	if !shopFullTextEnabled.Load() || utf8.RuneCountInString(keyword) < shopSearchMinTokenLen {
+		return false, ""
+	}
+	return true, `"` + strings.ReplaceAll(keyword, `"`, " ") + `"`
+}
+
+// shopSearchFilter 拼接搜索的过滤条件
+func shopSearchFilter(db *gorm.DB, q *ShopSearchQuery) *gorm.DB {
+	if keyword := strings.TrimSpace(q.Keyword); keyword != "" {
+		if fullText, phrase := shopSearchUseFullText(keyword); fullText {
+			db = db.Where("MATCH(name, area, address) AGAINST (? IN BOOLEAN MODE)", phrase)
+		} else {
+			like := "%" + escapeLike(keyword) + "%"
+			db = db.Where("name LIKE ? OR area LIKE ? OR address LIKE ?", like, like, like)
+		}
+	}
+	if q.TypeID > 0 {
+		db = db.Where("type_id = ?", q.TypeID)
+	}
+	if q.Area != "" {
+		db = db.Where("area = ?", q.Area)
+	}
+	if q.MinPrice > 0 {
+		db = db.Where("avg_price >= ?", q.MinPrice)
+	}
+	if q.MaxPrice > 0 {
+		db = db.Where("avg_price <= ?", q.MaxPrice)
+	}
+	if q.MinScore > 0 {
+		db = db.Where("score >= ?", q.MinScore)
+	}
+	if q.OpenNow {
+		// open_hours 形如 "10:00-22:00"；结束时间早于开始时间表示营业到次日，格式不合法的不算营业中
+		now := q.Now.Format("15:04:05")
+		db = db.Where(`(
+			(TIME(TRIM(SUBSTRING_INDEX(open_hours, '-', 1))) <= TIME(TRIM(SUBSTRING_INDEX(open_hours, '-', -1)))
+				AND TIME(?) BETWEEN TIME(TRIM(SUBSTRING_INDEX(open_hours, '-', 1))) AND TIME(TRIM(SUBSTRING_INDEX(open_hours, '-', -1))))
+			OR (TIME(TRIM(SUBSTRING_INDEX(open_hours, '-', 1))) > TIME(TRIM(SUBSTRING_INDEX(open_hours, '-', -1)))
+				AND (TIME(?) >= TIME(TRIM(SUBSTRING_INDEX(open_hours, '-', 1))) OR TIME(?) < TIME(TRIM(SUBSTRING_INDEX(open_hours, '-', -1)))))
+		)`, now, now, now)
+	}
+	return db
+}
+
+// escapeLike 转义 LIKE 中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -2,12 +2,10 @@ package dao
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"time"
 
-	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"dianping/models"
 )
@@ -34,36 +32,64 @@ func GetShopTypeByName(ctx context.Context, db *gorm.DB, name string) (*models.S
 	return &st, nil
 }
 
-// UpdateShopType 更新 ShopType，通常用于回写 Sort 字段
-func UpdateShopType(ctx context.Context, db *gorm.DB, st *models.ShopType) error {
-	return db.WithContext(ctx).Model(&models.ShopType{}).Where("id = ?", st.ID).Updates(st).Error
+// GetShopTypeByID 根据ID查询 ShopType
+func GetShopTypeByID(ctx context.Context, db *gorm.DB, id uint) (*models.ShopType, error) {
+	var st models.ShopType
+	if err := db.WithContext(ctx).First(&st, id).Error; err != nil {
+		return nil, err
+	}
+	return &st, nil
 }
 
-// ===========缓存相关=============
-
-const (
-	ShopTypeCache = "cache:shop_type"
-)
-
-func GetShopTypeListCache(ctx context.Context, rds *redis.Client) ([]*models.ShopType, error) {
-	key := ShopTypeCache
-	str, err := rds.Get(ctx, key).Result()
-	if err != nil {
+// GetShopTypeForUpdate 在事务中查询 ShopType 并加排他锁（删除类型时使用）
+func GetShopTypeForUpdate(ctx context.Context, db *gorm.DB, id uint) (*models.ShopType, error) {
+	var st models.ShopType
+	if err := db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&st, id).Error; err != nil {
 		return nil, err
 	}
+	return &st, nil
+}
 
-	var shopTypes []*models.ShopType
-	if err := json.Unmarshal([]byte(str), &shopTypes); err != nil {
+// GetShopTypeForShare 在事务中查询 ShopType 并加共享锁：商铺写入该类型期间，类型不能被删除
+func GetShopTypeForShare(ctx context.Context, db *gorm.DB, id uint) (*models.ShopType, error) {
+	var st models.ShopType
+	if err := db.WithContext(ctx).Clauses(clause.Locking{Strength: "SHARE"}).First(&st, id).Error; err != nil {
 		return nil, err
 	}
-	return shopTypes, nil
+	return &st, nil
 }
 
-func SetShopTypeListCache(ctx context.Context, rds *redis.Client, shopTypes []*models.ShopType) error {
-	// 设置一小时的过期时间
-	b, err := json.Marshal(shopTypes)
-	if err != nil {
-		return err
-	}
-	return rds.Set(ctx, ShopTypeCache, b, time.Hour).Err()
+// GetMaxShopTypeSort 获取当前最大的 Sort，没有类型时返回0
+func GetMaxShopTypeSort(ctx context.Context, db *gorm.DB) (int, error) {
+	var maxSort int
+	err := db.WithContext(ctx).Model(&models.ShopType{}).Select("COALESCE(MAX(sort), 0)").Scan(&maxSort).Error
+	return maxSort, err
+}
+
+// UpdateShopType 更新 ShopType，通常用于回写 Sort 字段
+func UpdateShopType(ctx context.Context, db *gorm.DB, st *models.ShopType) error {
+	return db.WithContext(ctx).Model(&models.ShopType{}).Where("id = ?", st.ID).Updates(st).Error
+}
+
+// UpdateShopTypeFields 按字段更新 ShopType（支持把 sort 更新为0等零值）
+func UpdateShopTypeFields(ctx context.Context, db *gorm.DB, id uint, fields map[string]interface{}) error {
+	return db.WithContext(ctx).Model(&models.ShopType{}).Where("id = ?", id).Updates(fields).Error
 }
+
+// DeleteShopType 删除商铺类型（软删除）
+func DeleteShopType(ctx context.Context, db *gorm.DB, id uint) error {
+	return db.WithContext(ctx).Delete(&models.ShopType{}, id).Error
+}
+
+// CountShopsByType 统计某个类型下的商铺数量，包含已软删除的商铺（恢复时需要类型仍然存在）
+func CountShopsByType(ctx context.Context, db *gorm.DB, typeID uint) (int64, error) {
+	var count int64
+	err := db.WithContext(ctx).Unscoped().Model(&models.Shop{}).Where("type_id = ?", typeID).Count(&count).Error
+	return count, err
+}
+
+// ===========缓存相关=============
+
+const (
+	ShopTypeCache = "cache:shop_type"
+)
@@ -1,9 +1,16 @@
 package dao
 
 import (
+	"context"
 	"dianping/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// VoucherListCache 商铺优惠券列表缓存前缀
+const VoucherListCache = "cache:voucher:list:"
+
 // GetAllVoucherIDs 获取所有优惠券ID
 func GetAllVoucherIDs() ([]uint, error) {
 	var ids []uint
@@ -13,3 +20,106 @@ func GetAllVoucherIDs() ([]uint, error) {
 	}
 	return ids, nil
 }
+
+// GetVoucherByID 根据ID获取优惠券
+func GetVoucherByID(ctx context.Context, db *gorm.DB, voucherID uint) (*models.Voucher, error) {
+	var voucher models.Voucher
+	if err := db.WithContext(ctx).First(&voucher, voucherID).Error; err != nil {
+		return nil, err
+	}
+	return &voucher, nil
+}
+
+// GetShopVouchers 获取商铺上架中的优惠券
+func GetShopVouchers(ctx context.Context, db *gorm.DB, shopID uint) ([]models.Voucher, error) {
+	var vouchers []models.Voucher
+	err := db.WithContext(ctx).Where("shop_id = ? AND status = 1", shopID).Find(&vouchers).Error
+	return vouchers, err
+}
+
+// GetVoucherShopIDs 获取优惠券所属商铺ID（包括已删除的优惠券，用于缓存失效）
+func GetVoucherShopIDs(ctx context.Context, db *gorm.DB, voucherIDs []uint) ([]uint, error) {
+	var shopIDs []uint
+	err := db.WithContext(ctx).Unscoped().Model(&models.Voucher{}).
+		Where("id IN ?", voucherIDs).Distinct().Pluck("shop_id", &shopIDs).Error
+	return shopIDs, err
+}
+
+// GetVoucherStock 获取优惠券库存
+func GetVoucherStock(ctx context.Context, db *gorm.DB, voucherID uint) (int, error) {
+	var stock int
+	err := db.WithContext(ctx).Model(&models.Voucher{}).Where("id = ?", voucherID).
+		Select("stock").Scan(&stock).Error
+	return stock, err
+}
+
+// SetVoucherStock 设置优惠券库存（库存对账修复时使用）
+func SetVoucherStock(ctx context.Context, db *gorm.DB, voucherID uint, stock int) error {
+	return db.WithContext(ctx).Model(&models.Voucher{}).
+		Where("id = ?", voucherID).
+		UpdateColumn("stock", stock).Error
+}
+
+// GetVoucherStatusMap 批量获取优惠券上下架状态
+func GetVoucherStatusMap(ctx context.Context, db *gorm.DB, ids []uint) (map[uint]int, error) {
+	result := make(map[uint]int, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	var vouchers []models.Voucher
+	if err := db.WithContext(ctx).Select("id, status").Where("id IN ?", ids).Find(&vouchers).Error; err != nil {
+		return nil, err
+	}
+	for _, v := range vouchers {
+		result[v.ID] = v.Status
+	}
+	return result, nil
+}
+
+// UpdateVoucherFields 更新优惠券的部分字段
+func UpdateVoucherFields(ctx context.Context, db *gorm.DB, voucherID uint, updates map[string]interface{}) error {
+	return db.WithContext(ctx).Model(&models.Voucher{}).Where("id = ?", voucherID).Updates(updates).Error
+}
+
+// DeleteVoucher 删除优惠券（软删除）
+func DeleteVoucher(ctx context.Context, db *gorm.DB, voucherID uint) error {
+	return db.WithContext(ctx).Delete(&models.Voucher{}, voucherID).Error
+}
+
+// DecreaseVoucherStock 扣减优惠券库存，库存不足时返回 false
+func DecreaseVoucherStock(ctx context.Context, db *gorm.DB, voucherID uint, n int) (bool, error) {
+	result := db.WithContext(ctx).Model(&models.Voucher{}).
+		Where("id = ? AND stock >= ?", voucherID, n).
+		UpdateColumn("stock", gorm.Expr("stock - ?", n))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// IncreaseVoucherStock 回补优惠券库存（退款/取消订单时使用）
+func IncreaseVoucherStock(ctx context.Context, db *gorm.DB, voucherID uint, n int) error {
+	return db.WithContext(ctx).Model(&models.Voucher{}).
+		Where("id = ?", voucherID).
+		UpdateColumn("stock", gorm.Expr("stock + ?", n)).Error
+}
+
+// SetShopVouchersStatus 将商铺下状态为 from 的优惠券改为 to，返回被修改的优惠券（只含 id、type）。
+// 需要在事务中调用：先锁定这些优惠券行，并发的上下架要等本事务结束，更新时再次限定 status = from
+func SetShopVouchersStatus(ctx context.Context, db *gorm.DB, shopID uint, from, to int) ([]models.Voucher, error) {
+	var vouchers []models.Voucher
+	err := db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id, type").Where("shop_id = ? AND status = ?", shopID, from).Find(&vouchers).Error
+	if err != nil || len(vouchers) == 0 {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(vouchers))
+	for _, v := range vouchers {
+		ids = append(ids, v.ID)
+	}
+	err = db.WithContext(ctx).Model(&models.Voucher{}).Where("id IN ? AND status = ?", ids, from).Update("status", to).Error
+	if err != nil {
+		return nil, err
+	}
+	return vouchers, nil
+}
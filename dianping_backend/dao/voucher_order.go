@@ -4,7 +4,9 @@ import (
 	"context"
 	"dianping/models"
 	"strconv"
+	"time"
 
+	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 )
 
@@ -13,6 +15,20 @@ func CreateVoucherOrder(ctx context.Context, db *gorm.DB, order *models.VoucherO
 	return db.WithContext(ctx).Create(order).Error
 }
 
+// BackfillVoucherOrderIDs 为缺少订单号（order_id = 0）的历史订单补上订单号（取主键 id），
+// 需要在 AutoMigrate 创建 order_id 唯一索引之前调用；表或列不存在时跳过
+// EN: Give legacy rows a unique order_id before the unique index is created
+func BackfillVoucherOrderIDs(ctx context.Context, db *gorm.DB) (int64, error) {
+	migrator := db.WithContext(ctx).Migrator()
+	if !migrator.HasTable(&models.VoucherOrder{}) || !migrator.HasColumn(&models.VoucherOrder{}, "OrderID") {
+		return 0, nil
+	}
+	// 包含已软删除的订单，唯一索引同样覆盖这些行
+	result := db.WithContext(ctx).Unscoped().Model(&models.VoucherOrder{}).
+		Where("order_id = 0").UpdateColumn("order_id", gorm.Expr("id"))
+	return result.RowsAffected, result.Error
+}
+
 // GetVoucherOrderByID 根据订单ID获取订单信息
 func GetVoucherOrderByID(ctx context.Context, db *gorm.DB, orderID uint) (*models.VoucherOrder, error) {
 	var order models.VoucherOrder
@@ -33,6 +49,16 @@ func GetVoucherOrderByUserAndVoucher(ctx context.Context, db *gorm.DB, userID, v
 	return &order, nil
 }
 
+// GetVoucherOrderByOrderID 根据业务订单号（RedisIdWorker 生成）获取订单
+func GetVoucherOrderByOrderID(ctx context.Context, db *gorm.DB, orderID uint) (*models.VoucherOrder, error) {
+	var order models.VoucherOrder
+	err := db.WithContext(ctx).Where("order_id = ?", orderID).First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
 // CheckVoucherOrderExists 检查用户是否已购买该优惠券
 func CheckVoucherOrderExists(ctx context.Context, db *gorm.DB, userID, voucherID uint) (bool, error) {
 	var count int64
@@ -44,9 +70,68 @@ func CheckVoucherOrderExists(ctx context.Context, db *gorm.DB, userID, voucherID
 }
 
 // CheckSeckillVoucherOrderExists 检查用户是否已购买该秒杀券（专门用于秒杀券的一人一单检查）
+// 已取消、已退款的订单不计入，用户可以重新抢购
 func CheckSeckillVoucherOrderExists(ctx context.Context, db *gorm.DB, userID, voucherID uint) (bool, error) {
 	var count int64
-	err := db.WithContext(ctx).Model(&models.VoucherOrder{}).Where("user_id = ? AND voucher_id = ? AND voucher_type = ?", userID, voucherID, 2).Count(&count).Error
+	err := db.WithContext(ctx).Model(&models.VoucherOrder{}).
+		Where("user_id = ? AND voucher_id = ? AND voucher_type = ?", userID, voucherID, 2).
+		Where("status NOT IN ?", []int{models.OrderStatusCancelled, models.OrderStatusRefunded}).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// SumSeckillVoucherOrderQuantity 统计用户某秒杀券的已购数量（用于每人限购检查）
+// 已取消、已退款的订单不计入
+// EN: Total quantity the user holds for a seckill voucher, excluding cancelled/refunded orders
+func SumSeckillVoucherOrderQuantity(ctx context.Context, db *gorm.DB, userID, voucherID uint) (int, error) {
+	return SumUserVoucherOrderQuantity(ctx, db, userID, voucherID, 2)
+}
+
+// SumSeckillVoucherOrderQuantityByUser 按用户统计某秒杀券的已购数量（userID → 数量），用于核对 Redis 中的已购数量
+// 已取消、已退款的订单不计入
+// EN: Per-user held quantity of a seckill voucher, excluding cancelled/refunded orders
+func SumSeckillVoucherOrderQuantityByUser(ctx context.Context, db *gorm.DB, voucherID uint) (map[uint]int, error) {
+	var rows []struct {
+		UserID   uint
+		Quantity int
+	}
+	err := db.WithContext(ctx).Model(&models.VoucherOrder{}).
+		Where("voucher_id = ? AND voucher_type = ?", voucherID, 2).
+		Where("status NOT IN ?", []int{models.OrderStatusCancelled, models.OrderStatusRefunded}).
+		Select("user_id, COALESCE(SUM(quantity), 0) AS quantity").
+		Group("user_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint]int, len(rows))
+	for _, r := range rows {
+		result[r.UserID] = r.Quantity
+	}
+	return result, nil
+}
+
+// SumUserVoucherOrderQuantity 统计用户某优惠券（按券类型：1-普通券，2-秒杀券）的已购数量
+// 已取消、已退款的订单不计入
+// EN: Total quantity the user holds for a voucher of the given order type
+func SumUserVoucherOrderQuantity(ctx context.Context, db *gorm.DB, userID, voucherID uint, voucherType int) (int, error) {
+	var total int
+	err := db.WithContext(ctx).Model(&models.VoucherOrder{}).
+		Where("user_id = ? AND voucher_id = ? AND voucher_type = ?", userID, voucherID, voucherType).
+		Where("status NOT IN ?", []int{models.OrderStatusCancelled, models.OrderStatusRefunded}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// CheckVoucherOrderExistsByOrderID 检查订单号是否已存在（消息重复投递时保证幂等）
+// EN: Whether an order with this order number was already created
+func CheckVoucherOrderExistsByOrderID(ctx context.Context, db *gorm.DB, orderID uint) (bool, error) {
+	var count int64
+	err := db.WithContext(ctx).Model(&models.VoucherOrder{}).Where("order_id = ?", orderID).Count(&count).Error
 	if err != nil {
 		return false, err
 	}
@@ -63,6 +148,18 @@ func UpdateVoucherOrderStatus(ctx context.Context, db *gorm.DB, orderID uint, st
 	return db.WithContext(ctx).Model(&models.VoucherOrder{}).Where("id = ?", orderID).Update("status", status).Error
 }
 
+// UpdateVoucherOrderStatusFrom 按"当前状态"条件更新订单（CAS），返回是否更新成功
+// 并发下只有一个请求能完成同一次状态迁移，避免重复回补库存
+func UpdateVoucherOrderStatusFrom(ctx context.Context, db *gorm.DB, id uint, from int, updates map[string]interface{}) (bool, error) {
+	result := db.WithContext(ctx).Model(&models.VoucherOrder{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
 // DeleteVoucherOrder 删除订单（软删除）
 func DeleteVoucherOrder(ctx context.Context, db *gorm.DB, orderID uint) error {
 	return db.WithContext(ctx).Delete(&models.VoucherOrder{}, orderID).Error
@@ -76,11 +173,40 @@ func GetVoucherOrdersByUser(ctx context.Context, db *gorm.DB, userID uint, page,
 	return orders, err
 }
 
+// VoucherOrderFilter 订单列表筛选条件，零值表示不筛选
+type VoucherOrderFilter struct {
+	Status      int
+	VoucherType int
+}
+
+// ListUserVoucherOrderDetails 按订单主键倒序游标分页查询用户订单，并关联优惠券标题与商铺
+// lastID 为上一页最后一条的主键，0 表示第一页
+// EN: Cursor-paginated order list of a user joined with voucher/shop info
+func ListUserVoucherOrderDetails(ctx context.Context, db *gorm.DB, userID uint, filter VoucherOrderFilter, lastID uint, size int) ([]models.VoucherOrderDetail, error) {
+	var orders []models.VoucherOrderDetail
+	query := db.WithContext(ctx).Model(&models.VoucherOrder{}).
+		Select("tb_voucher_order.*, tb_voucher.title AS voucher_title, tb_voucher.shop_id AS shop_id, tb_shop.name AS shop_name").
+		Joins("LEFT JOIN tb_voucher ON tb_voucher.id = tb_voucher_order.voucher_id").
+		Joins("LEFT JOIN tb_shop ON tb_shop.id = tb_voucher.shop_id").
+		Where("tb_voucher_order.user_id = ?", userID)
+	if filter.Status > 0 {
+		query = query.Where("tb_voucher_order.status = ?", filter.Status)
+	}
+	if filter.VoucherType > 0 {
+		query = query.Where("tb_voucher_order.voucher_type = ?", filter.VoucherType)
+	}
+	if lastID > 0 {
+		query = query.Where("tb_voucher_order.id < ?", lastID)
+	}
+	err := query.Order("tb_voucher_order.id DESC").Limit(size).Scan(&orders).Error
+	return orders, err
+}
+
 // GetVoucherOrdersByVoucher 获取某优惠券的所有订单
 func GetVoucherOrdersByVoucher(ctx context.Context, db *gorm.DB, voucherID uint, page, size int) ([]models.VoucherOrder, error) {
 	var orders []models.VoucherOrder
 	offset := (page - 1) * size
-	err := db.WithContext(ctx).Where("voucher_id = ?", voucherID).Offset(offset).Limit(size).Find(&orders).Error
+	err := db.WithContext(ctx).Where("voucher_id = ?", voucherID).Order("id DESC").Offset(offset).Limit(size).Find(&orders).Error
 	return orders, err
 }
 
@@ -98,6 +224,15 @@ func CountVoucherOrdersByVoucher(ctx context.Context, db *gorm.DB, voucherID uin
 	return count, err
 }
 
+// GetUnpaidVoucherOrders 分批获取未支付订单（启动时恢复超时取消任务）
+func GetUnpaidVoucherOrders(ctx context.Context, db *gorm.DB, afterID uint, size int) ([]models.VoucherOrder, error) {
+	var orders []models.VoucherOrder
+	err := db.WithContext(ctx).
+		Where("status = ? AND id > ?", models.OrderStatusUnpaid, afterID).
+		Order("id").Limit(size).Find(&orders).Error
+	return orders, err
+}
+
 // ======== 用户订单缓存 =========
 const (
 	userOrderSetCache = "cache:seckill_voucher:order:"
@@ -107,3 +242,71 @@ const (
 func AddUserOrderToCache(ctx context.Context, userID, orderID uint) error {
 	return Redis.SAdd(ctx, userOrderSetCache+strconv.Itoa(int(userID)), orderID).Err()
 }
+
+// ======== 秒杀订单异步处理状态 =========
+const (
+	// OrderProcessStatusKey 订单处理状态 hash（status/userId/reason），由 seckill.lua 写入 pending，消费者写入 created/failed
+	OrderProcessStatusKey = "order:process:"
+	// OrderProcessStatusTTL 处理状态的保留时间，与 seckill.lua 保持一致
+	OrderProcessStatusTTL = 10 * time.Minute
+)
+
+// SetOrderProcessStatus 写入订单处理状态
+// EN: Record the async processing result of a seckill order
+func SetOrderProcessStatus(ctx context.Context, rds *redis.Client, orderID, userID, status, reason string) error {
+	key := OrderProcessStatusKey + orderID
+	pipe := rds.TxPipeline()
+	pipe.HSet(ctx, key, "status", status, "userId", userID, "reason", reason)
+	pipe.Expire(ctx, key, OrderProcessStatusTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetOrderProcessStatus 读取订单处理状态，不存在时返回空 map
+func GetOrderProcessStatus(ctx context.Context, rds *redis.Client, orderID string) (map[string]string, error) {
+	return rds.HGetAll(ctx, OrderProcessStatusKey+orderID).Result()
+}
+
+// ======== 未支付订单超时取消（延迟队列） =========
+const (
+	// OrderPayTimeoutKey 延迟队列 zset：member 为业务订单号，score 为截止时间（秒）
+	OrderPayTimeoutKey = "order:pay_timeout"
+)
+
+// AddOrderPayTimeout 登记订单的支付截止时间
+func AddOrderPayTimeout(ctx context.Context, rds *redis.Client, orderID uint, deadline time.Time) error {
+	return rds.ZAdd(ctx, OrderPayTimeoutKey, &redis.Z{
+		Score:  float64(deadline.Unix()),
+		Member: strconv.FormatUint(uint64(orderID), 10),
+	}).Err()
+}
+
+// GetDueOrderPayTimeouts 获取已到期的订单号
+func GetDueOrderPayTimeouts(ctx context.Context, rds *redis.Client, now time.Time, limit int64) ([]uint, error) {
+	members, err := rds.ZRangeByScore(ctx, OrderPayTimeoutKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.Unix(), 10),
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseUint(m, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// RemoveOrderPayTimeout 移除订单的超时任务，返回是否由本次调用移除（多实例下用于抢占任务）
+func RemoveOrderPayTimeout(ctx context.Context, rds *redis.Client, orderID uint) (bool, error) {
+	n, err := rds.ZRem(ctx, OrderPayTimeoutKey, strconv.FormatUint(uint64(orderID), 10)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
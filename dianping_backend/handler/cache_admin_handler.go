@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"dianping/service"
+	"dianping/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCacheStats 查看缓存各级命中统计
+// EN: L1 (in-process) and L2 (Redis) hit/miss counters per cache
+func GetCacheStats(c *gin.Context) {
+	result := service.GetCacheStats(c.Request.Context())
+	utils.Response(c, result)
+}
+
+// GetHotKeys 查看热点商铺与博客
+// EN: Top-N hot shop/blog IDs in the sliding window (this instance)
+func GetHotKeys(c *gin.Context) {
+	n, err := strconv.Atoi(c.DefaultQuery("n", "10"))
+	if err != nil || n <= 0 || n > 100 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的数量")
+		return
+	}
+
+	result := service.GetHotKeys(c.Request.Context(), n)
+	utils.Response(c, result)
+}
+
+// GetBloomFilterStats 查看布隆过滤器状态
+// EN: Type, RedisBloom INFO, last rebuild and stale counts of the shop/user/voucher filters
+func GetBloomFilterStats(c *gin.Context) {
+	result := service.GetBloomFilterStats(c.Request.Context())
+	utils.Response(c, result)
+}
+
+// RebuildBloomFilter 立即重建布隆过滤器
+// EN: Rebuild a filter from MySQL into a new key and atomically swap it in
+func RebuildBloomFilter(c *gin.Context) {
+	name := c.Param("name")
+	if name != "shop" && name != "user" && name != "voucher" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "不支持的过滤器类型")
+		return
+	}
+
+	result := service.RebuildBloomFilter(c.Request.Context(), name)
+	utils.Response(c, result)
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"dianping/service"
+	"dianping/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateReview 发布商铺评价
+// EN: Post a review for a shop
+func CreateReview(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	var req service.ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	result := service.CreateReview(c.Request.Context(), userID.(uint), &req)
+	utils.Response(c, result)
+}
+
+// UpdateReview 修改自己的评价
+// EN: Edit one's own review
+func UpdateReview(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的评价ID")
+		return
+	}
+
+	var req service.ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	result := service.UpdateReview(c.Request.Context(), userID.(uint), uint(id), &req)
+	utils.Response(c, result)
+}
+
+// DeleteReview 删除自己的评价
+// EN: Delete one's own review
+func DeleteReview(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的评价ID")
+		return
+	}
+
+	result := service.DeleteReview(c.Request.Context(), userID.(uint), uint(id))
+	utils.Response(c, result)
+}
+
+// ToggleReviewHelpful 标记/取消评价“有用”
+// EN: Toggle a "helpful" vote on a review
+func ToggleReviewHelpful(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的评价ID")
+		return
+	}
+
+	result := service.ToggleReviewHelpful(c.Request.Context(), userID.(uint), uint(id))
+	utils.Response(c, result)
+}
+
+// GetShopReviews 获取商铺评价列表
+// EN: List a shop's reviews (sort: newest | helpful)
+func GetShopReviews(c *gin.Context) {
+	shopID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的商铺ID")
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("current", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+
+	// 可未登录访问：未登录时按未标记“有用”处理
+	var uid uint = 0
+	if userID, exists := c.Get("userID"); exists {
+		uid = userID.(uint)
+	}
+
+	result := service.GetShopReviews(c.Request.Context(), uint(shopID), c.Query("sort"), page, size, uid)
+	utils.Response(c, result)
+}
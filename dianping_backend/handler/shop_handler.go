@@ -67,14 +67,64 @@ func GetShopByName(c *gin.Context) {
 	utils.Response(c, result)
 }
 
+// SearchShops 组合搜索商铺
+// EN: Search shops by keyword with filters and sorting
+func SearchShops(c *gin.Context) {
+	var req service.SearchShopRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.SearchShops(c.Request.Context(), &req)
+	utils.Response(c, result)
+}
+
+// GetShopsNearLocation 查询用户坐标附近的商铺（游标分页）
+// EN: Shops near the user's location, sorted by distance
+func GetShopsNearLocation(c *gin.Context) {
+	var req service.NearbyShopRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.GetShopsNearLocation(c.Request.Context(), &req)
+	utils.Response(c, result)
+}
+
+// DeleteShop 删除商铺（软删除）
+// EN: Soft-delete a shop
+func DeleteShop(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的商铺ID")
+		return
+	}
+
+	result := service.DeleteShop(c.Request.Context(), uint(id))
+	utils.Response(c, result)
+}
+
+// RestoreShop 恢复已删除的商铺
+// EN: Restore a soft-deleted shop
+func RestoreShop(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的商铺ID")
+		return
+	}
+
+	result := service.RestoreShop(c.Request.Context(), uint(id))
+	utils.Response(c, result)
+}
+
 // SaveShop 新增商铺
-// EN: Create a shop (with optional type)
+// EN: Create a shop under an existing shop type
 func SaveShop(c *gin.Context) {
 	var req struct {
-		Name   string `json:"name" binding:"required"`
-		TypeID uint   `json:"typeId"`
-		// TypeName  string  `json:"typeName"`
-		TypeIcon  string  `json:"typeIcon"`
+		Name      string  `json:"name" binding:"required"`
+		TypeID    uint    `json:"typeId" binding:"required"`
 		Images    string  `json:"images"`
 		Area      string  `json:"area"`
 		Address   string  `json:"address"`
@@ -101,7 +151,7 @@ func SaveShop(c *gin.Context) {
 		OpenHours: req.OpenHours,
 	}
 
-	result := service.CreateShopWithType(c.Request.Context(), shop, req.TypeIcon)
+	result := service.CreateShop(c.Request.Context(), shop)
 	utils.Response(c, result)
 }
 
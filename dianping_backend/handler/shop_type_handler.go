@@ -3,6 +3,8 @@ package handler
 import (
 	"dianping/service"
 	"dianping/utils"
+	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,3 +15,78 @@ func GetShopTypeList(c *gin.Context) {
 	result := service.GetShopTypeList(c.Request.Context())
 	utils.Response(c, result)
 }
+
+// CreateShopType 新增商铺类型
+// EN: Create a shop type (admin)
+func CreateShopType(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required,max=32"`
+		Icon string `json:"icon" binding:"max=255"`
+		Sort int    `json:"sort"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.CreateShopType(c.Request.Context(), req.Name, req.Icon, req.Sort)
+	utils.Response(c, result)
+}
+
+// UpdateShopType 修改商铺类型
+// EN: Partially update a shop type (admin)
+func UpdateShopType(c *gin.Context) {
+	id, ok := parseShopTypeID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name *string `json:"name" binding:"omitempty,min=1,max=32"`
+		Icon *string `json:"icon" binding:"omitempty,max=255"`
+		Sort *int    `json:"sort"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.UpdateShopType(c.Request.Context(), id, req.Name, req.Icon, req.Sort)
+	utils.Response(c, result)
+}
+
+// ReorderShopTypes 调整商铺类型顺序
+// EN: Reorder shop types by the given ID list (admin)
+func ReorderShopTypes(c *gin.Context) {
+	var req struct {
+		IDs []uint `json:"ids" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.ReorderShopTypes(c.Request.Context(), req.IDs)
+	utils.Response(c, result)
+}
+
+// DeleteShopType 删除商铺类型
+// EN: Delete a shop type that has no shops (admin)
+func DeleteShopType(c *gin.Context) {
+	id, ok := parseShopTypeID(c)
+	if !ok {
+		return
+	}
+
+	result := service.DeleteShopType(c.Request.Context(), id)
+	utils.Response(c, result)
+}
+
+// parseShopTypeID 解析路径中的商铺类型ID，失败时直接返回 400
+func parseShopTypeID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的商铺类型ID")
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"dianping/service"
+	"dianping/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStockReconcileReport 查看秒杀库存对账报告
+// EN: Latest Redis-vs-MySQL stock reconcile report (?refresh=true runs a new check)
+func GetStockReconcileReport(c *gin.Context) {
+	refresh := c.Query("refresh") == "true"
+	result := service.GetStockReconcileReport(c.Request.Context(), refresh)
+	utils.Response(c, result)
+}
+
+// RepairSeckillStock 立即对账并修复秒杀库存
+// EN: Reconcile now and repair discrepancies
+func RepairSeckillStock(c *gin.Context) {
+	result := service.RepairSeckillStock(c.Request.Context())
+	utils.Response(c, result)
+}
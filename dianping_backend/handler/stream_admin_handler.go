@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"dianping/service"
+	"dianping/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStreamInfo 获取订单 Stream 运行状态
+// EN: Stream lag, pending per consumer, oldest pending age and DLQ size
+func GetStreamInfo(c *gin.Context) {
+	result := service.GetStreamInfo(c.Request.Context())
+	utils.Response(c, result)
+}
+
+// ListStreamPending 查看 pending 消息明细
+// EN: List pending entries (optionally filtered by consumer)
+func ListStreamPending(c *gin.Context) {
+	count, err := strconv.ParseInt(c.DefaultQuery("count", "20"), 10, 64)
+	if err != nil || count <= 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的数量")
+		return
+	}
+
+	result := service.ListStreamPending(c.Request.Context(), c.Query("consumer"), count)
+	utils.Response(c, result)
+}
+
+// ListDeadLetters 查看死信消息
+// EN: List recent dead-lettered messages
+func ListDeadLetters(c *gin.Context) {
+	count, err := strconv.ParseInt(c.DefaultQuery("count", "20"), 10, 64)
+	if err != nil || count <= 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的数量")
+		return
+	}
+
+	result := service.ListDeadLetters(c.Request.Context(), count)
+	utils.Response(c, result)
+}
+
+// ReplayDeadLetter 回放死信消息
+// EN: Replay a dead-lettered message back into stream.orders
+func ReplayDeadLetter(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "消息ID不能为空")
+		return
+	}
+
+	result := service.ReplayDeadLetter(c.Request.Context(), id)
+	utils.Response(c, result)
+}
+
+// TrimStream 裁剪订单 Stream 或死信队列
+// EN: Trim acknowledged entries of stream.orders or cap the DLQ
+func TrimStream(c *gin.Context) {
+	var req struct {
+		Target string `json:"target" binding:"required,oneof=stream dlq"`
+		MaxLen int64  `json:"maxLen"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.TrimStream(c.Request.Context(), req.Target, req.MaxLen)
+	utils.Response(c, result)
+}
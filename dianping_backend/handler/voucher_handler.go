@@ -24,7 +24,7 @@ func GetVoucherList(c *gin.Context) {
 		return
 	}
 
-	result := service.GetVoucherList(uint(shopId))
+	result := service.GetVoucherList(c.Request.Context(), uint(shopId))
 	utils.Response(c, result)
 }
 
@@ -75,3 +75,85 @@ func GetSeckillVoucher(c *gin.Context) {
 	result := service.GetSeckillVoucher(uint(voucherId))
 	utils.Response(c, result)
 }
+
+// UpdateSeckillVoucher 编辑秒杀券
+// EN: Edit a seckill voucher (rejected during a running sale unless force=true)
+func UpdateSeckillVoucher(c *gin.Context) {
+	voucherId, ok := parseVoucherID(c)
+	if !ok {
+		return
+	}
+
+	var req service.UpdateSeckillVoucherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.UpdateSeckillVoucher(c.Request.Context(), voucherId, &req)
+	utils.Response(c, result)
+}
+
+// DeleteSeckillVoucher 删除秒杀券
+// EN: Delete a seckill voucher (?force=true during a running sale)
+func DeleteSeckillVoucher(c *gin.Context) {
+	voucherId, ok := parseVoucherID(c)
+	if !ok {
+		return
+	}
+
+	force := c.Query("force") == "true"
+	result := service.DeleteSeckillVoucher(c.Request.Context(), voucherId, force)
+	utils.Response(c, result)
+}
+
+// SetSeckillVoucherStatus 上架/下架秒杀券
+// EN: Put a seckill voucher on (1) or off (2) the shelf
+func SetSeckillVoucherStatus(c *gin.Context) {
+	voucherId, ok := parseVoucherID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Status int  `json:"status" binding:"required,oneof=1 2"` // 1-上架，2-下架
+		Force  bool `json:"force"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.SetSeckillVoucherStatus(c.Request.Context(), voucherId, req.Status, req.Force)
+	utils.Response(c, result)
+}
+
+// RestockSeckillVoucher 调整秒杀券库存
+// EN: Add (positive delta) or remove (negative delta) seckill stock
+func RestockSeckillVoucher(c *gin.Context) {
+	voucherId, ok := parseVoucherID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Delta int `json:"delta" binding:"required,ne=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.RestockSeckillVoucher(c.Request.Context(), voucherId, req.Delta)
+	utils.Response(c, result)
+}
+
+// parseVoucherID 解析路径中的优惠券ID
+func parseVoucherID(c *gin.Context) (uint, bool) {
+	voucherId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的优惠券ID")
+		return 0, false
+	}
+	return uint(voucherId), true
+}
@@ -10,7 +10,7 @@ import (
 )
 
 // SeckillVoucher 秒杀优惠券
-// EN: Purchase a seckill voucher (one per user)
+// EN: Purchase one or more units of a seckill voucher (subject to the per-user limit)
 func SeckillVoucher(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -25,7 +25,186 @@ func SeckillVoucher(c *gin.Context) {
 		return
 	}
 
+	quantity, ok := bindQuantity(c)
+	if !ok {
+		return
+	}
+
 	ctx := c.Request.Context()
-	result := service.SeckillVoucher(ctx, userID.(uint), uint(voucherId))
+	result := service.SeckillVoucher(ctx, userID.(uint), uint(voucherId), quantity)
+	utils.Response(c, result)
+}
+
+// PurchaseVoucher 购买普通券
+// EN: Buy a normal (non-seckill) voucher synchronously
+func PurchaseVoucher(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	voucherId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的优惠券ID")
+		return
+	}
+
+	quantity, ok := bindQuantity(c)
+	if !ok {
+		return
+	}
+
+	result := service.PurchaseVoucher(c.Request.Context(), userID.(uint), uint(voucherId), quantity)
+	utils.Response(c, result)
+}
+
+// GetVoucherOrderStatus 查询秒杀订单处理状态
+// EN: Poll whether an async seckill order is pending, created or failed
+func GetVoucherOrderStatus(c *gin.Context) {
+	userID, orderId, ok := parseUserOrder(c)
+	if !ok {
+		return
+	}
+
+	result := service.GetVoucherOrderStatus(c.Request.Context(), userID, orderId)
 	utils.Response(c, result)
 }
+
+// ListMyVoucherOrders 我的订单列表
+// EN: List current user's orders (filters: status, voucherType; cursor: lastId)
+func ListMyVoucherOrders(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	var req struct {
+		Status      int  `form:"status" binding:"omitempty,min=1,max=5"`
+		VoucherType int  `form:"voucherType" binding:"omitempty,oneof=1 2"`
+		LastID      uint `form:"lastId"`
+		Size        int  `form:"size" binding:"omitempty,min=1,max=50"`
+	}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+	if req.Size == 0 {
+		req.Size = 10
+	}
+
+	result := service.ListMyVoucherOrders(c.Request.Context(), userID.(uint), req.Status, req.VoucherType, req.LastID, req.Size)
+	utils.Response(c, result)
+}
+
+// ListVoucherOrdersByVoucher 商家查看某优惠券的订单
+// EN: List orders of a voucher (merchant/admin)
+func ListVoucherOrdersByVoucher(c *gin.Context) {
+	voucherId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的优惠券ID")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 10
+	}
+
+	result := service.ListVoucherOrdersByVoucher(c.Request.Context(), uint(voucherId), page, size)
+	utils.Response(c, result)
+}
+
+// PayVoucherOrder 支付订单
+// EN: Pay an unpaid order
+func PayVoucherOrder(c *gin.Context) {
+	userID, orderId, ok := parseUserOrder(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		PayType int `json:"payType" binding:"required,oneof=1 2 3"` // 1-余额 2-支付宝 3-微信
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.PayVoucherOrder(c.Request.Context(), userID, orderId, req.PayType)
+	utils.Response(c, result)
+}
+
+// UseVoucherOrder 核销订单
+// EN: Mark a paid order as used
+func UseVoucherOrder(c *gin.Context) {
+	userID, orderId, ok := parseUserOrder(c)
+	if !ok {
+		return
+	}
+
+	result := service.UseVoucherOrder(c.Request.Context(), userID, orderId)
+	utils.Response(c, result)
+}
+
+// RefundVoucherOrder 订单退款
+// EN: Refund a paid order
+func RefundVoucherOrder(c *gin.Context) {
+	userID, orderId, ok := parseUserOrder(c)
+	if !ok {
+		return
+	}
+
+	result := service.RefundVoucherOrder(c.Request.Context(), userID, orderId)
+	utils.Response(c, result)
+}
+
+// CancelVoucherOrder 取消订单
+// EN: Cancel an unpaid order
+func CancelVoucherOrder(c *gin.Context) {
+	userID, orderId, ok := parseUserOrder(c)
+	if !ok {
+		return
+	}
+
+	result := service.CancelVoucherOrder(c.Request.Context(), userID, orderId)
+	utils.Response(c, result)
+}
+
+// parseUserOrder 解析登录用户和路径中的订单号，失败时已写入响应
+func parseUserOrder(c *gin.Context) (uint, uint, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return 0, 0, false
+	}
+
+	orderId, err := strconv.ParseUint(c.Param("orderId"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的订单ID")
+		return 0, 0, false
+	}
+	return userID.(uint), uint(orderId), true
+}
+
+// bindQuantity 解析购买数量，请求体可选，不传时购买1件
+func bindQuantity(c *gin.Context) (int, bool) {
+	req := struct {
+		Quantity int `json:"quantity" binding:"omitempty,min=1,max=100"`
+	}{Quantity: 1}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+			return 0, false
+		}
+		if req.Quantity == 0 {
+			req.Quantity = 1
+		}
+	}
+	return req.Quantity, true
+}
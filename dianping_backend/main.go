@@ -37,10 +37,17 @@ func main() {
 		log.Fatalf("Failed to initialize Redis: %v", err)
 	}
 
-	// 启动时将当前生效的秒杀券库存加载到 Redis 缓存（缓存丢失时可恢复）
-	if err := dao.LoadActiveSeckillVouchersToCache(context.Background(), dao.Redis); err != nil {
-		log.Printf("Warning: failed to load seckill voucher cache: %v", err)
-		// 不阻止服务启动，但记录日志以便排查
+	// 初始化业务缓存客户端
+	service.InitCacheClients()
+
+	// 启动缓存失效任务（订阅 dao 层数据变更事件，延迟双删 + 失败重试）
+	service.StartCacheInvalidator()
+
+	// 历史订单可能没有订单号（order_id = 0），先补齐再由 AutoMigrate 创建唯一索引
+	if n, err := dao.BackfillVoucherOrderIDs(context.Background(), dao.DB); err != nil {
+		log.Fatalf("Failed to backfill voucher order IDs: %v", err)
+	} else if n > 0 {
+		log.Printf("Backfilled order_id for %d voucher orders", n)
 	}
 
 	// 自动迁移数据库表
@@ -54,26 +61,51 @@ func main() {
 		&models.Blog{},
 		&models.Follow{},
 		&models.BlogLike{},
+		&models.CacheInvalidation{},
+		&models.Review{},
+		&models.ReviewHelpful{},
 	); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// 启动时将当前生效的秒杀券库存加载到 Redis 缓存（缓存丢失时可恢复）；
+	// 必须在迁移之后，否则新增的列（如 limit_per_user）尚不存在，读到零值写入缓存
+	if err := dao.LoadActiveSeckillVouchersToCache(context.Background(), dao.Redis); err != nil {
+		log.Printf("Warning: failed to load seckill voucher cache: %v", err)
+		// 不阻止服务启动，但记录日志以便排查
+	}
+
+	// 创建商铺搜索使用的全文索引，失败时搜索退化为 LIKE
+	if err := dao.EnsureShopSearchIndex(context.Background(), dao.DB); err != nil {
+		log.Printf("Warning: shop search falls back to LIKE: %v", err)
+	}
+
 	// 初始化布隆过滤器
 	if err := initBloomFilters(); err != nil {
 		log.Printf("Warning: Failed to initialize bloom filters: %v", err)
 		// 布隆过滤器初始化失败不应该阻止服务启动，只记录警告
 	}
 
-	// 初始化Redis Stream消费者
-	if err := service.InitStreamConsumer(); err != nil {
-		log.Fatalf("Failed to initialize stream consumer: %v", err)
-	}
+	// 新增/删除时同步过滤器，并定期全量重建
+	service.StartBloomMaintainer()
 
-	// 初始化地理位置数据到redis
-	if err := dao.LoadShopData(context.Background(), dao.DB, dao.Redis); err != nil {
-		log.Fatalf("Failed to load shop locations: %v", err)
+	// 初始化订单队列消费者（默认 Redis Stream）
+	if err := service.InitOrderQueue(); err != nil {
+		log.Fatalf("Failed to initialize order queue: %v", err)
 	}
 
+	// 启动未支付订单超时取消任务
+	service.StartOrderTimeoutWorker()
+
+	// 启动秒杀库存定时对账
+	service.StartStockReconciler()
+
+	// 启动热点缓存预热（启动时按上次的热点排行预热，之后定期在过期前重建）
+	service.StartCachePrewarmer()
+
+	// 商铺 GEO 索引：后台全量加载并定期校正，商铺写入时实时更新
+	service.StartShopGeoSync()
+
 	// 设置路由
 	r := router.SetupRouter()
 
@@ -102,8 +134,23 @@ func main() {
 	<-quit
 	log.Println("Shutting down server...")
 
-	// 停止Stream消费者
-	service.StopStreamConsumers()
+	// 停止订单队列消费者
+	service.StopOrderQueue()
+
+	// 停止订单超时取消任务
+	service.StopOrderTimeoutWorker()
+
+	// 停止秒杀库存对账
+	service.StopStockReconciler()
+
+	// 停止热点缓存预热
+	service.StopCachePrewarmer()
+	service.StopBloomMaintainer()
+	service.StopShopGeoSync()
+
+	// 停止缓存失效任务与失效通知订阅
+	service.StopCacheInvalidator()
+	service.StopCacheClients()
 
 	// 关闭HTTP服务器
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -122,6 +169,9 @@ func initBloomFilters() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// 选择过滤器存储后端（未加载 RedisBloom 时退化为 Redis 位图）与类型（bloom/cuckoo）
+	service.ConfigureBloomFilters(ctx)
+
 	// 创建布隆过滤器初始化器
 	initializer := utils.NewBloomInitializer(dao.Redis, dao.DB)
 
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// CacheInvalidation 删除失败待重试的缓存 key（Redis 短暂不可用时持久化到 MySQL，由后台任务重试）
+// EN: Cache key whose invalidation failed and is waiting to be retried
+type CacheInvalidation struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `json:"createdAt"`
+	CacheKey    string    `gorm:"size:255;not null" json:"cacheKey"`
+	Attempts    int       `gorm:"not null;default:0" json:"attempts"`
+	NextRetryAt time.Time `gorm:"index" json:"nextRetryAt"`
+	LastError   string    `gorm:"size:512" json:"lastError"`
+}
+
+func (CacheInvalidation) TableName() string {
+	return "tb_cache_invalidation"
+}
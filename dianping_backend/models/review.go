@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Review 商铺评价模型，每个用户对每个商铺只有一条评价（唯一索引保证），删除时物理删除
+// EN: Shop review entity (rating 1-5)
+type Review struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	ShopID    uint      `gorm:"uniqueIndex:idx_review_shop_user" json:"shopId"`
+	UserID    uint      `gorm:"uniqueIndex:idx_review_shop_user" json:"userId"`
+	Rating    int       `json:"rating"` // 1-5 星
+	Content   string    `gorm:"size:2048" json:"content"`
+	Images    string    `gorm:"size:2048" json:"images"` // 图片地址，多张以逗号分隔
+	Helpful   int       `gorm:"not null;default:0" json:"helpful"`
+	IsHelpful bool      `gorm:"-" json:"isHelpful"` // 当前用户是否标记为有用，不参与数据库迁移
+}
+
+func (Review) TableName() string {
+	return "tb_review"
+}
+
+// ReviewHelpful 评价“有用”标记，取消时直接删除记录
+type ReviewHelpful struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UserID    uint      `gorm:"uniqueIndex:idx_review_helpful_user" json:"userId"`
+	ReviewID  uint      `gorm:"uniqueIndex:idx_review_helpful_user" json:"reviewId"`
+}
+
+func (ReviewHelpful) TableName() string {
+	return "tb_review_helpful"
+}
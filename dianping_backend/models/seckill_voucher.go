@@ -6,12 +6,13 @@ import "time"
 // 与优惠券是一对一关系
 // EN: Seckill voucher model (one-to-one with voucher)
 type SeckillVoucher struct {
-	VoucherID  uint      `gorm:"primaryKey;column:voucher_id" json:"voucherId"` // 关联的优惠券的id
-	Stock      int       `gorm:"column:stock;not null" json:"stock"`            // 库存
-	CreateTime time.Time `gorm:"column:create_time;not null;default:CURRENT_TIMESTAMP" json:"createTime"` // 创建时间
-	BeginTime  time.Time `gorm:"column:begin_time;not null" json:"beginTime"`   // 生效时间
-	EndTime    time.Time `gorm:"column:end_time;not null" json:"endTime"`       // 失效时间
-	UpdateTime time.Time `gorm:"column:update_time;not null;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updateTime"` // 更新时间
+	VoucherID    uint      `gorm:"primaryKey;column:voucher_id" json:"voucherId"`                                                       // 关联的优惠券的id
+	Stock        int       `gorm:"column:stock;not null" json:"stock"`                                                                  // 库存
+	LimitPerUser int       `gorm:"column:limit_per_user;not null;default:1" json:"limitPerUser"`                                        // 每人限购数量
+	CreateTime   time.Time `gorm:"column:create_time;not null;default:CURRENT_TIMESTAMP" json:"createTime"`                             // 创建时间
+	BeginTime    time.Time `gorm:"column:begin_time;not null" json:"beginTime"`                                                         // 生效时间
+	EndTime      time.Time `gorm:"column:end_time;not null" json:"endTime"`                                                             // 失效时间
+	UpdateTime   time.Time `gorm:"column:update_time;not null;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP" json:"updateTime"` // 更新时间
 }
 
 // TableName 指定表名
@@ -25,6 +25,9 @@ type Shop struct {
 	Comments  int            `json:"comments"`
 	Score     int            `json:"score"`
 	OpenHours string         `gorm:"size:32" json:"openHours"`
+	// 评价汇总：评分数量与总分，用于增量计算 Score（贝叶斯平均 ×10）
+	RatingCount int `gorm:"not null;default:0" json:"-"`
+	RatingSum   int `gorm:"not null;default:0" json:"-"`
 }
 
 func (Shop) TableName() string {
@@ -6,6 +6,13 @@ import (
 	"gorm.io/gorm"
 )
 
+// 优惠券状态
+const (
+	VoucherStatusOnShelf     = 1 // 上架
+	VoucherStatusOffShelf    = 2 // 下架
+	VoucherStatusShopDeleted = 3 // 商铺已删除，恢复商铺时重新上架
+)
+
 // Voucher 优惠券模型
 // EN: Voucher entity model (type 0=normal, 1=seckill)
 type Voucher struct {
@@ -20,10 +27,12 @@ type Voucher struct {
 	PayValue    int64          `json:"payValue"`
 	ActualValue int64          `json:"actualValue"`
 	Type        int            `json:"type"`   // 0-普通券，1-秒杀券
-	Status      int            `json:"status"` // 1-上架，2-下架
+	Status      int            `json:"status"` // 1-上架，2-下架，3-商铺已删除
 	Stock       int            `json:"stock"`
 	BeginTime   *time.Time     `json:"beginTime"`
 	EndTime     *time.Time     `json:"endTime"`
+	// 每人限购数量：普通券使用，0 表示不限购（秒杀券见 SeckillVoucher.LimitPerUser）
+	LimitPerUser int `gorm:"not null;default:0" json:"limitPerUser"`
 }
 
 func (Voucher) TableName() string {
@@ -10,12 +10,13 @@ import (
 // EN: Voucher order model (voucherType: 1=normal, 2=seckill)
 type VoucherOrder struct {
 	ID         uint           `gorm:"primarykey" json:"id"`
-	OrderID    uint           `json:"orderId"`
+	OrderID    uint           `gorm:"uniqueIndex" json:"orderId"` // 全局唯一订单号，消费者按它保证幂等
 	CreatedAt  time.Time      `json:"createdAt"`
 	UpdatedAt  time.Time      `json:"updatedAt"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
 	UserID     uint           `json:"userId"`
 	VoucherID  uint           `json:"voucherId"`
+	Quantity   int            `gorm:"not null;default:1" json:"quantity"` // 购买数量
 	PayType    int            `json:"payType"`
 	Status     int            `json:"status"`
 	CreateTime *time.Time     `json:"createTime"`
@@ -27,6 +28,25 @@ type VoucherOrder struct {
 	VoucherType int `gorm:"index" json:"voucherType"`
 }
 
+// 订单状态：1-未支付，2-已支付，3-已核销，4-已取消，5-已退款
+// EN: Order status values (unpaid → paid → used / refunded, unpaid → cancelled)
+const (
+	OrderStatusUnpaid    = 1
+	OrderStatusPaid      = 2
+	OrderStatusUsed      = 3
+	OrderStatusCancelled = 4
+	OrderStatusRefunded  = 5
+)
+
 func (VoucherOrder) TableName() string {
 	return "tb_voucher_order"
 }
+
+// VoucherOrderDetail 订单列表项：订单 + 优惠券标题与所属商铺
+// EN: Order row joined with voucher title and shop for list APIs
+type VoucherOrderDetail struct {
+	VoucherOrder
+	VoucherTitle string `json:"voucherTitle"`
+	ShopID       uint   `json:"shopId"`
+	ShopName     string `json:"shopName"`
+}
@@ -44,9 +44,29 @@ func SetupRouter() *gin.Engine {
 			shopGroup.GET("/:id", handler.GetShopById)                                  // 通过商铺ID 获取商铺信息√
 			shopGroup.GET("/of/type", handler.GetShopByType)                            // 根据类型获取商铺√
 			shopGroup.GET("/of/name", handler.GetShopByName)                            // 根据名称搜索商铺√
+			shopGroup.GET("/search", handler.SearchShops)                               // 组合搜索商铺（关键词、过滤、排序）
+			shopGroup.GET("/nearby", handler.GetShopsNearLocation)                      // 查询用户坐标附近的商铺（游标分页）
 			shopGroup.POST("/createShop", handler.SaveShop)                             // 新增商铺√
 			shopGroup.PUT("/update", handler.UpdateShop)                                // 更新商铺√
 			shopGroup.GET("/:id/nearby", utils.JWTMiddleware(), handler.GetNearbyShops) // 获取某个商铺附近的商铺
+
+			// 商铺删除与恢复（商家/管理员）
+			shopManageGroup := shopGroup.Group("/:id", utils.JWTMiddleware(), utils.AdminMiddleware())
+			{
+				shopManageGroup.DELETE("", handler.DeleteShop)        // 删除商铺（软删除）
+				shopManageGroup.POST("/restore", handler.RestoreShop) // 恢复已删除的商铺
+			}
+		}
+
+		// 商铺评价相关路由
+		// EN: Shop review routes
+		reviewGroup := api.Group("/review")
+		{
+			reviewGroup.POST("", utils.JWTMiddleware(), handler.CreateReview)                      // 发布评价
+			reviewGroup.GET("/of/shop/:id", utils.OptionalJWTMiddleware(), handler.GetShopReviews) // 商铺评价列表（最新/最有用）
+			reviewGroup.PUT("/helpful/:id", utils.JWTMiddleware(), handler.ToggleReviewHelpful)    // 标记/取消“有用”
+			reviewGroup.PUT("/:id", utils.JWTMiddleware(), handler.UpdateReview)                   // 修改自己的评价
+			reviewGroup.DELETE("/:id", utils.JWTMiddleware(), handler.DeleteReview)                // 删除自己的评价
 		}
 
 		// 商铺类型相关路由
@@ -64,13 +84,29 @@ func SetupRouter() *gin.Engine {
 			voucherGroup.POST("", handler.AddVoucher)                   // 新增普通券
 			voucherGroup.POST("/seckill", handler.AddSeckillVoucher)    // 新增秒杀券√
 			voucherGroup.GET("/seckill/:id", handler.GetSeckillVoucher) // 获取秒杀券详情√
+
+			// 秒杀券管理（商家/管理员）
+			manageGroup := voucherGroup.Group("/seckill/:id", utils.JWTMiddleware(), utils.AdminMiddleware())
+			{
+				manageGroup.PUT("", handler.UpdateSeckillVoucher)           // 编辑秒杀券
+				manageGroup.DELETE("", handler.DeleteSeckillVoucher)        // 删除秒杀券
+				manageGroup.PUT("/status", handler.SetSeckillVoucherStatus) // 上架/下架
+				manageGroup.POST("/restock", handler.RestockSeckillVoucher) // 调整库存
+			}
 		}
 
 		// 优惠券订单相关路由
 		// EN: Voucher order routes
 		voucherOrderGroup := api.Group("/voucher-order")
 		{
-			voucherOrderGroup.POST("/seckill/:id", utils.JWTMiddleware(), handler.SeckillVoucher) // 秒杀优惠券√
+			voucherOrderGroup.POST("/seckill/:id", utils.JWTMiddleware(), handler.SeckillVoucher)         // 秒杀优惠券√
+			voucherOrderGroup.POST("/normal/:id", utils.JWTMiddleware(), handler.PurchaseVoucher)         // 购买普通券
+			voucherOrderGroup.GET("/of/me", utils.JWTMiddleware(), handler.ListMyVoucherOrders)           // 我的订单列表
+			voucherOrderGroup.GET("/:orderId", utils.JWTMiddleware(), handler.GetVoucherOrderStatus)      // 查询订单处理状态
+			voucherOrderGroup.POST("/:orderId/pay", utils.JWTMiddleware(), handler.PayVoucherOrder)       // 支付订单
+			voucherOrderGroup.POST("/:orderId/use", utils.JWTMiddleware(), handler.UseVoucherOrder)       // 核销订单
+			voucherOrderGroup.POST("/:orderId/refund", utils.JWTMiddleware(), handler.RefundVoucherOrder) // 订单退款
+			voucherOrderGroup.POST("/:orderId/cancel", utils.JWTMiddleware(), handler.CancelVoucherOrder) // 取消订单
 		}
 
 		// 博客相关路由
@@ -107,6 +143,45 @@ func SetupRouter() *gin.Engine {
 			statGroup.GET("/uv/summary", handler.GetUVSummary) // 获取UV统计摘要
 		}
 
+		// 管理后台路由（需登录且在 admin.user_ids 中）
+		// EN: Admin routes (login + admin.user_ids)
+		adminGroup := api.Group("/admin", utils.JWTMiddleware(), utils.AdminMiddleware())
+		{
+			streamGroup := adminGroup.Group("/stream")
+			{
+				streamGroup.GET("", handler.GetStreamInfo)                    // Stream/消费者组/死信概况
+				streamGroup.GET("/pending", handler.ListStreamPending)        // pending 消息明细
+				streamGroup.GET("/dlq", handler.ListDeadLetters)              // 死信消息列表
+				streamGroup.POST("/dlq/:id/replay", handler.ReplayDeadLetter) // 回放死信消息
+				streamGroup.POST("/trim", handler.TrimStream)                 // 裁剪 Stream/死信队列
+			}
+
+			adminGroup.GET("/voucher/:id/orders", handler.ListVoucherOrdersByVoucher) // 商家查看优惠券订单
+
+			shopTypeAdminGroup := adminGroup.Group("/shop-type")
+			{
+				shopTypeAdminGroup.POST("", handler.CreateShopType)       // 新增商铺类型
+				shopTypeAdminGroup.PUT("/sort", handler.ReorderShopTypes) // 调整商铺类型顺序
+				shopTypeAdminGroup.PUT("/:id", handler.UpdateShopType)    // 修改商铺类型
+				shopTypeAdminGroup.DELETE("/:id", handler.DeleteShopType) // 删除商铺类型
+			}
+
+			reconcileGroup := adminGroup.Group("/reconcile")
+			{
+				reconcileGroup.GET("/stock", handler.GetStockReconcileReport)    // 秒杀库存对账报告
+				reconcileGroup.POST("/stock/repair", handler.RepairSeckillStock) // 对账并修复秒杀库存
+			}
+
+			adminGroup.GET("/cache/stats", handler.GetCacheStats) // 缓存 L1/L2 命中统计
+			adminGroup.GET("/cache/hotkeys", handler.GetHotKeys)  // 热点商铺/博客 Top-N
+
+			bloomGroup := adminGroup.Group("/bloom")
+			{
+				bloomGroup.GET("", handler.GetBloomFilterStats)               // 布隆过滤器状态
+				bloomGroup.POST("/:name/rebuild", handler.RebuildBloomFilter) // 立即重建过滤器
+			}
+		}
+
 		pprofGroup := api.Group("/debug/pprof")
 		{
 			pprofGroup.GET("/", func(c *gin.Context) {
@@ -5,15 +5,44 @@ local voucherId = ARGV[1]
 local userId = ARGV[2]
 -- 1.3 订单id
 local orderId = ARGV[3]
+-- 1.4 订单Stream key，为空时不写入Stream（由上层投递到其他订单队列）
+local streamKey = ARGV[4]
+-- 1.5 购买数量
+local quantity = tonumber(ARGV[5]) or 1
+-- 1.6 订单处理状态保留时间（秒）
+local statusTTL = tonumber(ARGV[6]) or 600
 
 -- 2. 数据key
 -- 2.1 库存key
 local stockKey = "cache:seckill_voucher:stock:" .. voucherId
--- 2.2 订单key
-local orderKey = "cache:seckill_voucher:order:" .. voucherId
+-- 2.2 用户已购数量key（hash：userId -> 数量）
+local boughtKey = "cache:seckill_voucher:bought:" .. voucherId
+-- 2.3 秒杀券元数据key（hash：limit 每人限购，begin/end 秒杀开始/结束毫秒时间戳，status 上下架）
+local metaKey = "cache:seckill_voucher:meta:" .. voucherId
 
 
 -- 3. 脚本业务
+-- 3.0 元数据与库存同时写入、同时过期，元数据缺失或不完整时拒绝秒杀（等待缓存重建）
+local meta = redis.call('hmget', metaKey, 'limit', 'begin', 'end', 'status')
+local limit = tonumber(meta[1])
+local beginMs = tonumber(meta[2])
+local endMs = tonumber(meta[3])
+if (not limit or not beginMs or not endMs or not meta[4]) then
+    return 6
+end
+-- 判断是否已上架（1-上架，2-下架，3-商铺已删除）、是否在秒杀时间内（使用 Redis 服务器时间）
+if (meta[4] ~= '1') then
+    return 5
+end
+local now = redis.call('time')
+local nowMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+if (nowMs < beginMs) then
+    return 3
+end
+if (nowMs > endMs) then
+    return 4
+end
+
 -- 3.1 判断库存是否充足
 -- 获取库存，兼容 key 不存在的情况
 local stockVal = redis.call('get', stockKey)
@@ -28,22 +57,31 @@ if (not stock) then
     return 1
 end
 
-if (stock <= 0) then
+if (stock < quantity) then
     return 1
 end
--- 3.2 判断用户是否重复下单
-if(redis.call('sismember', orderKey, userId) == 1) then
+-- 3.2 判断用户是否超过限购数量
+local bought = tonumber(redis.call('hget', boughtKey, userId)) or 0
+if (bought + quantity > limit) then
     return 2
 end
 
 -- 3.3 扣减库存
-redis.call('incrby', stockKey, -1)
--- 3.4 下单（保存用户）
-redis.call('sadd', orderKey, userId)
--- 3.5 下单（保存用户）
--- 确保 orderId 不为 nil，若上层未提供则记录空字符串
+redis.call('incrby', stockKey, -quantity)
+-- 3.4 下单（累加用户已购数量）
+redis.call('hincrby', boughtKey, userId, quantity)
+-- 3.5 确保 orderId 不为 nil，若上层未提供则记录空字符串
 if not orderId then
     orderId = ""
 end
-redis.call('xadd', 'stream.orders', '*', 'userId', userId, 'voucherId', voucherId, 'orderId', orderId)
-return 0
\ No newline at end of file
+-- 3.6 记录订单处理状态，消费者创建订单后更新为 created/failed
+if orderId ~= "" then
+    local statusKey = "order:process:" .. orderId
+    redis.call('hset', statusKey, 'status', 'pending', 'userId', userId, 'reason', '')
+    redis.call('expire', statusKey, statusTTL)
+end
+-- 3.7 发送订单消息
+if streamKey and streamKey ~= "" then
+    redis.call('xadd', streamKey, '*', 'userId', userId, 'voucherId', voucherId, 'orderId', orderId, 'quantity', quantity)
+end
+return 0
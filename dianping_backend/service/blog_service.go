@@ -5,9 +5,9 @@ import (
 	"dianping/dao"
 	"dianping/models"
 	"dianping/utils"
+	"errors"
+	"log"
 	"strconv"
-
-	"gorm.io/gorm"
 )
 
 // CreateBlog 创建博客
@@ -53,6 +53,7 @@ func LikeBlog(ctx context.Context, userId, blogId uint) *utils.Result {
 			if err := dao.DecrementBlogLiked(ctx, blogId); err != nil {
 				return utils.ErrorResult("更新点赞数失败")
 			}
+			invalidateBlogCache(ctx, blogId)
 			// 删除数据库中的点赞记录
 			if err := dao.DeleteBlogLikeByUser(ctx, userId, blogId); err != nil {
 				return utils.ErrorResult("取消点赞失败")
@@ -62,6 +63,7 @@ func LikeBlog(ctx context.Context, userId, blogId uint) *utils.Result {
 		if err := dao.IncrementBlogLiked(ctx, blogId); err != nil {
 			return utils.ErrorResult("更新点赞数失败")
 		}
+		invalidateBlogCache(ctx, blogId)
 		// 保存用户 id 到 redis 集合
 		if err := dao.SaveLikedMember(ctx, dao.Redis, userId, blogId); err != nil {
 			return utils.ErrorResult("保存点赞失败")
@@ -94,13 +96,19 @@ func GetBlogList(ctx context.Context, page, size int) *utils.Result {
 
 // GetBlogById 根据ID获取博客
 func GetBlogById(ctx context.Context, id uint, userId uint) *utils.Result {
-	blog, err := dao.GetBlogByID(ctx, id)
+	blogHotKeys.Record(strconv.Itoa(int(id)))
+	blog, err := blogCache.Get(ctx, strconv.Itoa(int(id)), func(ctx context.Context) (*models.Blog, error) {
+		return dao.GetBlogByID(ctx, id)
+	})
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
+		if errors.Is(err, utils.ErrCacheNotFound) {
 			return utils.ErrorResult("博客不存在")
 		}
 		return utils.ErrorResult("查询失败")
 	}
+	// 并发请求可能共享同一个缓存对象，复制后再设置点赞状态
+	copied := *blog
+	blog = &copied
 
 	// 检查是否点赞
 	if err := isBlogLiked(ctx, blog, userId); err != nil {
@@ -241,3 +249,10 @@ func isBlogLiked(ctx context.Context, blog *models.Blog, userId uint) error {
 
 	return err
 }
+
+// invalidateBlogCache 点赞数变化后删除博客详情缓存
+func invalidateBlogCache(ctx context.Context, blogId uint) {
+	if err := blogCache.Delete(ctx, strconv.Itoa(int(blogId))); err != nil {
+		log.Printf("警告: 删除博客缓存失败, blogID=%d, 错误=%v", blogId, err)
+	}
+}
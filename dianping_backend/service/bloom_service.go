@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"dianping/config"
+	"dianping/dao"
+	"dianping/models"
+	"dianping/utils"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// 布隆过滤器维护配置
+// EN: Bloom filter maintenance configuration
+var (
+	defaultBloomRebuildInterval = 24 * time.Hour
+	bloomRebuildTimeout         = 5 * time.Minute
+	bloomWriteTimeout           = 3 * time.Second
+	bloomMaintainerOnce         sync.Once
+	bloomStopChan               = make(chan struct{})
+	bloomWg                     sync.WaitGroup
+)
+
+// bloomTables 过滤器对应的数据表
+var bloomTables = map[string]string{
+	"shop":    "tb_shop",
+	"user":    "tb_user",
+	"voucher": "tb_voucher",
+}
+
+// bloomModels 过滤器对应的模型，用于确认删除事件是否已提交
+var bloomModels = map[string]interface{}{
+	"shop":    &models.Shop{},
+	"user":    &models.User{},
+	"voucher": &models.Voucher{},
+}
+
+// bloomIDLoaders 重建过滤器时加载全量ID的函数
+var bloomIDLoaders = map[string]func(context.Context) ([]uint, error){
+	"shop": func(ctx context.Context) ([]uint, error) {
+		return dao.GetAllShopIDs(ctx, dao.DB)
+	},
+	"user": func(context.Context) ([]uint, error) {
+		return dao.GetAllUserIDs()
+	},
+	"voucher": func(context.Context) ([]uint, error) {
+		return dao.GetAllVoucherIDs()
+	},
+}
+
+// ConfigureBloomFilters 按配置选择过滤器存储后端（auto 时探测 Redis 是否加载了 RedisBloom 模块，
+// 没有时退化为普通 Redis 位图），并设置商铺、优惠券过滤器的类型；需要在初始化过滤器之前调用
+// EN: Pick the bloom backend (RedisBloom or plain-Redis bitmap fallback) and filter type
+func ConfigureBloomFilters(ctx context.Context) {
+	backend, filterType := utils.BloomBackendAuto, utils.BloomTypeBloom
+	if cfg := config.GetConfig(); cfg != nil {
+		if cfg.Bloom.Backend != "" {
+			backend = cfg.Bloom.Backend
+		}
+		if cfg.Bloom.Type != "" {
+			filterType = cfg.Bloom.Type
+		}
+	}
+
+	switch backend {
+	case utils.BloomBackendRedisBloom, utils.BloomBackendBitmap, utils.BloomBackendMemory:
+	default:
+		detected, err := utils.DetectBloomBackend(ctx, dao.Redis)
+		if err != nil {
+			log.Printf("探测 RedisBloom 模块失败，使用 bitmap 后端: %v", err)
+			detected = utils.BloomBackendBitmap
+		}
+		backend = detected
+	}
+	utils.SetBloomBackend(backend)
+	utils.SetDeletableBloomType(filterType)
+
+	if filterType == utils.BloomTypeCuckoo && backend != utils.BloomBackendRedisBloom {
+		log.Printf("警告: %s 后端不支持布谷鸟过滤器，使用布隆过滤器", backend)
+	}
+	log.Printf("布隆过滤器后端: %s", backend)
+}
+
+// bloomRebuildInterval 获取全量重建周期，小于0表示关闭定时重建
+func bloomRebuildInterval() time.Duration {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Bloom.RebuildInterval != 0 {
+		return time.Duration(cfg.Bloom.RebuildInterval) * time.Second
+	}
+	return defaultBloomRebuildInterval
+}
+
+// StartBloomMaintainer 订阅商铺、用户、优惠券的新增与删除，实时更新过滤器（布隆过滤器只记录待清理数量），
+// 并定期从数据库全量重建，清理已删除的ID、按当前数据量重新分配容量
+// EN: Keep bloom filters in sync with row changes and rebuild them on a schedule
+func StartBloomMaintainer() {
+	bloomMaintainerOnce.Do(func() {
+		for name, table := range bloomTables {
+			dao.OnTableChange(table, onBloomTableChange(name))
+		}
+
+		interval := bloomRebuildInterval()
+		if interval < 0 {
+			log.Println("布隆过滤器定时重建已关闭")
+			return
+		}
+		bloomWg.Add(1)
+		go bloomRebuildLoop(interval)
+		log.Printf("布隆过滤器定时重建任务已启动，周期: %v", interval)
+	})
+}
+
+// StopBloomMaintainer 停止定时重建任务（用于优雅关闭）
+func StopBloomMaintainer() {
+	close(bloomStopChan)
+	bloomWg.Wait()
+	log.Println("布隆过滤器定时重建任务已停止")
+}
+
+// onBloomTableChange 在 GORM 回调中调用，Redis 操作放到协程里：新增行立即加入过滤器（事务回滚只会多一个误判）；
+// 删除事件在事务提交前触发，可能随事务回滚，延迟双删的间隔后重新查库，只移除确认已删除的行
+func onBloomTableChange(name string) dao.ChangeListener {
+	return func(event dao.ChangeEvent) {
+		if event.Op == dao.ChangeOpUpdate || len(event.IDs) == 0 {
+			return
+		}
+		if event.Op == dao.ChangeOpCreate {
+			go applyBloomChange(name, event)
+			return
+		}
+		time.AfterFunc(doubleDeleteDelay(), func() {
+			removeDeletedFromBloom(name, event)
+		})
+	}
+}
+
+// removeDeletedFromBloom 重新查库，把仍然存在的行（删除已回滚或尚未提交）留在过滤器中，
+// 多留的ID只会造成误判，下次重建时清理
+func removeDeletedFromBloom(name string, event dao.ChangeEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), bloomWriteTimeout)
+	defer cancel()
+
+	existing, err := dao.GetExistingIDs(ctx, dao.DB, bloomModels[name], event.IDs)
+	if err != nil {
+		log.Printf("确认%s删除失败，暂不更新过滤器: ids=%v, err=%v", name, event.IDs, err)
+		return
+	}
+	kept := make(map[uint]bool, len(existing))
+	for _, id := range existing {
+		kept[id] = true
+	}
+	deleted := make([]uint, 0, len(event.IDs))
+	for _, id := range event.IDs {
+		if !kept[id] {
+			deleted = append(deleted, id)
+		}
+	}
+	if len(deleted) == 0 {
+		return
+	}
+	applyBloomChange(name, dao.ChangeEvent{Table: event.Table, Op: event.Op, IDs: deleted})
+}
+
+// applyBloomChange 将一个变更事件同步到过滤器，失败只记录日志（下次重建时修正）
+func applyBloomChange(name string, event dao.ChangeEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), bloomWriteTimeout)
+	defer cancel()
+
+	cfg, err := utils.BloomConfigByName(name)
+	if err != nil {
+		return
+	}
+	bf := utils.NewBloomFilter(dao.Redis, cfg)
+	for _, id := range event.IDs {
+		if event.Op == dao.ChangeOpCreate {
+			if _, err := bf.AddID(ctx, id); err != nil {
+				log.Printf("添加ID到%s过滤器失败: id=%d, err=%v", name, id, err)
+			}
+			continue
+		}
+		if _, err := bf.RemoveID(ctx, id); err != nil && !errors.Is(err, utils.ErrBloomDeleteUnsupported) {
+			log.Printf("从%s过滤器删除ID失败: id=%d, err=%v", name, id, err)
+		}
+	}
+}
+
+// bloomRebuildLoop 定时重建循环
+func bloomRebuildLoop(interval time.Duration) {
+	defer bloomWg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bloomStopChan:
+			return
+		case <-ticker.C:
+			rebuildBloomFilters(interval)
+		}
+	}
+}
+
+// rebuildBloomFilters 重建所有过滤器；多实例部署时，最近半个周期内已被其他实例重建过的跳过
+func rebuildBloomFilters(interval time.Duration) {
+	for _, name := range []string{"shop", "user", "voucher"} {
+		ctx, cancel := context.WithTimeout(context.Background(), bloomRebuildTimeout)
+		cfg, _ := utils.BloomConfigByName(name)
+		last, err := utils.NewBloomFilter(dao.Redis, cfg).LastRebuildAt(ctx)
+		if err == nil && time.Since(last) < interval/2 {
+			cancel()
+			continue
+		}
+
+		result, err := rebuildBloomFilter(ctx, name)
+		cancel()
+		if errors.Is(err, utils.ErrBloomRebuilding) {
+			continue
+		}
+		if err != nil {
+			log.Printf("重建%s过滤器失败: %v", name, err)
+			continue
+		}
+		log.Printf("重建%s过滤器完成: 数据量=%d, 容量=%d, 耗时=%s", name, result.Items, result.Capacity, result.Duration)
+	}
+}
+
+// rebuildBloomFilter 从数据库全量重建指定过滤器并原子替换
+func rebuildBloomFilter(ctx context.Context, name string) (*utils.BloomRebuildResult, error) {
+	cfg, err := utils.BloomConfigByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewBloomFilter(dao.Redis, cfg).Rebuild(ctx, bloomIDLoaders[name])
+}
+
+// GetBloomFilterStats 查看各过滤器的状态、容量与重建信息
+// EN: Bloom filter stats from CheckBloomFilterHealth
+func GetBloomFilterStats(ctx context.Context) *utils.Result {
+	health := utils.NewBloomInitializer(dao.Redis, dao.DB).CheckBloomFilterHealth(ctx)
+	return utils.SuccessResultWithData(health)
+}
+
+// RebuildBloomFilter 立即重建指定过滤器（shop、user、voucher）
+// EN: Rebuild one filter now and swap it in
+func RebuildBloomFilter(ctx context.Context, name string) *utils.Result {
+	result, err := rebuildBloomFilter(ctx, name)
+	if errors.Is(err, utils.ErrBloomRebuilding) {
+		return utils.ErrorResult("过滤器正在重建中，请稍后再试")
+	}
+	if err != nil {
+		return utils.ErrorResult("重建过滤器失败: " + err.Error())
+	}
+	return utils.SuccessResultWithData(result)
+}
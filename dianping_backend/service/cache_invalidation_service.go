@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"dianping/config"
+	"dianping/dao"
+	"dianping/utils"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 缓存失效相关配置
+// EN: Cache invalidation worker configuration
+var (
+	defaultDoubleDeleteDelay = time.Second
+	invalidateQueueSize      = 1024
+	invalidateRetryInterval  = time.Second
+	invalidateRetryBatch     = 100
+	invalidateMaxBackoff     = time.Minute
+	invalidateTimeout        = 3 * time.Second
+
+	invalidateQueue    = make(chan dao.ChangeEvent, invalidateQueueSize)
+	invalidatorOnce    sync.Once
+	invalidateStopChan = make(chan struct{})
+	invalidatorWg      sync.WaitGroup
+)
+
+// StartCacheInvalidator 订阅 tb_shop、tb_shop_type、tb_voucher 的数据变更，由后台任务删除相关缓存：
+// 变更后立即删除一次，延迟一段时间再删除一次（覆盖事务提交前被并发读回填的旧值），
+// 删除失败的 key 持久化到 tb_cache_invalidation 并按指数退避重试
+// EN: Apply cache invalidations from dao change events with delayed double delete and a persisted retry list
+func StartCacheInvalidator() {
+	invalidatorOnce.Do(func() {
+		for _, table := range []string{"tb_shop", "tb_shop_type", "tb_voucher"} {
+			dao.OnTableChange(table, enqueueInvalidation)
+		}
+		invalidatorWg.Add(2)
+		go invalidateLoop()
+		go invalidateRetryLoop()
+		log.Printf("缓存失效任务已启动，延迟双删间隔: %v", doubleDeleteDelay())
+	})
+}
+
+// StopCacheInvalidator 停止缓存失效任务（用于优雅关闭）
+func StopCacheInvalidator() {
+	close(invalidateStopChan)
+	invalidatorWg.Wait()
+	log.Println("缓存失效任务已停止")
+}
+
+// doubleDeleteDelay 获取延迟双删的间隔
+func doubleDeleteDelay() time.Duration {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Cache.DoubleDeleteDelay > 0 {
+		return time.Duration(cfg.Cache.DoubleDeleteDelay) * time.Millisecond
+	}
+	return defaultDoubleDeleteDelay
+}
+
+// enqueueInvalidation 在 GORM 回调中调用，不能阻塞写操作；队列满时另起协程处理
+func enqueueInvalidation(event dao.ChangeEvent) {
+	select {
+	case invalidateQueue <- event:
+	default:
+		log.Printf("警告: 缓存失效队列已满, table=%s", event.Table)
+		go applyInvalidation(event)
+	}
+}
+
+// invalidateLoop 消费变更事件：立即删除缓存，并安排延迟二次删除
+func invalidateLoop() {
+	defer invalidatorWg.Done()
+
+	delay := doubleDeleteDelay()
+	for {
+		select {
+		case <-invalidateStopChan:
+			return
+		case event := <-invalidateQueue:
+			applyInvalidation(event)
+			time.AfterFunc(delay, func() {
+				// 延迟删除时重新解析 key：事务提交后才能查到新建的行
+				applyInvalidation(event)
+			})
+		}
+	}
+}
+
+// applyInvalidation 删除一个变更事件对应的缓存
+func applyInvalidation(event dao.ChangeEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), invalidateTimeout)
+	defer cancel()
+
+	keys, err := invalidationKeys(ctx, event)
+	if err != nil {
+		log.Printf("解析缓存失效 key 失败: table=%s, ids=%v, err=%v", event.Table, event.IDs, err)
+		return
+	}
+	for _, key := range keys {
+		if err := utils.DeleteCacheKeys(ctx, dao.Redis, key); err != nil {
+			persistInvalidation(ctx, key, err)
+		}
+	}
+}
+
+// invalidationKeys 根据变更的表、操作和主键计算需要删除的缓存 key
+func invalidationKeys(ctx context.Context, event dao.ChangeEvent) ([]string, error) {
+	var keys []string
+	switch event.Table {
+	case "tb_shop":
+		for _, id := range event.IDs {
+			keys = append(keys, shopCache.Key(strconv.Itoa(int(id))))
+		}
+	case "tb_shop_type":
+		keys = append(keys, shopTypeCache.Key(""))
+		// 删除类型时一并删除该类型的商铺 GEO key
+		if event.Op == dao.ChangeOpDelete {
+			for _, id := range event.IDs {
+				keys = append(keys, dao.ShopLocationCache+strconv.Itoa(int(id)))
+			}
+		}
+	case "tb_voucher":
+		if len(event.IDs) == 0 {
+			return nil, nil
+		}
+		shopIDs, err := dao.GetVoucherShopIDs(ctx, dao.DB, event.IDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, shopID := range shopIDs {
+			keys = append(keys, voucherListCache.Key(strconv.Itoa(int(shopID))))
+		}
+	}
+	return keys, nil
+}
+
+// persistInvalidation 删除失败时记录到重试表
+func persistInvalidation(ctx context.Context, key string, cause error) {
+	log.Printf("删除缓存失败，稍后重试: key=%s, err=%v", key, cause)
+	if err := dao.CreateCacheInvalidation(ctx, dao.DB, key, cause.Error(), time.Now().Add(invalidateRetryInterval)); err != nil {
+		log.Printf("警告: 记录缓存失效重试任务失败, key=%s, err=%v", key, err)
+	}
+}
+
+// invalidateRetryLoop 定期重试删除失败的缓存 key
+func invalidateRetryLoop() {
+	defer invalidatorWg.Done()
+
+	ticker := time.NewTicker(invalidateRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-invalidateStopChan:
+			return
+		case <-ticker.C:
+			retryInvalidations()
+		}
+	}
+}
+
+// retryInvalidations 处理一批到期的重试任务，成功后删除记录，失败时按指数退避推迟
+func retryInvalidations() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	items, err := dao.GetDueCacheInvalidations(ctx, dao.DB, invalidateRetryBatch)
+	if err != nil {
+		log.Printf("查询缓存失效重试任务失败: %v", err)
+		return
+	}
+	for _, item := range items {
+		if err := utils.DeleteCacheKeys(ctx, dao.Redis, item.CacheKey); err != nil {
+			attempts := item.Attempts + 1
+			next := time.Now().Add(invalidateBackoff(attempts))
+			if err := dao.UpdateCacheInvalidationRetry(ctx, dao.DB, item.ID, attempts, next, err.Error()); err != nil {
+				log.Printf("更新缓存失效重试任务失败: id=%d, err=%v", item.ID, err)
+			}
+			continue
+		}
+		if err := dao.DeleteCacheInvalidation(ctx, dao.DB, item.ID); err != nil {
+			log.Printf("删除缓存失效重试任务失败: id=%d, err=%v", item.ID, err)
+		}
+	}
+}
+
+// invalidateBackoff 第 attempts 次失败后的重试间隔：1s、2s、4s ... 最长 1 分钟
+func invalidateBackoff(attempts int) time.Duration {
+	d := invalidateRetryInterval
+	for i := 1; i < attempts && d < invalidateMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > invalidateMaxBackoff {
+		d = invalidateMaxBackoff
+	}
+	return d
+}
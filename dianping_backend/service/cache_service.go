@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"dianping/config"
+	"dianping/dao"
+	"dianping/models"
+	"dianping/utils"
+	"time"
+)
+
+// L1 本地缓存默认配置
+// EN: Default in-process L1 cache settings
+const (
+	defaultLocalCacheSize = 1000
+	defaultLocalCacheTTL  = 10 * time.Second
+)
+
+// 各业务的缓存客户端，在 Redis 初始化后由 InitCacheClients 创建
+// EN: Typed cache clients per read path, created after Redis is initialized
+var (
+	// shopCache 商铺详情：进程内 L1 + Redis 逻辑过期，热点商铺过期后返回旧值并异步重建
+	shopCache *utils.CacheClient[*models.Shop]
+	// shopTypeCache 商铺类型列表：互斥锁重建
+	shopTypeCache *utils.CacheClient[[]*models.ShopType]
+	// voucherListCache 商铺优惠券列表：空值缓存，库存展示允许短暂延迟
+	voucherListCache *utils.CacheClient[[]models.Voucher]
+	// blogCache 博客详情：空值缓存，防止不存在的ID穿透到数据库
+	blogCache *utils.CacheClient[*models.Blog]
+)
+
+// InitCacheClients 初始化缓存客户端
+func InitCacheClients() {
+	shopCache = utils.NewCacheClient[*models.Shop](dao.Redis, dao.ShopCache, utils.CacheOptions{
+		TTL:       25 * time.Minute,
+		Jitter:    10 * time.Minute,
+		LocalSize: localCacheSize(),
+		LocalTTL:  localCacheTTL(),
+	})
+	shopTypeCache = utils.NewCacheClient[[]*models.ShopType](dao.Redis, dao.ShopTypeCache, utils.CacheOptions{
+		TTL:     time.Hour,
+		MaxWait: time.Second,
+	})
+	voucherListCache = utils.NewCacheClient[[]models.Voucher](dao.Redis, dao.VoucherListCache, utils.CacheOptions{
+		TTL:    2 * time.Minute,
+		Jitter: 30 * time.Second,
+	})
+	blogCache = utils.NewCacheClient[*models.Blog](dao.Redis, dao.BlogCache, utils.CacheOptions{
+		TTL:    30 * time.Minute,
+		Jitter: 5 * time.Minute,
+	})
+	initHotKeyDetectors()
+}
+
+// StopCacheClients 停止缓存失效通知订阅（用于优雅关闭）
+func StopCacheClients() {
+	shopCache.Close()
+}
+
+// GetCacheStats 获取各缓存的 L1/L2 命中统计
+// EN: Per-level hit/miss metrics of every cache client
+func GetCacheStats(ctx context.Context) *utils.Result {
+	return utils.SuccessResultWithData(map[string]utils.CacheStats{
+		"shop":        shopCache.Stats(),
+		"shopType":    shopTypeCache.Stats(),
+		"voucherList": voucherListCache.Stats(),
+		"blog":        blogCache.Stats(),
+	})
+}
+
+// localCacheSize 获取 L1 缓存容量，小于0表示关闭
+func localCacheSize() int {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Cache.LocalSize != 0 {
+		return cfg.Cache.LocalSize
+	}
+	return defaultLocalCacheSize
+}
+
+// localCacheTTL 获取 L1 缓存存活时间
+func localCacheTTL() time.Duration {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Cache.LocalTTL > 0 {
+		return time.Duration(cfg.Cache.LocalTTL) * time.Second
+	}
+	return defaultLocalCacheTTL
+}
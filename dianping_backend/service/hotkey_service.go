@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"dianping/config"
+	"dianping/dao"
+	"dianping/models"
+	"dianping/utils"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 热点 key 探测与缓存预热配置
+// EN: Hot-key detection and cache pre-warming configuration
+var (
+	hotKeyWindow             = time.Minute
+	hotKeyBuckets            = 6
+	defaultHotKeySampleRate  = 0.1
+	defaultHotKeyTopN        = 20
+	defaultPrewarmInterval   = time.Minute
+	prewarmOnce              sync.Once
+	prewarmStopChan          = make(chan struct{})
+	prewarmWg                sync.WaitGroup
+	shopHotKeys, blogHotKeys *utils.HotKeyDetector
+)
+
+// initHotKeyDetectors 创建商铺、博客读路径上的热点探测器
+func initHotKeyDetectors() {
+	rate := hotKeySampleRate()
+	shopHotKeys = utils.NewHotKeyDetector(hotKeyWindow, hotKeyBuckets, rate)
+	blogHotKeys = utils.NewHotKeyDetector(hotKeyWindow, hotKeyBuckets, rate)
+}
+
+// hotKeySampleRate 获取热点统计采样率
+func hotKeySampleRate() float64 {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Cache.HotKeySampleRate > 0 && cfg.Cache.HotKeySampleRate <= 1 {
+		return cfg.Cache.HotKeySampleRate
+	}
+	return defaultHotKeySampleRate
+}
+
+// hotKeyTopN 获取需要预热的热点数量
+func hotKeyTopN() int {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Cache.HotKeyTopN > 0 {
+		return cfg.Cache.HotKeyTopN
+	}
+	return defaultHotKeyTopN
+}
+
+// prewarmInterval 获取预热周期，小于0表示关闭定时预热
+func prewarmInterval() time.Duration {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Cache.PrewarmInterval != 0 {
+		return time.Duration(cfg.Cache.PrewarmInterval) * time.Second
+	}
+	return defaultPrewarmInterval
+}
+
+// StartCachePrewarmer 启动时按上次保存的热点排行预热缓存，之后定期统计热点并在缓存过期前提前重建
+// EN: Warm hot shops/blogs at startup and keep them fresh ahead of expiration
+func StartCachePrewarmer() {
+	prewarmOnce.Do(func() {
+		interval := prewarmInterval()
+		if interval < 0 {
+			log.Println("热点缓存预热已关闭")
+			return
+		}
+		prewarmWg.Add(1)
+		go prewarmLoop(interval)
+		log.Printf("热点缓存预热任务已启动，周期: %v", interval)
+	})
+}
+
+// StopCachePrewarmer 停止预热任务（用于优雅关闭）
+func StopCachePrewarmer() {
+	close(prewarmStopChan)
+	prewarmWg.Wait()
+	log.Println("热点缓存预热任务已停止")
+}
+
+// prewarmLoop 预热循环
+func prewarmLoop(interval time.Duration) {
+	defer prewarmWg.Done()
+
+	// 启动预热：进程内还没有统计数据，使用上次保存的排行
+	prewarmFromRanking(context.Background(), interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-prewarmStopChan:
+			return
+		case <-ticker.C:
+			prewarmHotKeys(context.Background(), interval)
+		}
+	}
+}
+
+// prewarmFromRanking 按 Redis 中保存的热点排行预热
+func prewarmFromRanking(ctx context.Context, interval time.Duration) {
+	n := hotKeyTopN()
+	shopKeys, err := dao.GetHotKeyRanking(ctx, dao.Redis, "shop", n)
+	if err != nil {
+		log.Printf("读取商铺热点排行失败: %v", err)
+	}
+	blogKeys, err := dao.GetHotKeyRanking(ctx, dao.Redis, "blog", n)
+	if err != nil {
+		log.Printf("读取博客热点排行失败: %v", err)
+	}
+	warmed := prewarmShops(ctx, shopKeys, interval) + prewarmBlogs(ctx, blogKeys, interval)
+	log.Printf("启动预热完成: 商铺 %d 个，博客 %d 个，重建 %d 个缓存", len(shopKeys), len(blogKeys), warmed)
+}
+
+// prewarmHotKeys 统计当前窗口的热点，保存排行并预热
+func prewarmHotKeys(ctx context.Context, interval time.Duration) {
+	n := hotKeyTopN()
+	shopKeys := saveHotKeyRanking(ctx, "shop", shopHotKeys.TopN(n))
+	blogKeys := saveHotKeyRanking(ctx, "blog", blogHotKeys.TopN(n))
+	if warmed := prewarmShops(ctx, shopKeys, interval) + prewarmBlogs(ctx, blogKeys, interval); warmed > 0 {
+		log.Printf("热点缓存预热: 重建 %d 个缓存", warmed)
+	}
+}
+
+// saveHotKeyRanking 保存热点排行，返回热点 key 列表
+func saveHotKeyRanking(ctx context.Context, name string, hot []utils.HotKey) []string {
+	keys := make([]string, 0, len(hot))
+	counts := make(map[string]int64, len(hot))
+	for _, h := range hot {
+		keys = append(keys, h.Key)
+		counts[h.Key] = h.Count
+	}
+	if err := dao.SaveHotKeyRanking(ctx, dao.Redis, name, counts); err != nil {
+		log.Printf("保存%s热点排行失败: %v", name, err)
+	}
+	return keys
+}
+
+// prewarmShops 对热点商铺提前重建逻辑过期缓存（在下一轮预热之前会过期的都重建）
+func prewarmShops(ctx context.Context, keys []string, interval time.Duration) int {
+	warmed := 0
+	for _, key := range keys {
+		id, err := strconv.ParseUint(key, 10, 32)
+		if err != nil {
+			continue
+		}
+		ok, err := shopCache.PrewarmLogical(ctx, key, func(ctx context.Context) (*models.Shop, error) {
+			return dao.GetShopById(ctx, dao.DB, uint(id))
+		}, 2*interval)
+		if err != nil {
+			log.Printf("预热商铺缓存失败: shopID=%d, err=%v", id, err)
+		}
+		if ok {
+			warmed++
+		}
+	}
+	return warmed
+}
+
+// prewarmBlogs 对热点博客提前刷新缓存
+func prewarmBlogs(ctx context.Context, keys []string, interval time.Duration) int {
+	warmed := 0
+	for _, key := range keys {
+		id, err := strconv.ParseUint(key, 10, 32)
+		if err != nil {
+			continue
+		}
+		ok, err := blogCache.Prewarm(ctx, key, func(ctx context.Context) (*models.Blog, error) {
+			return dao.GetBlogByID(ctx, uint(id))
+		}, 2*interval)
+		if err != nil {
+			log.Printf("预热博客缓存失败: blogID=%d, err=%v", id, err)
+		}
+		if ok {
+			warmed++
+		}
+	}
+	return warmed
+}
+
+// GetHotKeys 获取本实例最近一分钟的热点商铺与博客
+// EN: Top-N hot shop and blog IDs seen by this instance in the sliding window
+func GetHotKeys(ctx context.Context, n int) *utils.Result {
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"window": hotKeyWindow.String(),
+		"shop":   shopHotKeys.TopN(n),
+		"blog":   blogHotKeys.TopN(n),
+	})
+}
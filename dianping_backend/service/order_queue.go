@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"dianping/config"
+	"dianping/dao"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// OrderMessage 订单队列中的消息
+// EN: Order message carried by an OrderQueue
+type OrderMessage struct {
+	ID        string `json:"-"` // 队列内的消息ID（Stream ID / 内存队列序号）
+	UserID    string `json:"userId"`
+	VoucherID string `json:"voucherId"`
+	OrderID   string `json:"id"`
+	Quantity  string `json:"quantity"`
+}
+
+// PendingOrder 已投递但尚未处理完成的消息
+type PendingOrder struct {
+	ID         string `json:"id"`
+	Consumer   string `json:"consumer"`
+	IdleMs     int64  `json:"idleMs"`
+	Deliveries int64  `json:"deliveries"`
+}
+
+// DeadLetter 死信消息，Values 为原消息字段及失败原因（reason）、失败时间（failedAt）
+type DeadLetter struct {
+	ID     string                 `json:"id"`
+	Values map[string]interface{} `json:"values"`
+}
+
+// OrderHandler 订单消息处理函数，返回 permanent 错误时不再重试
+type OrderHandler func(ctx context.Context, msg *OrderMessage) error
+
+// OrderQueue 秒杀订单队列：秒杀入口投递消息，消费者异步创建订单
+// EN: Pluggable order pipeline backend
+type OrderQueue interface {
+	// Name 后端名称
+	Name() string
+	// StreamKey seckill.lua 需要原子 XADD 的 Stream；返回空字符串时由调用方使用 Publish 投递
+	StreamKey() string
+	// Publish 投递订单消息
+	Publish(ctx context.Context, msg *OrderMessage) error
+	// InFlight 统计各优惠券已预扣库存但订单尚未创建的数量（voucherID → 件数），用于库存对账
+	InFlight(ctx context.Context) (map[uint]int, error)
+	// InFlightByUser 按优惠券和用户统计在途件数（voucherID → userID → 件数），用于核对用户已购数量
+	InFlightByUser(ctx context.Context) (map[uint]map[uint]int, error)
+	// Stats 队列运行状态（积压、pending、死信数量等），供管理接口查看
+	Stats(ctx context.Context) (map[string]interface{}, error)
+	// Pending 已投递但尚未处理完成的消息，consumer 为空时不过滤
+	Pending(ctx context.Context, consumer string, count int64) ([]PendingOrder, error)
+	// DeadLetters 最近的死信消息（新的在前）
+	DeadLetters(ctx context.Context, count int64) ([]DeadLetter, error)
+	// GetDeadLetter 读取一条死信中的订单消息，不存在时返回 (nil, nil)
+	GetDeadLetter(ctx context.Context, id string) (*OrderMessage, error)
+	// RemoveDeadLetter 删除一条死信
+	RemoveDeadLetter(ctx context.Context, id string) error
+	// TrimDeadLetters 死信按最大条数裁剪，返回删除的条数
+	TrimDeadLetters(ctx context.Context, maxLen int64) (int64, error)
+	// Start 启动消费者
+	Start(handler OrderHandler) error
+	// Stop 停止消费者（用于优雅关闭）
+	Stop()
+}
+
+// orderQueue 当前使用的订单队列，默认 Redis Stream
+var orderQueue OrderQueue = &redisStreamQueue{}
+
+// InitOrderQueue 按配置选择订单队列后端并启动消费者
+// EN: Select the backend from stream.backend ("redis" | "memory") and start consuming
+func InitOrderQueue() error {
+	backend := "redis"
+	if cfg := config.GetConfig(); cfg != nil && cfg.Stream.Backend != "" {
+		backend = cfg.Stream.Backend
+	}
+
+	switch backend {
+	case "redis":
+		orderQueue = &redisStreamQueue{}
+	case "memory":
+		orderQueue = NewMemoryOrderQueue(memoryQueueSize, consumerCount)
+	default:
+		return fmt.Errorf("不支持的订单队列类型: %s", backend)
+	}
+
+	log.Printf("订单队列后端: %s", orderQueue.Name())
+	return orderQueue.Start(handleOrderMessage)
+}
+
+// StopOrderQueue 停止订单队列消费者
+func StopOrderQueue() {
+	orderQueue.Stop()
+}
+
+// handleOrderMessage 解析消息中的ID并创建订单
+func handleOrderMessage(ctx context.Context, msg *OrderMessage) error {
+	// 转换字符串ID为uint
+	userID, err := strconv.ParseUint(msg.UserID, 10, 32)
+	if err != nil {
+		return permanent(fmt.Errorf("解析用户ID失败: %v", err))
+	}
+
+	voucherID, err := strconv.ParseUint(msg.VoucherID, 10, 32)
+	if err != nil {
+		return permanent(fmt.Errorf("解析优惠券ID失败: %v", err))
+	}
+
+	quantity, err := msg.quantity()
+	if err != nil {
+		return permanent(err)
+	}
+
+	// 处理订单
+	if err := processStreamOrder(ctx, uint(userID), uint(voucherID), msg.OrderID, quantity); err != nil {
+		return err
+	}
+	setOrderProcessStatus(ctx, msg, OrderProcessCreated, "")
+	return nil
+}
+
+// failOrderMessage 消息最终处理失败：记录失败状态供客户端查询，并归还预扣的库存与下单名额
+func failOrderMessage(ctx context.Context, msg *OrderMessage, reason string) {
+	setOrderProcessStatus(ctx, msg, OrderProcessFailed, reason)
+	compensateOrderMessage(ctx, msg)
+}
+
+// setOrderProcessStatus 写入订单处理状态（失败只记录日志）
+func setOrderProcessStatus(ctx context.Context, msg *OrderMessage, status, reason string) {
+	if msg.OrderID == "" {
+		return
+	}
+	if err := dao.SetOrderProcessStatus(ctx, dao.Redis, msg.OrderID, msg.UserID, status, reason); err != nil {
+		log.Printf("警告: 写入订单处理状态失败, orderID=%s, 错误=%v", msg.OrderID, err)
+	}
+}
+
+// compensateOrderMessage 消息最终处理失败（订单未创建）时，归还 Lua 脚本预扣的 Redis 库存与下单名额
+func compensateOrderMessage(ctx context.Context, msg *OrderMessage) {
+	userID, uerr := strconv.ParseUint(msg.UserID, 10, 32)
+	voucherID, verr := strconv.ParseUint(msg.VoucherID, 10, 32)
+	quantity, qerr := msg.quantity()
+	if uerr != nil || verr != nil || qerr != nil {
+		return
+	}
+	releaseSeckillCache(ctx, uint(voucherID), uint(userID), quantity)
+}
+
+// voucherQuantity 解析消息中的优惠券ID与购买数量
+func (m *OrderMessage) voucherQuantity() (uint, int, error) {
+	voucherID, err := strconv.ParseUint(m.VoucherID, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("解析优惠券ID失败: %v", err)
+	}
+	quantity, err := m.quantity()
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint(voucherID), quantity, nil
+}
+
+// groupInFlightByUser 按优惠券和用户汇总在途消息的件数，无法解析的消息跳过
+func groupInFlightByUser(msgs []*OrderMessage) map[uint]map[uint]int {
+	result := make(map[uint]map[uint]int)
+	for _, msg := range msgs {
+		userID, voucherID, quantity, err := msg.userVoucherQuantity()
+		if err != nil {
+			continue
+		}
+		if result[voucherID] == nil {
+			result[voucherID] = make(map[uint]int)
+		}
+		result[voucherID][userID] += quantity
+	}
+	return result
+}
+
+// userVoucherQuantity 解析消息中的用户ID、优惠券ID与购买数量
+func (m *OrderMessage) userVoucherQuantity() (uint, uint, int, error) {
+	userID, err := strconv.ParseUint(m.UserID, 10, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("解析用户ID失败: %v", err)
+	}
+	voucherID, quantity, err := m.voucherQuantity()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return uint(userID), voucherID, quantity, nil
+}
+
+// quantity 解析购买数量，旧消息没有该字段时按1件处理
+func (m *OrderMessage) quantity() (int, error) {
+	if m.Quantity == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(m.Quantity)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("无效的购买数量: %s", m.Quantity)
+	}
+	return n, nil
+}
+
+// orderMaxRetry 单条消息最大投递次数
+func orderMaxRetry() int64 {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Stream.MaxRetry > 0 {
+		return int64(cfg.Stream.MaxRetry)
+	}
+	return 5
+}
+
+// permanentError 不可重试的错误（消息格式错误、数据库库存不足等），直接进入死信队列
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent 将错误标记为不可重试
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// memoryQueueSize 内存队列默认容量
+const memoryQueueSize = 1024
+
+// memoryDeadLetterLimit 内存死信最多保留条数
+const memoryDeadLetterLimit = 1000
+
+// memoryOrderQueue 进程内 channel 实现的订单队列，用于单机开发和测试，进程退出时未处理的消息会丢失。
+// 它只替代订单 Stream：库存预扣（seckill.lua）、订单处理状态和失败补偿仍然读写 Redis
+// EN: In-process channel backend for tests and single-node dev (replaces stream.orders only)
+type memoryOrderQueue struct {
+	ch       chan *memoryEnvelope
+	workers  int
+	seq      atomic.Int64
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	// onFail 消息最终处理失败（进入死信或投递失败）时调用，默认记录失败状态并归还预扣的库存与下单名额
+	onFail func(ctx context.Context, msg *OrderMessage, reason string)
+
+	mu          sync.Mutex
+	pending     map[string]*memoryEnvelope // 消息ID → 已投递未处理完的消息
+	deadLetters []memoryDeadLetter
+}
+
+// memoryEnvelope 带投递信息的消息，除 msg 外的字段由 mu 保护
+type memoryEnvelope struct {
+	msg          *OrderMessage
+	deliveries   int64
+	consumer     string    // 正在处理的消费者，等待投递或重试时为空
+	lastDelivery time.Time // 最近一次投递（或入队）的时间
+}
+
+// memoryDeadLetter 内存队列中的死信
+type memoryDeadLetter struct {
+	msg      OrderMessage
+	reason   string
+	failedAt time.Time
+}
+
+// NewMemoryOrderQueue 创建内存订单队列
+func NewMemoryOrderQueue(size, workers int) *memoryOrderQueue {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &memoryOrderQueue{
+		ch:       make(chan *memoryEnvelope, size),
+		workers:  workers,
+		stopChan: make(chan struct{}),
+		onFail:   failOrderMessage,
+		pending:  make(map[string]*memoryEnvelope),
+	}
+}
+
+func (q *memoryOrderQueue) Name() string { return "memory" }
+
+// StreamKey 内存队列不经过 Redis Stream，由秒杀入口调用 Publish
+func (q *memoryOrderQueue) StreamKey() string { return "" }
+
+// Publish 投递消息，队列已满时返回错误
+func (q *memoryOrderQueue) Publish(ctx context.Context, msg *OrderMessage) error {
+	if msg.ID == "" {
+		msg.ID = strconv.FormatInt(q.seq.Add(1), 10)
+	}
+	env := &memoryEnvelope{msg: msg, lastDelivery: time.Now()}
+
+	// 先登记再入队，避免消费者处理完成时还没有登记
+	q.mu.Lock()
+	q.pending[msg.ID] = env
+	q.mu.Unlock()
+
+	select {
+	case q.ch <- env:
+		return nil
+	case <-q.stopChan:
+		q.finish(env)
+		return errors.New("订单队列已停止")
+	default:
+		q.finish(env)
+		return errors.New("订单队列已满")
+	}
+}
+
+// InFlight 统计已投递但尚未处理完成的件数
+func (q *memoryOrderQueue) InFlight(ctx context.Context) (map[uint]int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	result := make(map[uint]int)
+	for _, env := range q.pending {
+		voucherID, quantity, err := env.msg.voucherQuantity()
+		if err != nil {
+			continue
+		}
+		result[voucherID] += quantity
+	}
+	return result, nil
+}
+
+// InFlightByUser 按优惠券和用户统计已投递但尚未处理完成的件数
+func (q *memoryOrderQueue) InFlightByUser(ctx context.Context) (map[uint]map[uint]int, error) {
+	q.mu.Lock()
+	msgs := make([]*OrderMessage, 0, len(q.pending))
+	for _, env := range q.pending {
+		msgs = append(msgs, env.msg)
+	}
+	q.mu.Unlock()
+	return groupInFlightByUser(msgs), nil
+}
+
+// Stats 队列积压、在途消息和死信数量
+func (q *memoryOrderQueue) Stats(ctx context.Context) (map[string]interface{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var oldest time.Time
+	for _, env := range q.pending {
+		if oldest.IsZero() || env.lastDelivery.Before(oldest) {
+			oldest = env.lastDelivery
+		}
+	}
+	var oldestPendingAge int64
+	if !oldest.IsZero() {
+		oldestPendingAge = time.Since(oldest).Milliseconds()
+	}
+
+	return map[string]interface{}{
+		"length":             len(q.ch),
+		"capacity":           cap(q.ch),
+		"pending":            len(q.pending),
+		"oldestPendingAgeMs": oldestPendingAge,
+		"consumers":          q.workers,
+		"dlqSize":            len(q.deadLetters),
+	}, nil
+}
+
+// Pending 按投递时间从早到晚列出在途消息，consumer 不为空时只返回该消费者正在处理的消息
+func (q *memoryOrderQueue) Pending(ctx context.Context, consumer string, count int64) ([]PendingOrder, error) {
+	q.mu.Lock()
+	envs := make([]*memoryEnvelope, 0, len(q.pending))
+	for _, env := range q.pending {
+		if consumer == "" || env.consumer == consumer {
+			envs = append(envs, env)
+		}
+	}
+	sort.Slice(envs, func(i, j int) bool { return envs[i].lastDelivery.Before(envs[j].lastDelivery) })
+	if int64(len(envs)) > count {
+		envs = envs[:count]
+	}
+	list := make([]PendingOrder, 0, len(envs))
+	for _, env := range envs {
+		list = append(list, PendingOrder{
+			ID:         env.msg.ID,
+			Consumer:   env.consumer,
+			IdleMs:     time.Since(env.lastDelivery).Milliseconds(),
+			Deliveries: env.deliveries,
+		})
+	}
+	q.mu.Unlock()
+	return list, nil
+}
+
+// DeadLetters 最近的死信（新的在前），字段与 Redis 死信 Stream 保持一致
+func (q *memoryOrderQueue) DeadLetters(ctx context.Context, count int64) ([]DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := make([]DeadLetter, 0)
+	for i := len(q.deadLetters) - 1; i >= 0 && int64(len(list)) < count; i-- {
+		d := q.deadLetters[i]
+		list = append(list, DeadLetter{
+			ID: d.msg.ID,
+			Values: map[string]interface{}{
+				"userId":    d.msg.UserID,
+				"voucherId": d.msg.VoucherID,
+				"orderId":   d.msg.OrderID,
+				"quantity":  d.msg.Quantity,
+				"reason":    d.reason,
+				"failedAt":  d.failedAt.Format(time.RFC3339),
+			},
+		})
+	}
+	return list, nil
+}
+
+// GetDeadLetter 按消息ID读取死信
+func (q *memoryOrderQueue) GetDeadLetter(ctx context.Context, id string) (*OrderMessage, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, d := range q.deadLetters {
+		if d.msg.ID == id {
+			msg := d.msg
+			return &msg, nil
+		}
+	}
+	return nil, nil
+}
+
+// RemoveDeadLetter 删除一条死信
+func (q *memoryOrderQueue) RemoveDeadLetter(ctx context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, d := range q.deadLetters {
+		if d.msg.ID == id {
+			q.deadLetters = append(q.deadLetters[:i], q.deadLetters[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// TrimDeadLetters 只保留最近的 maxLen 条死信
+func (q *memoryOrderQueue) TrimDeadLetters(ctx context.Context, maxLen int64) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	removed := int64(len(q.deadLetters)) - maxLen
+	if removed <= 0 {
+		return 0, nil
+	}
+	q.deadLetters = append([]memoryDeadLetter(nil), q.deadLetters[removed:]...)
+	return removed, nil
+}
+
+// Start 启动消费者
+func (q *memoryOrderQueue) Start(handler OrderHandler) error {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.consume(handler, fmt.Sprintf("memory-consumer-%d", i))
+	}
+	log.Printf("内存订单队列初始化完成，消费者数量: %d", q.workers)
+	return nil
+}
+
+// Stop 停止消费者
+func (q *memoryOrderQueue) Stop() {
+	q.stopOnce.Do(func() { close(q.stopChan) })
+	q.wg.Wait()
+	log.Printf("内存订单队列已停止，剩余未处理消息: %d", len(q.ch))
+}
+
+// consume 消费者循环：失败的消息在重试预算内退避后重新入队，超过后进入死信
+func (q *memoryOrderQueue) consume(handler OrderHandler, consumer string) {
+	defer q.wg.Done()
+
+	ctx := context.Background()
+	for {
+		select {
+		case <-q.stopChan:
+			return
+		case env := <-q.ch:
+			q.mu.Lock()
+			env.deliveries++
+			env.consumer = consumer
+			env.lastDelivery = time.Now()
+			deliveries := env.deliveries
+			q.mu.Unlock()
+
+			err := handler(ctx, env.msg)
+			if err == nil {
+				q.finish(env)
+				continue
+			}
+
+			log.Printf("内存队列处理消息失败: msgID=%s, error=%v", env.msg.ID, err)
+			var perr *permanentError
+			if errors.As(err, &perr) || deliveries >= orderMaxRetry() {
+				q.deadLetter(ctx, env, deliveries, err)
+				continue
+			}
+			q.mu.Lock()
+			env.consumer = ""
+			q.mu.Unlock()
+			go q.retry(env)
+		}
+	}
+}
+
+// retry 退避后重新入队
+func (q *memoryOrderQueue) retry(env *memoryEnvelope) {
+	select {
+	case <-q.stopChan:
+	case <-time.After(retryBackoff):
+		select {
+		case q.ch <- env:
+		case <-q.stopChan:
+		}
+	}
+}
+
+// finish 消息处理完成（成功或进入死信），不再计入在途
+func (q *memoryOrderQueue) finish(env *memoryEnvelope) {
+	q.mu.Lock()
+	delete(q.pending, env.msg.ID)
+	q.mu.Unlock()
+}
+
+// deadLetter 记录死信并归还预扣的库存与下单名额
+func (q *memoryOrderQueue) deadLetter(ctx context.Context, env *memoryEnvelope, deliveries int64, cause error) {
+	q.mu.Lock()
+	q.deadLetters = append(q.deadLetters, memoryDeadLetter{
+		msg:      *env.msg,
+		reason:   fmt.Sprintf("%v (deliveries=%d)", cause, deliveries),
+		failedAt: time.Now(),
+	})
+	if len(q.deadLetters) > memoryDeadLetterLimit {
+		q.deadLetters = q.deadLetters[len(q.deadLetters)-memoryDeadLetterLimit:]
+	}
+	delete(q.pending, env.msg.ID)
+	q.mu.Unlock()
+
+	if q.onFail != nil {
+		q.onFail(ctx, env.msg, cause.Error())
+	}
+	log.Printf("消息已转入内存死信: msgID=%s, reason=%v", env.msg.ID, cause)
+}
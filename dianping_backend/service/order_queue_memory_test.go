@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestMemoryQueue 创建不依赖 Redis 的内存队列：失败补偿记录到 failed，重试间隔缩短
+func newTestMemoryQueue(t *testing.T, size, workers int) (*memoryOrderQueue, *failedMessages) {
+	t.Helper()
+	backoff := retryBackoff
+	retryBackoff = 10 * time.Millisecond
+	t.Cleanup(func() { retryBackoff = backoff })
+
+	failed := &failedMessages{}
+	q := NewMemoryOrderQueue(size, workers)
+	q.onFail = failed.add
+	t.Cleanup(q.Stop)
+	return q, failed
+}
+
+// failedMessages 记录进入死信时的补偿调用
+type failedMessages struct {
+	mu   sync.Mutex
+	msgs []OrderMessage
+}
+
+func (f *failedMessages) add(ctx context.Context, msg *OrderMessage, reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.msgs = append(f.msgs, *msg)
+}
+
+func (f *failedMessages) list() []OrderMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]OrderMessage(nil), f.msgs...)
+}
+
+// waitFor 轮询等待条件成立
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func inFlightOf(t *testing.T, q *memoryOrderQueue) map[uint]int {
+	t.Helper()
+	inFlight, err := q.InFlight(context.Background())
+	if err != nil {
+		t.Fatalf("InFlight: %v", err)
+	}
+	return inFlight
+}
+
+func TestMemoryOrderQueueProcessesMessages(t *testing.T) {
+	q, failed := newTestMemoryQueue(t, 16, 2)
+	var handled atomic.Int64
+	if err := q.Start(func(ctx context.Context, msg *OrderMessage) error {
+		handled.Add(1)
+		return nil
+	}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		msg := &OrderMessage{UserID: "1", VoucherID: "7", OrderID: "100", Quantity: "2"}
+		if err := q.Publish(ctx, msg); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		if msg.ID == "" {
+			t.Fatal("Publish did not assign a message ID")
+		}
+	}
+
+	waitFor(t, "all messages handled", func() bool { return handled.Load() == 10 })
+	waitFor(t, "in-flight drained", func() bool { return len(inFlightOf(t, q)) == 0 })
+	if got := failed.list(); len(got) != 0 {
+		t.Fatalf("unexpected compensation for %d messages", len(got))
+	}
+}
+
+func TestMemoryOrderQueueInFlightAndPending(t *testing.T) {
+	q, _ := newTestMemoryQueue(t, 16, 1)
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	if err := q.Start(func(ctx context.Context, msg *OrderMessage) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	_ = q.Publish(ctx, &OrderMessage{UserID: "1", VoucherID: "7", OrderID: "1", Quantity: "2"})
+	_ = q.Publish(ctx, &OrderMessage{UserID: "2", VoucherID: "7", OrderID: "2"})
+	_ = q.Publish(ctx, &OrderMessage{UserID: "3", VoucherID: "8", OrderID: "3", Quantity: "3"})
+	<-started
+
+	inFlight := inFlightOf(t, q)
+	if inFlight[7] != 3 || inFlight[8] != 3 {
+		t.Fatalf("InFlight = %v, want map[7:3 8:3]", inFlight)
+	}
+
+	byUser, err := q.InFlightByUser(ctx)
+	if err != nil {
+		t.Fatalf("InFlightByUser: %v", err)
+	}
+	if byUser[7][1] != 2 || byUser[7][2] != 1 || byUser[8][3] != 3 {
+		t.Fatalf("InFlightByUser = %v, want map[7:map[1:2 2:1] 8:map[3:3]]", byUser)
+	}
+
+	pending, err := q.Pending(ctx, "", 10)
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	if len(pending) != 3 {
+		t.Fatalf("Pending returned %d entries, want 3", len(pending))
+	}
+	busy, err := q.Pending(ctx, "memory-consumer-0", 10)
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	if len(busy) != 1 || busy[0].Deliveries != 1 {
+		t.Fatalf("Pending for consumer = %+v, want one entry delivered once", busy)
+	}
+
+	close(release)
+	waitFor(t, "in-flight drained", func() bool { return len(inFlightOf(t, q)) == 0 })
+}
+
+func TestMemoryOrderQueueRetriesTransientErrors(t *testing.T) {
+	q, failed := newTestMemoryQueue(t, 16, 1)
+	var attempts atomic.Int64
+	if err := q.Start(func(ctx context.Context, msg *OrderMessage) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("db unavailable")
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if err := q.Publish(context.Background(), &OrderMessage{UserID: "1", VoucherID: "7", OrderID: "1"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	waitFor(t, "message handled after retries", func() bool { return len(inFlightOf(t, q)) == 0 })
+
+	if got := attempts.Load(); got != 3 {
+		t.Fatalf("handler called %d times, want 3", got)
+	}
+	if got := failed.list(); len(got) != 0 {
+		t.Fatalf("unexpected compensation for %d messages", len(got))
+	}
+	if dls, _ := q.DeadLetters(context.Background(), 10); len(dls) != 0 {
+		t.Fatalf("unexpected dead letters: %+v", dls)
+	}
+}
+
+func TestMemoryOrderQueueDeadLettersAfterRetryBudget(t *testing.T) {
+	q, failed := newTestMemoryQueue(t, 16, 1)
+	var attempts atomic.Int64
+	if err := q.Start(func(ctx context.Context, msg *OrderMessage) error {
+		attempts.Add(1)
+		return errors.New("db unavailable")
+	}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if err := q.Publish(context.Background(), &OrderMessage{UserID: "1", VoucherID: "7", OrderID: "1"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	waitFor(t, "message compensated", func() bool { return len(failed.list()) == 1 })
+
+	if got := attempts.Load(); got != orderMaxRetry() {
+		t.Fatalf("handler called %d times, want %d", got, orderMaxRetry())
+	}
+	if inFlight := inFlightOf(t, q); len(inFlight) != 0 {
+		t.Fatalf("InFlight = %v after dead letter, want empty", inFlight)
+	}
+}
+
+func TestMemoryOrderQueuePermanentErrorSkipsRetries(t *testing.T) {
+	q, failed := newTestMemoryQueue(t, 16, 1)
+	// handleOrderMessage 在访问数据库之前就会拒绝无法解析的消息
+	if err := q.Start(handleOrderMessage); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	msg := &OrderMessage{UserID: "not-a-number", VoucherID: "7", OrderID: "42"}
+	if err := q.Publish(context.Background(), msg); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	waitFor(t, "message compensated", func() bool { return len(failed.list()) == 1 })
+
+	dls, err := q.DeadLetters(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("DeadLetters: %v", err)
+	}
+	if len(dls) != 1 || dls[0].ID != msg.ID {
+		t.Fatalf("DeadLetters = %+v, want the published message", dls)
+	}
+	if reason, _ := dls[0].Values["reason"].(string); !strings.Contains(reason, "deliveries=1") {
+		t.Fatalf("dead letter reason = %q, want a single delivery", reason)
+	}
+	if got := failed.list()[0].OrderID; got != "42" {
+		t.Fatalf("compensated order %q, want 42", got)
+	}
+}
+
+func TestMemoryOrderQueueDeadLetterAdmin(t *testing.T) {
+	q, _ := newTestMemoryQueue(t, 16, 1)
+	if err := q.Start(func(ctx context.Context, msg *OrderMessage) error {
+		return permanent(errors.New("voucher not found"))
+	}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ctx := context.Background()
+	var ids []string
+	for _, orderID := range []string{"1", "2", "3"} {
+		msg := &OrderMessage{UserID: "1", VoucherID: "7", OrderID: orderID}
+		if err := q.Publish(ctx, msg); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		ids = append(ids, msg.ID)
+	}
+	waitFor(t, "all dead-lettered", func() bool {
+		dls, _ := q.DeadLetters(ctx, 10)
+		return len(dls) == 3
+	})
+
+	dls, _ := q.DeadLetters(ctx, 2)
+	if len(dls) != 2 {
+		t.Fatalf("DeadLetters(2) returned %d entries", len(dls))
+	}
+
+	msg, err := q.GetDeadLetter(ctx, ids[1])
+	if err != nil || msg == nil || msg.OrderID != "2" {
+		t.Fatalf("GetDeadLetter = %+v, %v; want order 2", msg, err)
+	}
+	if msg, _ := q.GetDeadLetter(ctx, "missing"); msg != nil {
+		t.Fatalf("GetDeadLetter(missing) = %+v, want nil", msg)
+	}
+
+	if err := q.RemoveDeadLetter(ctx, ids[1]); err != nil {
+		t.Fatalf("RemoveDeadLetter: %v", err)
+	}
+	if msg, _ := q.GetDeadLetter(ctx, ids[1]); msg != nil {
+		t.Fatal("dead letter still present after RemoveDeadLetter")
+	}
+
+	removed, err := q.TrimDeadLetters(ctx, 1)
+	if err != nil || removed != 1 {
+		t.Fatalf("TrimDeadLetters = %d, %v; want 1", removed, err)
+	}
+	if msg, _ := q.GetDeadLetter(ctx, ids[2]); msg == nil {
+		t.Fatal("TrimDeadLetters dropped the newest dead letter")
+	}
+}
+
+func TestMemoryOrderQueuePublishWhenFull(t *testing.T) {
+	q, _ := newTestMemoryQueue(t, 1, 1)
+	// 不启动消费者，第二条消息入队失败
+	ctx := context.Background()
+	if err := q.Publish(ctx, &OrderMessage{UserID: "1", VoucherID: "7", OrderID: "1"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if err := q.Publish(ctx, &OrderMessage{UserID: "2", VoucherID: "7", OrderID: "2"}); err == nil {
+		t.Fatal("Publish succeeded on a full queue")
+	}
+	if inFlight := inFlightOf(t, q); inFlight[7] != 1 {
+		t.Fatalf("InFlight = %v, want only the accepted message", inFlight)
+	}
+}
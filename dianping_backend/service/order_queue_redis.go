@@ -0,0 +1,709 @@
+package service
+
+import (
+	"context"
+	"dianping/config"
+	"dianping/dao"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisStreamQueue 基于 Redis Stream 消费者组的订单队列：由 seckill.lua 原子写入 stream.orders，
+// 支持重试预算、死信队列和失效消费者的消息回收
+// EN: Redis Streams backend (the Lua script XADDs atomically with the stock reservation)
+type redisStreamQueue struct{}
+
+func (q *redisStreamQueue) Name() string { return "redis" }
+
+func (q *redisStreamQueue) StreamKey() string { return streamKey }
+
+func (q *redisStreamQueue) Publish(ctx context.Context, msg *OrderMessage) error {
+	return dao.Redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		ID:     "*",
+		Values: map[string]interface{}{
+			"userId":    msg.UserID,
+			"voucherId": msg.VoucherID,
+			"orderId":   msg.OrderID,
+			"quantity":  msg.Quantity,
+		},
+	}).Err()
+}
+
+// InFlight 统计尚未投递（last-delivered-id 之后）和已投递未确认（pending）的消息件数
+func (q *redisStreamQueue) InFlight(ctx context.Context) (map[uint]int, error) {
+	msgs, err := q.inFlightMessages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint]int)
+	for _, msg := range msgs {
+		voucherID, quantity, err := msg.voucherQuantity()
+		if err != nil {
+			continue
+		}
+		result[voucherID] += quantity
+	}
+	return result, nil
+}
+
+// InFlightByUser 与 InFlight 统计同样的消息，按优惠券和用户分组
+func (q *redisStreamQueue) InFlightByUser(ctx context.Context) (map[uint]map[uint]int, error) {
+	msgs, err := q.inFlightMessages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return groupInFlightByUser(msgs), nil
+}
+
+// inFlightMessages 读取尚未投递和已投递未确认的消息
+func (q *redisStreamQueue) inFlightMessages(ctx context.Context) ([]*OrderMessage, error) {
+	group, err := getOrderGroupInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 从最老的 pending 消息开始扫描，没有 pending 时只扫描未投递的消息
+	start := "(" + group.lastDeliveredID
+	pendingIDs := make(map[string]bool)
+	summary, err := dao.Redis.XPending(ctx, streamKey, groupName).Result()
+	if err != nil {
+		return nil, err
+	}
+	if summary.Count > 0 {
+		if summary.Count > inFlightScanLimit {
+			return nil, fmt.Errorf("pending 消息过多(%d)，无法统计在途订单", summary.Count)
+		}
+		entries, err := dao.Redis.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: streamKey,
+			Group:  groupName,
+			Start:  "-",
+			End:    "+",
+			Count:  summary.Count,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			pendingIDs[e.ID] = true
+		}
+		start = summary.Lower
+	}
+
+	msgs, err := dao.Redis.XRangeN(ctx, streamKey, start, "+", inFlightScanLimit+1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(msgs)) > inFlightScanLimit {
+		return nil, fmt.Errorf("积压消息过多，无法统计在途订单")
+	}
+
+	result := make([]*OrderMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		// 已确认的消息（pending 区间内但不在 pending 列表中）已经处理完成
+		if !pendingIDs[msg.ID] && streamIDLessOrEqual(msg.ID, group.lastDeliveredID) {
+			continue
+		}
+		orderMsg, err := parseOrderMessage(msg)
+		if err != nil {
+			continue
+		}
+		result = append(result, orderMsg)
+	}
+	return result, nil
+}
+
+// Stats 订单 Stream 的积压、各消费者 pending、最老 pending 时长和死信数量
+func (q *redisStreamQueue) Stats(ctx context.Context) (map[string]interface{}, error) {
+	length, err := dao.Redis.XLen(ctx, streamKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取Stream信息失败: %v", err)
+	}
+
+	group, err := getOrderGroupInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取消费者组信息失败: %v", err)
+	}
+
+	consumers, err := listStreamConsumers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取消费者信息失败: %v", err)
+	}
+	consumerList := make([]map[string]interface{}, 0, len(consumers))
+	for _, c := range consumers {
+		name, _ := c["name"].(string)
+		consumerList = append(consumerList, map[string]interface{}{
+			"name":    name,
+			"pending": c["pending"],
+			"idleMs":  c["idle"],
+			"local":   isLocalConsumer(name),
+		})
+	}
+
+	pending, err := dao.Redis.XPending(ctx, streamKey, groupName).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取pending信息失败: %v", err)
+	}
+	var oldestPendingAge int64
+	if pending.Count > 0 {
+		if t, ok := streamIDTime(pending.Lower); ok {
+			oldestPendingAge = time.Since(t).Milliseconds()
+		}
+	}
+
+	dlqSize, err := dao.Redis.XLen(ctx, dlqStreamKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("获取死信队列信息失败: %v", err)
+	}
+
+	return map[string]interface{}{
+		"stream":             streamKey,
+		"group":              groupName,
+		"length":             length,
+		"lag":                group.lag,
+		"lastDeliveredId":    group.lastDeliveredID,
+		"pending":            pending.Count,
+		"oldestPendingId":    pending.Lower,
+		"oldestPendingAgeMs": oldestPendingAge,
+		"consumers":          consumerList,
+		"dlq":                dlqStreamKey,
+		"dlqSize":            dlqSize,
+	}, nil
+}
+
+// Pending 通过 XPENDING 查看 pending 消息的空闲时间和投递次数
+func (q *redisStreamQueue) Pending(ctx context.Context, consumer string, count int64) ([]PendingOrder, error) {
+	entries, err := dao.Redis.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   streamKey,
+		Group:    groupName,
+		Start:    "-",
+		End:      "+",
+		Count:    count,
+		Consumer: consumer,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]PendingOrder, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, PendingOrder{
+			ID:         e.ID,
+			Consumer:   e.Consumer,
+			IdleMs:     e.Idle.Milliseconds(),
+			Deliveries: e.RetryCount,
+		})
+	}
+	return list, nil
+}
+
+// DeadLetters 倒序读取死信 Stream
+func (q *redisStreamQueue) DeadLetters(ctx context.Context, count int64) ([]DeadLetter, error) {
+	msgs, err := dao.Redis.XRevRangeN(ctx, dlqStreamKey, "+", "-", count).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]DeadLetter, 0, len(msgs))
+	for _, m := range msgs {
+		list = append(list, DeadLetter{ID: m.ID, Values: m.Values})
+	}
+	return list, nil
+}
+
+// GetDeadLetter 按消息ID读取死信并解析订单字段
+func (q *redisStreamQueue) GetDeadLetter(ctx context.Context, id string) (*OrderMessage, error) {
+	msgs, err := dao.Redis.XRange(ctx, dlqStreamKey, id, id).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	msg, err := parseOrderMessage(msgs[0])
+	if err != nil {
+		return nil, fmt.Errorf("死信消息格式错误: %v", err)
+	}
+	return msg, nil
+}
+
+func (q *redisStreamQueue) RemoveDeadLetter(ctx context.Context, id string) error {
+	return dao.Redis.XDel(ctx, dlqStreamKey, id).Err()
+}
+
+func (q *redisStreamQueue) TrimDeadLetters(ctx context.Context, maxLen int64) (int64, error) {
+	return dao.Redis.XTrimMaxLen(ctx, dlqStreamKey, maxLen).Result()
+}
+
+func (q *redisStreamQueue) Start(handler OrderHandler) error { return InitStreamConsumer(handler) }
+
+func (q *redisStreamQueue) Stop() { StopStreamConsumers() }
+
+// Stream消费者相关配置
+// EN: Redis Stream consumer configuration
+var (
+	streamKey     = "stream.orders"     // Stream名称
+	dlqStreamKey  = "stream.orders.dlq" // 死信队列Stream名称
+	groupName     = "order-group"       // 消费者组名称
+	retryBackoff  = time.Second         // 处理失败后的重试间隔
+	consumerCount = 3                   // 消费者数量
+	streamOnce    sync.Once             // 确保Stream只初始化一次
+	stopChan      = make(chan struct{}) // 停止信号
+	wg            sync.WaitGroup        // 等待组，用于优雅关闭
+	streamHandler OrderHandler          // 订单消息处理函数
+
+	reclaimInterval    = 30 * time.Second     // 回收 pending 消息的周期
+	reclaimBatchSize   = int64(100)           // 每次 XAUTOCLAIM 的数量
+	consumerNamePrefix = instanceConsumerID() // 实例唯一的消费者名前缀（hostname-pid）
+	localConsumers     []string               // 本实例的消费者名称
+
+	inFlightScanLimit = int64(100000) // 统计在途订单时最多扫描的消息数
+)
+
+// InitStreamConsumer 初始化Redis Stream消费者
+// EN: Initialize Redis Stream consumers (group + workers)
+func InitStreamConsumer(handler OrderHandler) error {
+	var initErr error
+	streamOnce.Do(func() {
+		streamHandler = handler
+
+		ctx := context.Background()
+
+		// 1. 检查Stream是否存在，如果不存在则创建
+		exists, err := checkStreamExists(ctx, streamKey)
+		if err != nil {
+			initErr = fmt.Errorf("检查Stream失败: %v", err)
+			return
+		}
+
+		if !exists {
+			// 创建一个空的Stream（通过添加临时消息然后删除）
+			result := dao.Redis.XAdd(ctx, &redis.XAddArgs{
+				Stream: streamKey,
+				ID:     "*",
+				Values: map[string]interface{}{"init": "temp"},
+			})
+			if result.Err() != nil {
+				initErr = fmt.Errorf("创建Stream失败: %v", result.Err())
+				return
+			}
+			// 删除临时消息
+			dao.Redis.XDel(ctx, streamKey, result.Val())
+		}
+
+		// 2. 创建消费者组（如果不存在）
+		err = dao.Redis.XGroupCreateMkStream(ctx, streamKey, groupName, "0").Err()
+		if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
+			initErr = fmt.Errorf("创建消费者组失败: %v", err)
+			return
+		}
+
+		// 3. 启动消费者（名称带实例标识，多实例部署时互不冲突）
+		for i := 0; i < consumerCount; i++ {
+			consumerName := fmt.Sprintf("%s-consumer-%d", consumerNamePrefix, i)
+			localConsumers = append(localConsumers, consumerName)
+			wg.Add(1)
+			go streamConsumer(consumerName, i)
+		}
+
+		// 4. 启动回收协程：接管已失效消费者的 pending 消息并清理过期消费者
+		wg.Add(1)
+		go streamReclaimer()
+
+		log.Printf("Redis Stream消费者初始化完成，Stream: %s, 消费者组: %s, 消费者数量: %d",
+			streamKey, groupName, consumerCount)
+	})
+
+	return initErr
+}
+
+// checkStreamExists 检查Stream是否存在
+// EN: Check if the Stream key exists in Redis
+func checkStreamExists(ctx context.Context, streamKey string) (bool, error) {
+	result := dao.Redis.Exists(ctx, streamKey)
+	if result.Err() != nil {
+		return false, result.Err()
+	}
+	return result.Val() > 0, nil
+}
+
+// streamConsumer Stream消费者worker
+// EN: Worker loop that reads and processes Stream messages
+func streamConsumer(consumerName string, workerID int) {
+	defer wg.Done()
+
+	log.Printf("Stream消费者 %s (Worker %d) 启动", consumerName, workerID)
+
+	ctx := context.Background()
+
+	for {
+		select {
+		case <-stopChan:
+			log.Printf("Stream消费者 %s (Worker %d) 收到停止信号，正在退出", consumerName, workerID)
+			return
+		default:
+			// 从Stream中读取消息
+			messages, err := readStreamMessages(ctx, consumerName)
+			if err != nil {
+				log.Printf("消费者 %s 读取消息失败: %v", consumerName, err)
+				time.Sleep(time.Second * 2) // 出错时等待2秒再重试
+				continue
+			}
+
+			// 处理每条消息
+			failed := false
+			for _, msg := range messages {
+				err := processStreamMessage(ctx, msg, consumerName)
+				if err != nil {
+					log.Printf("消费者 %s 处理消息失败: msgID=%s, error=%v",
+						consumerName, msg.ID, err)
+					// 超过重试次数或不可重试的消息转入死信队列
+					if !handleFailedMessage(ctx, msg, err) {
+						failed = true
+					}
+				} else {
+					log.Printf("消费者 %s 成功处理消息: msgID=%s", consumerName, msg.ID)
+					// 确认消息已处理
+					dao.Redis.XAck(ctx, streamKey, groupName, msg.ID)
+				}
+			}
+
+			// 如果没有消息，短暂休眠；有消息等待重试时退避，避免瞬间耗尽重试次数
+			if len(messages) == 0 {
+				time.Sleep(time.Millisecond * 100)
+			} else if failed {
+				time.Sleep(retryBackoff)
+			}
+		}
+	}
+}
+
+// readStreamMessages 从Stream中读取消息
+// EN: Read pending first, then new messages from the Stream
+func readStreamMessages(ctx context.Context, consumerName string) ([]redis.XMessage, error) {
+	// 首先尝试读取pending消息（之前未确认的消息）
+	pendingResult := dao.Redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    groupName,
+		Consumer: consumerName,
+		Streams:  []string{streamKey, "0"}, // "0"表示读取pending消息
+		Count:    10,
+		Block:    0, // 不阻塞
+	})
+
+	if pendingResult.Err() == nil && len(pendingResult.Val()) > 0 && len(pendingResult.Val()[0].Messages) > 0 {
+		return pendingResult.Val()[0].Messages, nil
+	}
+
+	// 如果没有pending消息，读取新消息
+	result := dao.Redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    groupName,
+		Consumer: consumerName,
+		Streams:  []string{streamKey, ">"}, // ">"表示读取新消息
+		Count:    10,
+		Block:    time.Second * 1, // 阻塞1秒
+	})
+
+	if result.Err() != nil {
+		// 阻塞读取超时等情况，go-redis 可能返回 redis.Nil，视为无消息而不是错误
+		if result.Err() == redis.Nil {
+			return []redis.XMessage{}, nil
+		}
+		return nil, result.Err()
+	}
+
+	if len(result.Val()) > 0 && len(result.Val()[0].Messages) > 0 {
+		return result.Val()[0].Messages, nil
+	}
+
+	return []redis.XMessage{}, nil
+}
+
+// processStreamMessage 处理单条Stream消息
+// EN: Parse and dispatch a single Stream message
+func processStreamMessage(ctx context.Context, msg redis.XMessage, consumerName string) error {
+	// 解析消息内容
+	orderMsg, err := parseOrderMessage(msg)
+	if err != nil {
+		return permanent(fmt.Errorf("解析消息失败: %v", err))
+	}
+
+	// 交给订单处理函数
+	return streamHandler(ctx, orderMsg)
+}
+
+// parseOrderMessage 解析订单消息
+// EN: Parse order fields from Stream message values
+func parseOrderMessage(msg redis.XMessage) (*OrderMessage, error) {
+	orderInfo := &OrderMessage{ID: msg.ID}
+
+	// 从消息中提取字段
+	if userID, ok := msg.Values["userId"].(string); ok {
+		orderInfo.UserID = userID
+	} else {
+		return nil, fmt.Errorf("消息中缺少userId字段")
+	}
+
+	if voucherID, ok := msg.Values["voucherId"].(string); ok {
+		orderInfo.VoucherID = voucherID
+	} else {
+		return nil, fmt.Errorf("消息中缺少voucherId字段")
+	}
+
+	if orderID, ok := msg.Values["orderId"].(string); ok {
+		orderInfo.OrderID = orderID
+	} else {
+		return nil, fmt.Errorf("消息中缺少orderId字段")
+	}
+
+	// 购买数量（旧消息没有该字段）
+	if quantity, ok := msg.Values["quantity"].(string); ok {
+		orderInfo.Quantity = quantity
+	}
+
+	return orderInfo, nil
+}
+
+// ================= 重试与死信队列 =================
+
+// getDeliveryCount 通过 XPENDING 获取消息的投递次数
+func getDeliveryCount(ctx context.Context, msgID string) (int64, error) {
+	pending, err := dao.Redis.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: streamKey,
+		Group:  groupName,
+		Start:  msgID,
+		End:    msgID,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+	return pending[0].RetryCount, nil
+}
+
+// handleFailedMessage 处理失败的消息：不可重试或超过重试次数时转入死信队列并补偿，
+// 返回 true 表示消息已离开 pending 列表
+// EN: Move poison messages to the DLQ once the retry budget is spent
+func handleFailedMessage(ctx context.Context, msg redis.XMessage, cause error) bool {
+	var perr *permanentError
+	if !errors.As(cause, &perr) {
+		deliveries, err := getDeliveryCount(ctx, msg.ID)
+		if err != nil {
+			log.Printf("获取消息投递次数失败: msgID=%s, error=%v", msg.ID, err)
+			return false
+		}
+		if deliveries < orderMaxRetry() {
+			return false
+		}
+	}
+
+	if err := moveToDeadLetter(ctx, msg, cause); err != nil {
+		log.Printf("消息转入死信队列失败: msgID=%s, error=%v", msg.ID, err)
+		return false
+	}
+	return true
+}
+
+// moveToDeadLetter 将消息写入死信队列并确认原消息，同时归还 Lua 脚本预扣的库存与下单名额
+func moveToDeadLetter(ctx context.Context, msg redis.XMessage, cause error) error {
+	values := make(map[string]interface{}, len(msg.Values)+3)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values["sourceId"] = msg.ID
+	values["reason"] = cause.Error()
+	values["failedAt"] = time.Now().Format(time.RFC3339)
+
+	// 先写死信再确认，宁可重复也不丢消息
+	if err := dao.Redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: dlqStreamKey,
+		ID:     "*",
+		Values: values,
+	}).Err(); err != nil {
+		return err
+	}
+	if err := dao.Redis.XAck(ctx, streamKey, groupName, msg.ID).Err(); err != nil {
+		return err
+	}
+
+	// 补偿：订单未创建，记录失败状态并归还 Redis 库存与限购名额
+	if orderMsg, err := parseOrderMessage(msg); err == nil {
+		failOrderMessage(ctx, orderMsg, cause.Error())
+	}
+
+	log.Printf("消息已转入死信队列: msgID=%s, reason=%v", msg.ID, cause)
+	return nil
+}
+
+// ================= 失效消费者的消息回收 =================
+
+// instanceConsumerID 生成实例唯一标识（hostname-pid）
+func instanceConsumerID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// claimMinIdle pending 消息被接管前的最小空闲时间
+func claimMinIdle() time.Duration {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Stream.ClaimMinIdle > 0 {
+		return time.Duration(cfg.Stream.ClaimMinIdle) * time.Second
+	}
+	return time.Minute
+}
+
+// consumerStaleAfter 其他实例消费者被视为过期的空闲时间
+func consumerStaleAfter() time.Duration {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Stream.ConsumerStaleAfter > 0 {
+		return time.Duration(cfg.Stream.ConsumerStaleAfter) * time.Second
+	}
+	return 10 * time.Minute
+}
+
+// streamReclaimer 周期性回收 pending 消息并清理过期消费者
+// EN: Periodically XAUTOCLAIM idle pending entries and delete stale consumers
+func streamReclaimer() {
+	defer wg.Done()
+
+	ticker := time.NewTicker(reclaimInterval)
+	defer ticker.Stop()
+
+	ctx := context.Background()
+	next := 0
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			// 轮流交给本实例的消费者，由其在下一轮读取 pending 时处理
+			target := localConsumers[next%len(localConsumers)]
+			next++
+			if n, err := reclaimPendingMessages(ctx, target); err != nil {
+				log.Printf("回收pending消息失败: %v", err)
+			} else if n > 0 {
+				log.Printf("已将 %d 条空闲pending消息转交给消费者 %s", n, target)
+			}
+			if err := cleanupStaleConsumers(ctx); err != nil {
+				log.Printf("清理过期消费者失败: %v", err)
+			}
+		}
+	}
+}
+
+// reclaimPendingMessages 使用 XAUTOCLAIM 将空闲超过阈值的 pending 消息转移给 target
+func reclaimPendingMessages(ctx context.Context, target string) (int, error) {
+	start := "0-0"
+	claimed := 0
+	for {
+		// go-redis v8 的 XAutoClaim 无法解析 Redis 7 的三段式返回，这里直接解析原始结果
+		reply, err := dao.Redis.Do(ctx, "XAUTOCLAIM", streamKey, groupName, target,
+			claimMinIdle().Milliseconds(), start, "COUNT", reclaimBatchSize, "JUSTID").Slice()
+		if err != nil {
+			return claimed, err
+		}
+		if len(reply) < 2 {
+			return claimed, fmt.Errorf("XAUTOCLAIM 返回格式错误")
+		}
+		if ids, ok := reply[1].([]interface{}); ok {
+			claimed += len(ids)
+		}
+		next, _ := reply[0].(string)
+		if next == "" || next == "0-0" {
+			return claimed, nil
+		}
+		start = next
+	}
+}
+
+// cleanupStaleConsumers 删除其他实例遗留的、长时间空闲且没有 pending 消息的消费者
+func cleanupStaleConsumers(ctx context.Context) error {
+	consumers, err := listStreamConsumers(ctx)
+	if err != nil {
+		return err
+	}
+
+	staleAfter := consumerStaleAfter().Milliseconds()
+	for _, c := range consumers {
+		name, _ := c["name"].(string)
+		if name == "" || isLocalConsumer(name) {
+			continue
+		}
+		pending, _ := c["pending"].(int64)
+		idle, _ := c["idle"].(int64)
+		// 仍有 pending 的消费者先由 XAUTOCLAIM 接管，DELCONSUMER 会直接丢弃其 pending 记录
+		if pending > 0 || idle < staleAfter {
+			continue
+		}
+		if err := dao.Redis.XGroupDelConsumer(ctx, streamKey, groupName, name).Err(); err != nil {
+			log.Printf("删除过期消费者 %s 失败: %v", name, err)
+			continue
+		}
+		log.Printf("已删除过期消费者: %s (idle=%dms)", name, idle)
+	}
+	return nil
+}
+
+// listStreamConsumers 获取消费者组内的消费者信息（原始 XINFO CONSUMERS，兼容新版本 Redis 的额外字段）
+func listStreamConsumers(ctx context.Context) ([]map[string]interface{}, error) {
+	reply, err := dao.Redis.Do(ctx, "XINFO", "CONSUMERS", streamKey, groupName).Slice()
+	if err != nil {
+		return nil, err
+	}
+	consumers := make([]map[string]interface{}, 0, len(reply))
+	for _, item := range reply {
+		if fields, ok := item.([]interface{}); ok {
+			consumers = append(consumers, replyToMap(fields))
+		}
+	}
+	return consumers, nil
+}
+
+// replyToMap 将 Redis 返回的 key/value 交替数组转换为 map
+func replyToMap(fields []interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		m[fmt.Sprintf("%v", fields[i])] = fields[i+1]
+	}
+	return m
+}
+
+// isLocalConsumer 判断消费者是否属于本实例
+func isLocalConsumer(name string) bool {
+	for _, c := range localConsumers {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// StopStreamConsumers 停止所有Stream消费者（用于优雅关闭）
+// EN: Gracefully stop all Stream consumer workers
+func StopStreamConsumers() {
+	log.Println("正在停止Stream消费者...")
+	close(stopChan)
+	wg.Wait()
+
+	// 删除本实例没有 pending 消息的消费者，避免重启后留下无用的消费者名称
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if consumers, err := listStreamConsumers(ctx); err == nil {
+		for _, c := range consumers {
+			name, _ := c["name"].(string)
+			if pending, _ := c["pending"].(int64); isLocalConsumer(name) && pending == 0 {
+				dao.Redis.XGroupDelConsumer(ctx, streamKey, groupName, name)
+			}
+		}
+	}
+	log.Println("所有Stream消费者已停止")
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"dianping/config"
+	"dianping/dao"
+	"dianping/models"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 未支付订单超时取消相关配置
+// EN: Pay-timeout worker configuration
+var (
+	defaultPayTimeout    = 15 * time.Minute
+	timeoutPollInterval  = time.Second
+	timeoutBatchSize     = int64(100)
+	timeoutRetryDelay    = 10 * time.Second
+	timeoutOnce          sync.Once
+	timeoutStopChan      = make(chan struct{})
+	timeoutWg            sync.WaitGroup
+	timeoutRecoverBatch  = 500
+	errOrderNotCancelled = errors.New("订单无需取消")
+)
+
+// orderPayTimeout 获取未支付订单的超时时间
+func orderPayTimeout() time.Duration {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Order.PayTimeout > 0 {
+		return time.Duration(cfg.Order.PayTimeout) * time.Second
+	}
+	return defaultPayTimeout
+}
+
+// orderPayDeadline 订单的支付截止时间（没有创建时间的订单从现在开始计时）
+func orderPayDeadline(order *models.VoucherOrder) time.Time {
+	created := time.Now()
+	if order.CreateTime != nil {
+		created = *order.CreateTime
+	}
+	return created.Add(orderPayTimeout())
+}
+
+// scheduleOrderPayTimeout 订单创建后登记支付截止时间（失败只记录日志，启动恢复时会重新登记）
+func scheduleOrderPayTimeout(ctx context.Context, order *models.VoucherOrder) {
+	if order.OrderID == 0 {
+		return
+	}
+	if err := dao.AddOrderPayTimeout(ctx, dao.Redis, order.OrderID, orderPayDeadline(order)); err != nil {
+		log.Printf("警告: 登记订单超时任务失败, orderID=%d, 错误=%v", order.OrderID, err)
+	}
+}
+
+// StartOrderTimeoutWorker 启动未支付订单超时取消任务
+// EN: Start the worker that cancels unpaid orders after the pay timeout
+func StartOrderTimeoutWorker() {
+	timeoutOnce.Do(func() {
+		// 恢复历史未支付订单的超时任务（例如延迟队列丢失或功能上线前的订单）
+		if err := recoverUnpaidOrders(context.Background()); err != nil {
+			log.Printf("Warning: 恢复未支付订单超时任务失败: %v", err)
+		}
+
+		timeoutWg.Add(1)
+		go orderTimeoutLoop()
+		log.Printf("订单超时取消任务已启动，支付超时时间: %v", orderPayTimeout())
+	})
+}
+
+// StopOrderTimeoutWorker 停止超时取消任务（用于优雅关闭）
+// EN: Gracefully stop the pay-timeout worker
+func StopOrderTimeoutWorker() {
+	close(timeoutStopChan)
+	timeoutWg.Wait()
+	log.Println("订单超时取消任务已停止")
+}
+
+// recoverUnpaidOrders 将数据库中所有未支付订单重新登记到延迟队列（ZADD 幂等）
+func recoverUnpaidOrders(ctx context.Context) error {
+	var lastID uint
+	total := 0
+	for {
+		orders, err := dao.GetUnpaidVoucherOrders(ctx, dao.DB, lastID, timeoutRecoverBatch)
+		if err != nil {
+			return err
+		}
+		for i := range orders {
+			scheduleOrderPayTimeout(ctx, &orders[i])
+		}
+		total += len(orders)
+		if len(orders) < timeoutRecoverBatch {
+			break
+		}
+		lastID = orders[len(orders)-1].ID
+	}
+	if total > 0 {
+		log.Printf("已恢复 %d 个未支付订单的超时任务", total)
+	}
+	return nil
+}
+
+// orderTimeoutLoop 轮询延迟队列，取消到期未支付的订单
+func orderTimeoutLoop() {
+	defer timeoutWg.Done()
+
+	ticker := time.NewTicker(timeoutPollInterval)
+	defer ticker.Stop()
+
+	ctx := context.Background()
+	for {
+		select {
+		case <-timeoutStopChan:
+			return
+		case <-ticker.C:
+			ids, err := dao.GetDueOrderPayTimeouts(ctx, dao.Redis, time.Now(), timeoutBatchSize)
+			if err != nil {
+				log.Printf("读取订单超时队列失败: %v", err)
+				continue
+			}
+			for _, orderID := range ids {
+				// 多实例下通过 ZREM 抢占任务，只有移除成功的实例负责处理
+				claimed, err := dao.RemoveOrderPayTimeout(ctx, dao.Redis, orderID)
+				if err != nil || !claimed {
+					continue
+				}
+				if err := cancelTimeoutOrder(ctx, orderID); err != nil {
+					if errors.Is(err, errOrderNotCancelled) {
+						continue
+					}
+					log.Printf("超时取消订单失败, orderID=%d, 错误=%v，稍后重试", orderID, err)
+					if err := dao.AddOrderPayTimeout(ctx, dao.Redis, orderID, time.Now().Add(timeoutRetryDelay)); err != nil {
+						log.Printf("警告: 重新登记订单超时任务失败, orderID=%d, 错误=%v", orderID, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+// cancelTimeoutOrder 取消超时未支付的订单，并回补 MySQL 与 Redis 库存
+func cancelTimeoutOrder(ctx context.Context, orderID uint) error {
+	order, err := dao.GetVoucherOrderByOrderID(ctx, dao.DB, orderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errOrderNotCancelled
+		}
+		return err
+	}
+	// 已支付、已取消等状态无需处理
+	if order.Status != models.OrderStatusUnpaid {
+		return errOrderNotCancelled
+	}
+	if err := transitVoucherOrder(ctx, order, models.OrderStatusCancelled, map[string]interface{}{}); err != nil {
+		// 并发支付导致状态已变更
+		if latest, lerr := dao.GetVoucherOrderByOrderID(ctx, dao.DB, orderID); lerr == nil && latest.Status != models.OrderStatusUnpaid {
+			return errOrderNotCancelled
+		}
+		return err
+	}
+	log.Printf("订单超时未支付，已自动取消: orderID=%d", orderID)
+	return nil
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"dianping/config"
+	"dianping/dao"
+	"dianping/models"
+	"dianping/utils"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 评价相关配置
+// EN: Review rating configuration
+var (
+	defaultReviewPriorMean   = 3.5
+	defaultReviewPriorWeight = 5
+	reviewMaxImages          = 9
+)
+
+// reviewPrior 获取贝叶斯平均的先验平均分和权重
+func reviewPrior() (float64, int) {
+	mean, weight := defaultReviewPriorMean, defaultReviewPriorWeight
+	if cfg := config.GetConfig(); cfg != nil {
+		if cfg.Review.PriorMean >= 1 && cfg.Review.PriorMean <= 5 {
+			mean = cfg.Review.PriorMean
+		}
+		if cfg.Review.PriorWeight > 0 {
+			weight = cfg.Review.PriorWeight
+		}
+	}
+	return mean, weight
+}
+
+// ReviewRequest 发布或修改评价的请求
+// EN: Payload to create or edit a review
+type ReviewRequest struct {
+	ShopID  uint   `json:"shopId"`
+	Rating  int    `json:"rating" binding:"required,min=1,max=5"`
+	Content string `json:"content" binding:"max=2000"`
+	Images  string `json:"images"` // 多张以逗号分隔，最多9张
+}
+
+// checkReviewImages 校验评价图片数量
+func checkReviewImages(images string) *utils.Result {
+	if images != "" && len(strings.Split(images, ",")) > reviewMaxImages {
+		return utils.ErrorResult(fmt.Sprintf("最多上传 %d 张图片", reviewMaxImages))
+	}
+	return nil
+}
+
+// CreateReview 发布评价，每个用户对每个商铺只能评价一次；
+// 在同一事务内增量更新商铺的评价数和评分，商铺缓存由 tb_shop 的变更事件删除
+// EN: Post a review and update the shop's rating aggregate in the same transaction
+func CreateReview(ctx context.Context, userID uint, req *ReviewRequest) *utils.Result {
+	if req.ShopID == 0 {
+		return utils.ErrorResult("商铺ID不能为空")
+	}
+	if res := checkReviewImages(req.Images); res != nil {
+		return res
+	}
+	if _, err := dao.GetShopById(ctx, dao.DB, req.ShopID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("商铺不存在")
+		}
+		return utils.ErrorResult("查询商铺失败: " + err.Error())
+	}
+
+	existing, err := dao.GetUserShopReview(ctx, dao.DB, userID, req.ShopID)
+	if err != nil {
+		return utils.ErrorResult("查询评价失败: " + err.Error())
+	}
+	if existing != nil {
+		return utils.ErrorResult("已评价过该商铺，可修改原评价")
+	}
+
+	review := &models.Review{
+		ShopID:  req.ShopID,
+		UserID:  userID,
+		Rating:  req.Rating,
+		Content: req.Content,
+		Images:  req.Images,
+	}
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// (shop_id, user_id) 唯一索引保证并发重复提交时只有一条成功
+	if err := dao.CreateReview(ctx, tx, review); err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return utils.ErrorResult("已评价过该商铺，可修改原评价")
+		}
+		return utils.ErrorResult("发布评价失败: " + err.Error())
+	}
+	mean, weight := reviewPrior()
+	if err := dao.UpdateShopRating(ctx, tx, req.ShopID, 1, req.Rating, mean, weight); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("更新商铺评分失败: " + err.Error())
+	}
+	if err := tx.Commit().Error; err != nil {
+		return utils.ErrorResult("事务提交失败")
+	}
+	return utils.SuccessResultWithData(review.ID)
+}
+
+// UpdateReview 修改自己的评价，评分变化时按差值更新商铺评分
+// EN: Edit one's own review and apply the rating difference to the shop
+func UpdateReview(ctx context.Context, userID, reviewID uint, req *ReviewRequest) *utils.Result {
+	if res := checkReviewImages(req.Images); res != nil {
+		return res
+	}
+
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	review, res := getOwnReviewForUpdate(ctx, tx, userID, reviewID)
+	if res != nil {
+		tx.Rollback()
+		return res
+	}
+	updated, err := dao.UpdateReviewFields(ctx, tx, reviewID, map[string]interface{}{
+		"rating":  req.Rating,
+		"content": req.Content,
+		"images":  req.Images,
+	})
+	if err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("修改评价失败: " + err.Error())
+	}
+	if !updated {
+		tx.Rollback()
+		return utils.ErrorResult("评价不存在")
+	}
+	if req.Rating != review.Rating {
+		mean, weight := reviewPrior()
+		if err := dao.UpdateShopRating(ctx, tx, review.ShopID, 0, req.Rating-review.Rating, mean, weight); err != nil {
+			tx.Rollback()
+			return utils.ErrorResult("更新商铺评分失败: " + err.Error())
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return utils.ErrorResult("事务提交失败")
+	}
+	return utils.SuccessResult("修改成功")
+}
+
+// DeleteReview 删除自己的评价，并从商铺评价汇总中扣除
+// EN: Delete one's own review and remove it from the shop's rating aggregate
+func DeleteReview(ctx context.Context, userID, reviewID uint) *utils.Result {
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	review, res := getOwnReviewForUpdate(ctx, tx, userID, reviewID)
+	if res != nil {
+		tx.Rollback()
+		return res
+	}
+	deleted, err := dao.DeleteReview(ctx, tx, reviewID)
+	if err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("删除评价失败: " + err.Error())
+	}
+	if !deleted {
+		tx.Rollback()
+		return utils.ErrorResult("评价不存在")
+	}
+	mean, weight := reviewPrior()
+	if err := dao.UpdateShopRating(ctx, tx, review.ShopID, -1, -review.Rating, mean, weight); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("更新商铺评分失败: " + err.Error())
+	}
+	if err := tx.Commit().Error; err != nil {
+		return utils.ErrorResult("事务提交失败")
+	}
+	return utils.SuccessResult("删除成功")
+}
+
+// getOwnReviewForUpdate 在事务中锁定评价并校验属于当前用户，并发的修改和删除按锁串行，
+// 商铺评分差值以锁定后读到的评分计算
+func getOwnReviewForUpdate(ctx context.Context, tx *gorm.DB, userID, reviewID uint) (*models.Review, *utils.Result) {
+	review, err := dao.GetReviewByIDForUpdate(ctx, tx, reviewID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrorResult("评价不存在")
+		}
+		return nil, utils.ErrorResult("查询评价失败: " + err.Error())
+	}
+	if review.UserID != userID {
+		return nil, utils.ErrorResult("只能操作自己的评价")
+	}
+	return review, nil
+}
+
+// ToggleReviewHelpful 标记/取消评价“有用”；在事务内锁定评价行，同一评价的标记操作串行执行，
+// 只有真正插入或删除了标记时才调整“有用”数
+// EN: Toggle the current user's "helpful" vote on a review
+func ToggleReviewHelpful(ctx context.Context, userID, reviewID uint) *utils.Result {
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := dao.GetReviewByIDForUpdate(ctx, tx, reviewID); err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("评价不存在")
+		}
+		return utils.ErrorResult("查询评价失败: " + err.Error())
+	}
+
+	helpful, err := dao.GetReviewHelpful(ctx, tx, userID, reviewID)
+	if err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("查询标记失败: " + err.Error())
+	}
+	message, delta := "已标记为有用", 1
+	changed := true
+	if helpful != nil {
+		message, delta = "已取消有用", -1
+		changed, err = dao.DeleteReviewHelpful(ctx, tx, helpful.ID)
+	} else {
+		// 唯一索引兜底：并发重复标记时只有一条成功，其余按已标记处理
+		err = dao.CreateReviewHelpful(ctx, tx, &models.ReviewHelpful{UserID: userID, ReviewID: reviewID})
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			changed, err = false, nil
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("操作失败: " + err.Error())
+	}
+	if !changed {
+		// 标记已被并发请求修改，结果与本次操作一致，不再调整“有用”数
+		tx.Rollback()
+		return utils.SuccessResult(message)
+	}
+	if err := dao.AdjustReviewHelpful(ctx, tx, reviewID, delta); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("更新有用数失败: " + err.Error())
+	}
+	if err := tx.Commit().Error; err != nil {
+		return utils.ErrorResult("事务提交失败")
+	}
+	return utils.SuccessResult(message)
+}
+
+// GetShopReviews 分页获取商铺评价，sort 为 newest（默认）或 helpful；登录用户返回是否标记过“有用”
+// EN: List a shop's reviews, newest first or most helpful first
+func GetShopReviews(ctx context.Context, shopID uint, sort string, page, size int, userID uint) *utils.Result {
+	if sort != dao.ReviewSortHelpful {
+		sort = dao.ReviewSortNewest
+	}
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 50 {
+		size = 10
+	}
+
+	reviews, total, err := dao.GetShopReviews(ctx, dao.DB, shopID, sort, (page-1)*size, size)
+	if err != nil {
+		return utils.ErrorResult("查询评价失败: " + err.Error())
+	}
+
+	if userID != 0 && len(reviews) > 0 {
+		ids := make([]uint, 0, len(reviews))
+		for _, r := range reviews {
+			ids = append(ids, r.ID)
+		}
+		helpful, err := dao.GetHelpfulReviewIDs(ctx, dao.DB, userID, ids)
+		if err != nil {
+			return utils.ErrorResult("查询评价失败: " + err.Error())
+		}
+		for i := range reviews {
+			reviews[i].IsHelpful = helpful[reviews[i].ID]
+		}
+	}
+
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"list":  reviews,
+		"total": total,
+		"page":  page,
+		"size":  size,
+		"sort":  sort,
+	})
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"dianping/config"
+	"dianping/dao"
+	"log"
+	"sync"
+	"time"
+)
+
+// 商铺 GEO 索引维护配置
+// EN: Shop geo index maintenance configuration
+var (
+	defaultGeoResyncInterval = time.Hour
+	geoResyncTimeout         = 10 * time.Minute
+	geoWriteTimeout          = 3 * time.Second
+	geoSyncOnce              sync.Once
+	geoStopChan              = make(chan struct{})
+	geoWg                    sync.WaitGroup
+)
+
+// geoResyncInterval 获取全量校正周期，小于0表示只在启动时加载一次
+func geoResyncInterval() time.Duration {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Geo.ResyncInterval != 0 {
+		return time.Duration(cfg.Geo.ResyncInterval) * time.Second
+	}
+	return defaultGeoResyncInterval
+}
+
+// StartShopGeoSync 订阅商铺的增删改，按数据库中的最新状态更新 GEO 索引（新增、移动、类型变更、删除）；
+// 启动时在后台全量加载一次，之后定期全量校正，不阻塞服务启动
+// EN: Keep the shop geo index in sync with shop writes, plus an async initial load and periodic resync
+func StartShopGeoSync() {
+	geoSyncOnce.Do(func() {
+		dao.OnTableChange("tb_shop", onShopGeoChange)
+
+		geoWg.Add(1)
+		go geoResyncLoop(geoResyncInterval())
+		log.Printf("商铺 GEO 索引同步任务已启动，校正周期: %v", geoResyncInterval())
+	})
+}
+
+// StopShopGeoSync 停止全量校正任务（用于优雅关闭）
+func StopShopGeoSync() {
+	close(geoStopChan)
+	geoWg.Wait()
+	log.Println("商铺 GEO 索引同步任务已停止")
+}
+
+// onShopGeoChange 在 GORM 回调中调用：立即同步一次，事务提交前可能读到旧数据，
+// 延迟双删的间隔后再同步一次
+func onShopGeoChange(event dao.ChangeEvent) {
+	if len(event.IDs) == 0 {
+		return
+	}
+	go syncShopLocations(event.IDs)
+	time.AfterFunc(doubleDeleteDelay(), func() {
+		syncShopLocations(event.IDs)
+	})
+}
+
+// syncShopLocations 按数据库中的最新状态更新商铺的 GEO 索引，已删除的商铺从索引中移除；
+// 失败只记录日志，由下次全量校正修正
+func syncShopLocations(ids []uint) {
+	ctx, cancel := context.WithTimeout(context.Background(), geoWriteTimeout)
+	defer cancel()
+
+	typeIDs, err := shopGeoTypeIDs(ctx)
+	if err != nil {
+		log.Printf("同步商铺 GEO 索引失败: %v", err)
+		return
+	}
+	shops, err := dao.GetShopsByIDs(ctx, dao.DB, ids)
+	if err != nil {
+		log.Printf("同步商铺 GEO 索引失败: ids=%v, err=%v", ids, err)
+		return
+	}
+
+	found := make(map[uint]bool, len(shops))
+	for i := range shops {
+		found[shops[i].ID] = true
+		if err := dao.UpsertShopLocation(ctx, dao.Redis, &shops[i], typeIDs); err != nil {
+			log.Printf("更新商铺 GEO 索引失败: id=%d, err=%v", shops[i].ID, err)
+		}
+	}
+	for _, id := range ids {
+		if found[id] {
+			continue
+		}
+		if err := dao.RemoveShopLocation(ctx, dao.Redis, id, typeIDs); err != nil {
+			log.Printf("移除商铺 GEO 索引失败: id=%d, err=%v", id, err)
+		}
+	}
+}
+
+// shopGeoTypeIDs 所有商铺类型ID，每个类型对应一个 GEO key
+func shopGeoTypeIDs(ctx context.Context) ([]uint, error) {
+	shopTypes, err := dao.GetShopTypeList(ctx, dao.DB)
+	if err != nil {
+		return nil, err
+	}
+	typeIDs := make([]uint, 0, len(shopTypes))
+	for _, st := range shopTypes {
+		typeIDs = append(typeIDs, st.ID)
+	}
+	return typeIDs, nil
+}
+
+// geoResyncLoop 启动后立即全量加载一次，之后按周期校正
+func geoResyncLoop(interval time.Duration) {
+	defer geoWg.Done()
+
+	resyncShopLocations()
+	if interval < 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-geoStopChan:
+			return
+		case <-ticker.C:
+			resyncShopLocations()
+		}
+	}
+}
+
+// resyncShopLocations 全量校正 GEO 索引：分批把数据库中的商铺写入所属类型的 key，
+// 再移除各 key 中已删除或已换类型的商铺。待移除的商铺会重新查库确认，避免误删校正期间新建的商铺
+func resyncShopLocations() {
+	ctx, cancel := context.WithTimeout(context.Background(), geoResyncTimeout)
+	defer cancel()
+
+	start := time.Now()
+	loaded, err := dao.LoadShopData(ctx, dao.DB, dao.Redis)
+	if err != nil {
+		log.Printf("全量加载商铺 GEO 索引失败: %v", err)
+		return
+	}
+	typeIDs, err := shopGeoTypeIDs(ctx)
+	if err != nil {
+		log.Printf("校正商铺 GEO 索引失败: %v", err)
+		return
+	}
+
+	removed := 0
+	for _, typeID := range typeIDs {
+		ids, err := dao.GetShopLocationIDs(ctx, dao.Redis, typeID)
+		if err != nil {
+			log.Printf("校正商铺 GEO 索引失败: typeId=%d, err=%v", typeID, err)
+			continue
+		}
+		var stale []uint
+		for _, id := range ids {
+			if t, ok := loaded[id]; !ok || t != typeID {
+				stale = append(stale, id)
+			}
+		}
+		if len(stale) == 0 {
+			continue
+		}
+
+		shops, err := dao.GetShopsByIDs(ctx, dao.DB, stale)
+		if err != nil {
+			log.Printf("校正商铺 GEO 索引失败: typeId=%d, err=%v", typeID, err)
+			continue
+		}
+		current := make(map[uint]uint, len(shops))
+		for _, shop := range shops {
+			current[shop.ID] = shop.TypeID
+		}
+		for _, id := range stale {
+			if t, ok := current[id]; ok && t == typeID {
+				continue
+			}
+			if err := dao.RemoveShopLocation(ctx, dao.Redis, id, []uint{typeID}); err != nil {
+				log.Printf("移除商铺 GEO 索引失败: id=%d, err=%v", id, err)
+				continue
+			}
+			removed++
+		}
+	}
+	log.Printf("商铺 GEO 索引校正完成: 商铺数=%d, 移除=%d, 耗时=%v", len(loaded), removed, time.Since(start))
+}
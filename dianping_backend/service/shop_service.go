@@ -5,54 +5,53 @@ import (
 	"dianping/dao"
 	"dianping/models"
 	"dianping/utils"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand/v2"
 	"net/url"
+	"sort"
+	"strconv"
 	"time"
-)
 
-var shopSF utils.SingleflightGroup
+	"gorm.io/gorm"
+)
 
 // GetShopById 根据ID获取商铺
 func GetShopById(ctx context.Context, id uint) *utils.Result {
-	// 1. 布隆过滤器检查，防止缓存击穿
+	// 1. 布隆过滤器检查，防止缓存击穿；过滤器不可用时跳过检查，由空值缓存兜底
 	flag, err := utils.CheckIDExistsWithRedis(ctx, dao.Redis, "shop", id)
 	if err != nil {
-		log.Fatalf("检查布隆过滤器失败: %v", err)
+		log.Printf("检查布隆过滤器失败，跳过检查: %v", err)
+		flag = true
 	}
 	if !flag {
 		// 布隆过滤器判断商铺不存在，直接返回
 		return utils.ErrorResult("商铺不存在")
 	}
+	shopHotKeys.Record(strconv.Itoa(int(id)))
 
-	// 2. 先读取带逻辑过期的缓存
-	if cached, fresh, err := dao.GetShopCacheByIdWithLogicalExpire(ctx, dao.Redis, id); err == nil && cached != nil {
-		if fresh {
-			return utils.SuccessResultWithData(cached)
-		}
-		go tryRebuildShopCache(context.Background(), id)
-		return utils.SuccessResultWithData(cached)
-	}
-
-	// 3. 使用 singleflight 合并并发重建
-	key := fmt.Sprintf("shop:%d", id)
-	val, err := shopSF.Do(key, func() (interface{}, error) {
-		if cached, fresh, err := dao.GetShopCacheByIdWithLogicalExpire(ctx, dao.Redis, id); err == nil && cached != nil {
-			if fresh {
-				return cached, nil
-			}
-		}
-		return loadAndFillShopCache(ctx, id)
+	// 2. 读取带逻辑过期的缓存（过期返回旧值并异步重建），未命中时互斥加载
+	shop, err := shopCache.GetWithLogicalExpire(ctx, strconv.Itoa(int(id)), func(ctx context.Context) (*models.Shop, error) {
+		return dao.GetShopById(ctx, dao.DB, id)
 	})
 	if err != nil {
+		if errors.Is(err, utils.ErrCacheNotFound) {
+			return utils.ErrorResult("商铺不存在")
+		}
 		return utils.ErrorResult("查询失败: " + err.Error())
 	}
-	return utils.SuccessResultWithData(val)
+	return utils.SuccessResultWithData(shop)
 }
 
 // UpdateShopById 根据ID更新商铺
 func UpdateShopById(ctx context.Context, shop *models.Shop) *utils.Result {
+	// 修改类型时校验类型存在
+	if shop.TypeID != 0 {
+		if res := checkShopType(ctx, shop.TypeID); res != nil {
+			return res
+		}
+	}
 
 	// 0. 启动事务
 	tx := dao.DB.Begin()
@@ -62,7 +61,13 @@ func UpdateShopById(ctx context.Context, shop *models.Shop) *utils.Result {
 		}
 	}()
 
-	// 1. 更新数据库
+	// 1. 更新数据库（修改类型时锁定类型行，防止类型被并发删除）
+	if shop.TypeID != 0 {
+		if res := lockShopType(ctx, tx, shop.TypeID); res != nil {
+			tx.Rollback()
+			return res
+		}
+	}
 	err := dao.UpdateShop(ctx, tx, shop)
 
 	// 2. 更新失败
@@ -77,12 +82,7 @@ func UpdateShopById(ctx context.Context, shop *models.Shop) *utils.Result {
 		return utils.ErrorResult("更新失败: " + err.Error())
 	}
 
-	// 4. 事务成功后删除缓存（最终一致性）
-	err = dao.DelShopCacheById(ctx, dao.Redis, shop.ID)
-	if err != nil {
-		// 记录日志但不影响业务结果
-		log.Printf("警告: 删除缓存失败，商铺ID=%d, 错误=%v", shop.ID, err)
-	}
+	// 4. 缓存由 tb_shop 的变更事件异步删除（立即删除 + 延迟双删，失败持久化重试）
 
 	// 5. 返回结果
 	return utils.SuccessResult("更新成功")
@@ -183,79 +183,15 @@ func GetNearbyShops(ctx context.Context, shopId uint, radius float64, count int)
 	return utils.SuccessResultWithData(shopIds)
 }
 
-func tryRebuildShopCache(ctx context.Context, id uint) {
-	lockKey := fmt.Sprintf("lock:shop:rebuild:%d", id)
-	ok, lockVal := utils.TryLockWithTTL(ctx, dao.Redis, lockKey, 5*time.Second)
-	if !ok {
-		return
-	}
-	defer utils.UnLockSafe(ctx, dao.Redis, lockKey, lockVal)
-	if _, err := loadAndFillShopCache(ctx, id); err != nil {
-		log.Printf("异步重建商铺缓存失败: %v", err)
+// CreateShop 创建商铺，商铺类型必须已存在（类型通过 /api/admin/shop-type 维护）
+func CreateShop(ctx context.Context, shop *models.Shop) *utils.Result {
+	if res := checkShopType(ctx, shop.TypeID); res != nil {
+		return res
 	}
-}
-
-func loadAndFillShopCache(ctx context.Context, id uint) (*models.Shop, error) {
-	lockKey := fmt.Sprintf("lock:shop:%d", id)
-	ok, lockVal := utils.TryLockWithTTL(ctx, dao.Redis, lockKey, 5*time.Second)
-	if !ok {
-		base := 50 * time.Millisecond
-		waited := time.Duration(0)
-		for i := 0; i < 5 && waited < 500*time.Millisecond; i++ {
-			time.Sleep(base)
-			waited += base
-			base *= 2
-			if base > 200*time.Millisecond {
-				base = 200 * time.Millisecond
-			}
-			if cached, _, err := dao.GetShopCacheByIdWithLogicalExpire(ctx, dao.Redis, id); err == nil && cached != nil {
-				return cached, nil
-			}
-		}
-		var retry bool
-		retry, lockVal = utils.TryLockWithTTL(ctx, dao.Redis, lockKey, 3*time.Second)
-		if !retry {
-			if cached, _, err := dao.GetShopCacheByIdWithLogicalExpire(ctx, dao.Redis, id); err == nil && cached != nil {
-				return cached, nil
-			}
-			return nil, fmt.Errorf("服务繁忙")
-		}
-		ok = true
-	}
-	defer func() {
-		if ok {
-			utils.UnLockSafe(ctx, dao.Redis, lockKey, lockVal)
-		}
-	}()
-
-	shop, err := dao.GetShopById(ctx, dao.DB, id)
-	if err != nil {
-		return nil, err
-	}
-
-	ttlMinutes := 30 + (rand.IntN(10) - 5)
-	if ttlMinutes < 5 {
-		ttlMinutes = 5
-	}
-	expireAt := time.Now().Add(time.Duration(ttlMinutes) * time.Minute).Unix()
-	realTTL := 24 * time.Hour
-	if err := dao.SetShopCacheByIdWithLogicalExpire(ctx, dao.Redis, id, shop, expireAt, realTTL); err != nil {
-		log.Printf("设置逻辑过期缓存失败: %v", err)
-	}
-	return shop, nil
-}
 
-// CreateShopWithType 创建类型商铺
-
-func CreateShopWithType(ctx context.Context, shop *models.Shop, typeIcon string) *utils.Result {
-	//使用本地 mutex 限制同进程并发
-	shopTypeListLocalLock.Lock()
-	defer shopTypeListLocalLock.Unlock()
-
-	// 使用按 name 的分布式锁，避免并发创建重复的 ShopType
-	typeName := shop.Name
+	// 使用按 name 的分布式锁，避免并发重复创建同一个商铺
 	//通过escape 转义特殊字符
-	lockKey := fmt.Sprintf("lock:shop_type:name:%s", url.QueryEscape(typeName))
+	lockKey := fmt.Sprintf("lock:shop:name:%s", url.QueryEscape(shop.Name))
 	ok, lockValue := utils.TryLockWithTTL(ctx, dao.Redis, lockKey, 5*time.Second)
 	if !ok {
 		maxWait := 1000 * time.Millisecond
@@ -289,7 +225,7 @@ func CreateShopWithType(ctx context.Context, shop *models.Shop, typeIcon string)
 		// 拿到锁，确保释放
 		defer func() {
 			if ok := utils.UnLockSafe(ctx, dao.Redis, lockKey, lockValue); !ok {
-				log.Printf("警告: 释放 shop_type:name 锁失败: %s", typeName)
+				log.Printf("警告: 释放 shop:name 锁失败: %s", shop.Name)
 			}
 		}()
 	}
@@ -300,47 +236,321 @@ func CreateShopWithType(ctx context.Context, shop *models.Shop, typeIcon string)
 		return utils.SuccessResultWithData(existing)
 	}
 
-	// 没有则创建shop
+	// 没有则创建shop（布隆过滤器由 tb_shop 的变更事件更新），事务内锁定类型行，防止类型被并发删除
 	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
 		}
 	}()
-
+	if res := lockShopType(ctx, tx, shop.TypeID); res != nil {
+		tx.Rollback()
+		return res
+	}
 	if err := dao.CreateShop(ctx, tx, shop); err != nil {
 		tx.Rollback()
 		return utils.ErrorResult("创建商铺失败: " + err.Error())
 	}
+	if err := tx.Commit().Error; err != nil {
+		return utils.ErrorResult("事务提交失败")
+	}
+
+	return utils.SuccessResultWithData(shop.ID)
+}
+
+// SearchShopRequest 商铺搜索请求，未传的条件不过滤
+// EN: Query parameters of /api/shop/search
+type SearchShopRequest struct {
+	Keyword  string   `form:"keyword" binding:"omitempty,max=64"`
+	TypeID   uint     `form:"typeId"`
+	Area     string   `form:"area"`
+	MinPrice int      `form:"minPrice" binding:"omitempty,min=0"`
+	MaxPrice int      `form:"maxPrice" binding:"omitempty,min=0"`
+	MinScore int      `form:"minScore" binding:"omitempty,min=0"`
+	OpenNow  bool     `form:"openNow"`
+	Sort     string   `form:"sort" binding:"omitempty,oneof=score sold comments price priceDesc distance"`
+	X        *float64 `form:"x" binding:"omitempty,min=-180,max=180"` // 经度
+	Y        *float64 `form:"y" binding:"omitempty,min=-90,max=90"`   // 纬度
+	Current  int      `form:"current" binding:"omitempty,min=1"`
+	Size     int      `form:"size" binding:"omitempty,min=1,max=50"`
+}
+
+// SearchShops 组合搜索商铺：关键词匹配名称、商圈、地址（全文索引，不可用时退化为 LIKE），
+// 可按类型、商圈、人均价格区间、评分、是否营业中过滤，按评分、销量、评论数、价格或距离排序
+// EN: Keyword search with filters and sorting; distance sort requires x/y
+func SearchShops(ctx context.Context, req *SearchShopRequest) *utils.Result {
+	if req.MinPrice > 0 && req.MaxPrice > 0 && req.MinPrice > req.MaxPrice {
+		return utils.ErrorResult("最低价格不能大于最高价格")
+	}
+	if (req.X == nil) != (req.Y == nil) {
+		return utils.ErrorResult("经纬度需要同时传入")
+	}
+	if req.Sort == dao.ShopSortDistance && req.X == nil {
+		return utils.ErrorResult("按距离排序需要传入经纬度")
+	}
+	if req.Current == 0 {
+		req.Current = 1
+	}
+	if req.Size == 0 {
+		req.Size = 10
+	}
 
-	st := &models.ShopType{
-		Name:   typeName,
-		Icon:   typeIcon,
-		TypeID: shop.TypeID,
+	q := &dao.ShopSearchQuery{
+		Keyword:  req.Keyword,
+		TypeID:   req.TypeID,
+		Area:     req.Area,
+		MinPrice: req.MinPrice,
+		MaxPrice: req.MaxPrice,
+		MinScore: req.MinScore,
+		OpenNow:  req.OpenNow,
+		Now:      time.Now(),
+		Sort:     req.Sort,
+		Page:     req.Current,
+		Size:     req.Size,
 	}
-	if err := dao.CreateShopType(ctx, tx, st); err != nil {
+	if req.X != nil {
+		q.X, q.Y, q.HasLocation = *req.X, *req.Y, true
+	}
+
+	shops, total, err := dao.SearchShops(ctx, dao.DB, q)
+	if err != nil {
+		return utils.ErrorResult("搜索商铺失败: " + err.Error())
+	}
+
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"list":  shops,
+		"total": total,
+		"page":  req.Current,
+		"size":  req.Size,
+	})
+}
+
+// 附近商铺分页限制：GEOSEARCH 不支持偏移，每页需要取出游标之前的全部结果
+const (
+	nearbyDefaultRadius = 5.0  // 默认搜索半径（千米）
+	nearbyMaxScan       = 1000 // 游标 + 每页数量的上限
+)
+
+// NearbyShopRequest 按用户坐标查询附近商铺的请求，cursor 为上一页返回的 nextCursor
+// EN: Query parameters of /api/shop/nearby
+type NearbyShopRequest struct {
+	X      *float64 `form:"x" binding:"required,min=-180,max=180"` // 经度
+	Y      *float64 `form:"y" binding:"required,min=-90,max=90"`   // 纬度
+	TypeID uint     `form:"typeId"`
+	Radius float64  `form:"radius" binding:"omitempty,gt=0,max=50"` // 千米
+	Cursor int      `form:"cursor" binding:"omitempty,min=0"`
+	Size   int      `form:"size" binding:"omitempty,min=1,max=50"`
+}
+
+// GetShopsNearLocation 查询用户坐标附近的商铺，按距离升序返回商铺详情与距离（米）；
+// 不传 typeId 时合并所有类型。GEOSEARCH 没有偏移参数，按游标 + 每页数量取出结果后跳过游标之前的部分
+// EN: Shops near the user's location with distance, cursor paged
+func GetShopsNearLocation(ctx context.Context, req *NearbyShopRequest) *utils.Result {
+	if req.Radius == 0 {
+		req.Radius = nearbyDefaultRadius
+	}
+	if req.Size == 0 {
+		req.Size = 10
+	}
+	if req.Cursor+req.Size > nearbyMaxScan {
+		return utils.ErrorResult(fmt.Sprintf("最多查询附近 %d 个商铺", nearbyMaxScan))
+	}
+
+	typeIDs := []uint{req.TypeID}
+	if req.TypeID == 0 {
+		shopTypes, err := dao.GetShopTypeList(ctx, dao.DB)
+		if err != nil {
+			return utils.ErrorResult("查询商铺类型失败: " + err.Error())
+		}
+		typeIDs = typeIDs[:0]
+		for _, st := range shopTypes {
+			typeIDs = append(typeIDs, st.ID)
+		}
+	}
+
+	// 多取一个用于判断是否还有下一页
+	count := req.Cursor + req.Size + 1
+	var found []dao.ShopDistance
+	for _, typeID := range typeIDs {
+		results, err := dao.SearchShopLocations(ctx, dao.Redis, typeID, *req.X, *req.Y, req.Radius*1000, count)
+		if err != nil {
+			return utils.ErrorResult("查询附近商铺失败: " + err.Error())
+		}
+		found = append(found, results...)
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Distance < found[j].Distance })
+
+	hasMore := len(found) > req.Cursor+req.Size
+	if len(found) > count-1 {
+		found = found[:count-1]
+	}
+	if req.Cursor < len(found) {
+		found = found[req.Cursor:]
+	} else {
+		found = nil
+	}
+
+	ids := make([]uint, 0, len(found))
+	for _, f := range found {
+		ids = append(ids, f.ShopID)
+	}
+	shops, err := dao.GetShopsByIDs(ctx, dao.DB, ids)
+	if err != nil {
+		return utils.ErrorResult("查询商铺失败: " + err.Error())
+	}
+	byID := make(map[uint]models.Shop, len(shops))
+	for _, shop := range shops {
+		byID[shop.ID] = shop
+	}
+
+	// 按 GEO 结果的距离顺序组装，数据库中已不存在的商铺跳过
+	list := make([]dao.ShopSearchItem, 0, len(found))
+	for _, f := range found {
+		shop, ok := byID[f.ShopID]
+		if !ok {
+			continue
+		}
+		distance := f.Distance
+		list = append(list, dao.ShopSearchItem{Shop: shop, Distance: &distance})
+	}
+
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"list":       list,
+		"nextCursor": req.Cursor + len(found),
+		"hasMore":    hasMore,
+	})
+}
+
+// DeleteShop 软删除商铺，并把上架中的优惠券标记为商铺已删除（秒杀券同步更新 Redis 状态，下单时返回已下架）。
+// 商铺缓存、GEO 索引、布隆过滤器由 tb_shop 的变更事件更新，搜索结果按软删除自动过滤
+// EN: Soft-delete a shop and hide its on-shelf vouchers
+func DeleteShop(ctx context.Context, id uint) *utils.Result {
+	if _, err := dao.GetShopById(ctx, dao.DB, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("商铺不存在")
+		}
+		return utils.ErrorResult("查询商铺失败: " + err.Error())
+	}
+
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := dao.DeleteShop(ctx, tx, id); err != nil {
 		tx.Rollback()
-		return utils.ErrorResult("创建商铺类型失败: " + err.Error())
+		return utils.ErrorResult("删除商铺失败: " + err.Error())
 	}
-	// 用回写ID的方式设置 Sort = int(st.ID)
-	st.Sort = int(st.ID)
-	st.ShopId = shop.ID
-	if err := dao.UpdateShopType(ctx, tx, st); err != nil {
+	vouchers, err := dao.SetShopVouchersStatus(ctx, tx, id, models.VoucherStatusOnShelf, models.VoucherStatusShopDeleted)
+	if err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("下架优惠券失败: " + err.Error())
+	}
+	if err := setShopSeckillStatusCache(ctx, vouchers, models.VoucherStatusShopDeleted); err != nil {
 		tx.Rollback()
-		return utils.ErrorResult("更新 ShopType Sort 失败: " + err.Error())
+		return utils.ErrorResult("更新秒杀券缓存失败")
 	}
 
 	if err := tx.Commit().Error; err != nil {
+		// 数据库未更新，恢复缓存中的状态
+		if err := setShopSeckillStatusCache(ctx, vouchers, models.VoucherStatusOnShelf); err != nil {
+			log.Printf("警告: 恢复秒杀券状态缓存失败, shopID=%d, 错误=%v", id, err)
+		}
+		return utils.ErrorResult("事务提交失败")
+	}
+	return utils.SuccessResult("删除成功")
+}
+
+// RestoreShop 恢复已删除的商铺，因删除商铺而隐藏的优惠券重新上架；
+// 商铺类型需要仍然存在，且没有同名同地址的商铺。更新事件不会写入布隆过滤器，恢复后单独加入
+// EN: Restore a soft-deleted shop and put its hidden vouchers back on the shelf
+func RestoreShop(ctx context.Context, id uint) *utils.Result {
+	shop, err := dao.GetDeletedShopById(ctx, dao.DB, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("商铺不存在或未删除")
+		}
+		return utils.ErrorResult("查询商铺失败: " + err.Error())
+	}
+	if res := checkShopType(ctx, shop.TypeID); res != nil {
+		return res
+	}
+	if existing, err := dao.GetShopByNameAndAddress(ctx, dao.DB, shop.Name, shop.Address); err == nil && existing != nil {
+		return utils.ErrorResult(fmt.Sprintf("已存在同名同地址的商铺: %d", existing.ID))
+	}
+
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if res := lockShopType(ctx, tx, shop.TypeID); res != nil {
+		tx.Rollback()
+		return res
+	}
+	restored, err := dao.RestoreShop(ctx, tx, id)
+	if err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("恢复商铺失败: " + err.Error())
+	}
+	if !restored {
+		tx.Rollback()
+		return utils.ErrorResult("商铺不存在或未删除")
+	}
+	vouchers, err := dao.SetShopVouchersStatus(ctx, tx, id, models.VoucherStatusShopDeleted, models.VoucherStatusOnShelf)
+	if err != nil {
 		tx.Rollback()
-		return utils.ErrorResult("提交事务失败: " + err.Error())
+		return utils.ErrorResult("上架优惠券失败: " + err.Error())
+	}
+	if err := setShopSeckillStatusCache(ctx, vouchers, models.VoucherStatusOnShelf); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("更新秒杀券缓存失败")
 	}
 
-	go func(id uint) {
-		bf := utils.CreateShopBloomFilter(dao.Redis)
-		if _, err := bf.AddID(context.Background(), id); err != nil {
-			log.Printf("添加商铺ID到Bloom失败: %v", err)
+	if err := tx.Commit().Error; err != nil {
+		if err := setShopSeckillStatusCache(ctx, vouchers, models.VoucherStatusShopDeleted); err != nil {
+			log.Printf("警告: 恢复秒杀券状态缓存失败, shopID=%d, 错误=%v", id, err)
 		}
-	}(shop.ID)
+		return utils.ErrorResult("事务提交失败")
+	}
 
-	return utils.SuccessResultWithData(shop.ID)
+	applyBloomChange("shop", dao.ChangeEvent{Table: "tb_shop", Op: dao.ChangeOpCreate, IDs: []uint{id}})
+	return utils.SuccessResult("恢复成功")
+}
+
+// setShopSeckillStatusCache 更新商铺秒杀券在 Redis 中的状态；重新上架时库存缓存可能已过期，按数据库库存重建
+func setShopSeckillStatusCache(ctx context.Context, vouchers []models.Voucher, status int) error {
+	for _, v := range vouchers {
+		if v.Type != 1 {
+			continue
+		}
+		if status == models.VoucherStatusOnShelf {
+			if _, exists, err := dao.GetSeckillVoucherStockCache(ctx, dao.Redis, v.ID); err != nil || !exists {
+				seckillVoucher, err := dao.GetSeckillVoucherByID(v.ID)
+				if err != nil {
+					return err
+				}
+				if err := rebuildSeckillStockCache(ctx, seckillVoucher, status); err != nil {
+					return err
+				}
+			}
+		}
+		if err := dao.SetSeckillVoucherStatusCache(ctx, dao.Redis, v.ID, status); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -3,87 +3,220 @@ package service
 import (
 	"context"
 	"dianping/dao"
+	"dianping/models"
 	"dianping/utils"
-	"log"
-	"math/rand/v2"
-	"sync"
+	"errors"
+	"fmt"
+	"net/url"
 	"time"
-)
 
-var shopTypeListLocalLock sync.Mutex
+	"gorm.io/gorm"
+)
 
-// GetShopTypeList 获取商铺类型列表，防止缓存击穿使用本地+分布式混合锁
+// GetShopTypeList 获取商铺类型列表，缓存未命中时只有拿到分布式锁的实例查询数据库，防止缓存击穿
 func GetShopTypeList(ctx context.Context) *utils.Result {
-	// 1) 先从缓存中获取 无竞争 缓存正常
-	shopTypes, err := dao.GetShopTypeListCache(ctx, dao.Redis)
-	if err == nil {
-		return utils.SuccessResultWithData(shopTypes)
+	shopTypes, err := shopTypeCache.GetWithMutex(ctx, "", func(ctx context.Context) ([]*models.ShopType, error) {
+		return dao.GetShopTypeList(ctx, dao.DB)
+	})
+	if err != nil {
+		// 等待重建超时等情况兜底去 DB 直接读取
+		shopTypes, err = dao.GetShopTypeList(ctx, dao.DB)
+		if err != nil {
+			return utils.ErrorResult("查询失败: " + err.Error())
+		}
 	}
+	return utils.SuccessResultWithData(shopTypes)
+}
 
-	// 2) 使用本地 mutex 限制同进程并发
-	shopTypeListLocalLock.Lock()
-	defer shopTypeListLocalLock.Unlock()
+// CreateShopType 新增商铺类型，sort 不大于0时排在最后
+// 类型列表缓存由 tb_shop_type 的变更事件删除
+// EN: Create a shop type; appended to the end when sort is not given
+func CreateShopType(ctx context.Context, name, icon string, sort int) *utils.Result {
+	// 按名称加分布式锁，避免并发创建同名类型
+	lockKey := fmt.Sprintf("lock:shop_type:name:%s", url.QueryEscape(name))
+	ok, lockValue := utils.TryLockWithTTL(ctx, dao.Redis, lockKey, 5*time.Second)
+	if !ok {
+		return utils.ErrorResult("操作过于频繁，请稍后重试")
+	}
+	defer utils.UnLockSafe(ctx, dao.Redis, lockKey, lockValue)
 
-	// 双重检查缓存 防止同进程内的多个协程重复获取锁，此时可能缓存已经被其他协程回写
-	shopTypes, err = dao.GetShopTypeListCache(ctx, dao.Redis)
-	if err == nil {
-		return utils.SuccessResultWithData(shopTypes)
+	existing, err := dao.GetShopTypeByName(ctx, dao.DB, name)
+	if err != nil {
+		return utils.ErrorResult("查询商铺类型失败: " + err.Error())
+	}
+	if existing != nil {
+		return utils.ErrorResult("商铺类型已存在")
 	}
 
-	// 3) 尝试获取分布式锁，只有拿到锁的实例去查询数据库并回写缓存
-	lockKey := "lock:shop_type:list"
-	ok, lockValue := utils.TryLockWithTTL(ctx, dao.Redis, lockKey, 5*time.Second)
-	if !ok {
-		maxWait := 1000 * time.Millisecond
-		base := 50 * time.Millisecond
-		waited := time.Duration(0)
-		for waited <= maxWait {
-			shopTypes, err = dao.GetShopTypeListCache(ctx, dao.Redis)
-			if err == nil {
-				return utils.SuccessResultWithData(shopTypes)
-			}
-			//尝试再拿锁
-			if ok2, lockValue2 := utils.TryLockWithTTL(ctx, dao.Redis, lockKey, 5*time.Second); ok2 {
-				lockValue = lockValue2
-				break
-			}
-			// 等待指数退避+随机抖动
-			sleep := base + time.Duration(rand.IntN(50))*time.Millisecond
-			time.Sleep(sleep)
-			waited += sleep
-			base *= 2
-			if base > 500*time.Millisecond {
-				base = 500 * time.Millisecond
-			}
+	if sort <= 0 {
+		maxSort, err := dao.GetMaxShopTypeSort(ctx, dao.DB)
+		if err != nil {
+			return utils.ErrorResult("查询商铺类型失败: " + err.Error())
 		}
-		// 兜底去 DB 直接读取
-		shopTypes, err = dao.GetShopTypeList(ctx, dao.DB)
+		sort = maxSort + 1
+	}
+
+	st := &models.ShopType{Name: name, Icon: icon, Sort: sort}
+	if err := dao.CreateShopType(ctx, dao.DB, st); err != nil {
+		return utils.ErrorResult("创建商铺类型失败: " + err.Error())
+	}
+	return utils.SuccessResultWithData(st)
+}
+
+// UpdateShopType 修改商铺类型的名称、图标或排序，参数为 nil 表示不修改
+// EN: Partially update a shop type
+func UpdateShopType(ctx context.Context, id uint, name, icon *string, sort *int) *utils.Result {
+	if res := checkShopType(ctx, id); res != nil {
+		return res
+	}
+
+	fields := map[string]interface{}{}
+	if name != nil {
+		existing, err := dao.GetShopTypeByName(ctx, dao.DB, *name)
 		if err != nil {
-			return utils.ErrorResult("查询失败: " + err.Error())
+			return utils.ErrorResult("查询商铺类型失败: " + err.Error())
+		}
+		if existing != nil && existing.ID != id {
+			return utils.ErrorResult("商铺类型名称已存在")
+		}
+		fields["name"] = *name
+	}
+	if icon != nil {
+		fields["icon"] = *icon
+	}
+	if sort != nil {
+		fields["sort"] = *sort
+	}
+	if len(fields) == 0 {
+		return utils.ErrorResult("没有需要修改的字段")
+	}
+
+	if err := dao.UpdateShopTypeFields(ctx, dao.DB, id, fields); err != nil {
+		return utils.ErrorResult("更新商铺类型失败: " + err.Error())
+	}
+	return utils.SuccessResult("更新成功")
+}
+
+// ReorderShopTypes 调整商铺类型顺序：ids 中的类型依次排在最前（sort 从1开始），
+// 未列出的类型保持原有相对顺序排在后面
+// EN: Reorder shop types; unlisted types keep their relative order after the listed ones
+func ReorderShopTypes(ctx context.Context, ids []uint) *utils.Result {
+	shopTypes, err := dao.GetShopTypeList(ctx, dao.DB)
+	if err != nil {
+		return utils.ErrorResult("查询商铺类型失败: " + err.Error())
+	}
+	byID := make(map[uint]*models.ShopType, len(shopTypes))
+	for _, st := range shopTypes {
+		byID[st.ID] = st
+	}
+
+	listed := make(map[uint]bool, len(ids))
+	order := make([]*models.ShopType, 0, len(shopTypes))
+	for _, id := range ids {
+		st, ok := byID[id]
+		if !ok {
+			return utils.ErrorResult(fmt.Sprintf("商铺类型不存在: %d", id))
+		}
+		if listed[id] {
+			return utils.ErrorResult(fmt.Sprintf("商铺类型重复: %d", id))
+		}
+		listed[id] = true
+		order = append(order, st)
+	}
+	for _, st := range shopTypes {
+		if !listed[st.ID] {
+			order = append(order, st)
 		}
-		return utils.SuccessResultWithData(shopTypes)
 	}
-	// 拿到分布式锁，确保释放
+
+	tx := dao.DB.Begin()
 	defer func() {
-		if ok := utils.UnLockSafe(ctx, dao.Redis, lockKey, lockValue); !ok {
-			log.Printf("警告: 释放 shop_type:list 锁失败")
+		if r := recover(); r != nil {
+			tx.Rollback()
 		}
 	}()
+	for i, st := range order {
+		if st.Sort == i+1 {
+			continue
+		}
+		if err := dao.UpdateShopTypeFields(ctx, tx, st.ID, map[string]interface{}{"sort": i + 1}); err != nil {
+			tx.Rollback()
+			return utils.ErrorResult("更新排序失败: " + err.Error())
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return utils.ErrorResult("更新排序失败: " + err.Error())
+	}
+	return utils.SuccessResult("排序已更新")
+}
+
+// DeleteShopType 删除商铺类型，类型下还有商铺（包括已软删除、可恢复的商铺）时拒绝删除；
+// 在同一事务中锁定类型行后统计并删除，创建、修改、恢复商铺时对类型行加共享锁，不会产生引用已删除类型的商铺。
+// 类型列表缓存和该类型的商铺 GEO key 由 tb_shop_type 的变更事件删除
+// EN: Delete an unused shop type
+func DeleteShopType(ctx context.Context, id uint) *utils.Result {
+	if res := checkShopType(ctx, id); res != nil {
+		return res
+	}
 
-	// 再次双重检查缓存，防止重复 DB 查询
-	shopTypes, err = dao.GetShopTypeListCache(ctx, dao.Redis)
-	if err == nil {
-		return utils.SuccessResultWithData(shopTypes)
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
 	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
 
-	// 真正从数据库读取并回写缓存
-	shopTypes, err = dao.GetShopTypeList(ctx, dao.DB)
+	if _, err := dao.GetShopTypeForUpdate(ctx, tx, id); err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("商铺类型不存在")
+		}
+		return utils.ErrorResult("查询商铺类型失败: " + err.Error())
+	}
+	count, err := dao.CountShopsByType(ctx, tx, id)
 	if err != nil {
-		return utils.ErrorResult("查询失败: " + err.Error())
+		tx.Rollback()
+		return utils.ErrorResult("查询商铺数量失败: " + err.Error())
 	}
-	if err = dao.SetShopTypeListCache(ctx, dao.Redis, shopTypes); err != nil {
-		log.Printf("警告: 设置 ShopType 缓存失败: %v", err)
+	if count > 0 {
+		tx.Rollback()
+		return utils.ErrorResult(fmt.Sprintf("该类型下还有 %d 个商铺（含已删除可恢复的商铺），不能删除", count))
 	}
 
-	return utils.SuccessResultWithData(shopTypes)
+	if err := dao.DeleteShopType(ctx, tx, id); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("删除商铺类型失败: " + err.Error())
+	}
+	if err := tx.Commit().Error; err != nil {
+		return utils.ErrorResult("事务提交失败")
+	}
+	return utils.SuccessResult("删除成功")
+}
+
+// lockShopType 在事务中对商铺类型加共享锁并校验存在，阻止写入商铺期间类型被删除
+func lockShopType(ctx context.Context, tx *gorm.DB, typeID uint) *utils.Result {
+	if _, err := dao.GetShopTypeForShare(ctx, tx, typeID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("商铺类型不存在")
+		}
+		return utils.ErrorResult("查询商铺类型失败: " + err.Error())
+	}
+	return nil
+}
+
+// checkShopType 校验商铺类型存在，存在时返回 nil
+func checkShopType(ctx context.Context, typeID uint) *utils.Result {
+	if typeID == 0 {
+		return utils.ErrorResult("商铺类型不能为空")
+	}
+	if _, err := dao.GetShopTypeByID(ctx, dao.DB, typeID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("商铺类型不存在")
+		}
+		return utils.ErrorResult("查询商铺类型失败: " + err.Error())
+	}
+	return nil
 }
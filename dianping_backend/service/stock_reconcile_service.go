@@ -0,0 +1,372 @@
+package service
+
+import (
+	"context"
+	"dianping/config"
+	"dianping/dao"
+	"dianping/models"
+	"dianping/utils"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// 秒杀库存对账相关配置
+// EN: Seckill stock reconciler configuration
+var (
+	defaultReconcileInterval = 5 * time.Minute
+	reconcileLockKey         = "lock:reconcile:seckill_stock"
+	reconcileLockTTL         = time.Minute
+	reconcileOnce            sync.Once
+	reconcileStopChan        = make(chan struct{})
+	reconcileWg              sync.WaitGroup
+	reconcileMaxUserReports  = 100 // 每个秒杀券报告中最多列出的已购数量不一致用户数
+
+	lastReconcileMu     sync.RWMutex
+	lastReconcileReport *StockReconcileReport
+)
+
+// StockDiscrepancy 单个秒杀券的对账结果
+// 预期关系：Redis 库存 + 在途件数 = tb_seckill_voucher.stock = tb_voucher.stock；
+// 每个用户在 Redis 中的已购数量 = 该用户未取消、未退款的订单件数 + 在途件数
+type StockDiscrepancy struct {
+	VoucherID      uint                 `json:"voucherId"`
+	RedisStock     *int64               `json:"redisStock"` // nil 表示缓存不存在
+	InFlight       int                  `json:"inFlight"`   // 已预扣但订单尚未创建的件数
+	MySQLStock     int                  `json:"mysqlStock"` // tb_seckill_voucher.stock
+	VoucherStock   int                  `json:"voucherStock"`
+	SoldQuantity   int                  `json:"soldQuantity"`   // tb_voucher_order 中未取消、未退款的件数
+	BoughtQuantity int                  `json:"boughtQuantity"` // Redis 已购数量 hash 的合计
+	Diff           int64                `json:"diff"`           // Redis 库存 + 在途件数 - MySQL 库存
+	BoughtDiff     int                  `json:"boughtDiff"`     // Redis 已购合计 - (订单件数 + 在途件数)
+	UserMismatches []UserBoughtMismatch `json:"userMismatches,omitempty"`
+	Issues         []string             `json:"issues"`
+	Repaired       bool                 `json:"repaired"`
+	RepairError    string               `json:"repairError,omitempty"`
+}
+
+// UserBoughtMismatch Redis 中用户已购数量与订单不一致的用户
+type UserBoughtMismatch struct {
+	UserID   uint `json:"userId"`
+	Bought   int  `json:"bought"`   // Redis 已购数量
+	Ordered  int  `json:"ordered"`  // 未取消、未退款的订单件数
+	InFlight int  `json:"inFlight"` // 在途件数
+}
+
+// diff 已购数量与订单件数 + 在途件数的差值
+func (m UserBoughtMismatch) diff() int {
+	return m.Bought - m.Ordered - m.InFlight
+}
+
+// StockReconcileReport 一次对账的报告
+type StockReconcileReport struct {
+	CheckedAt     time.Time          `json:"checkedAt"`
+	Checked       int                `json:"checked"`
+	Discrepancies []StockDiscrepancy `json:"discrepancies"`
+	Repair        bool               `json:"repair"`
+}
+
+// reconcileInterval 获取对账周期，小于0表示关闭定时对账
+func reconcileInterval() time.Duration {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Reconcile.Interval != 0 {
+		return time.Duration(cfg.Reconcile.Interval) * time.Second
+	}
+	return defaultReconcileInterval
+}
+
+// StartStockReconciler 启动秒杀库存定时对账
+// EN: Start the periodic Redis-vs-MySQL seckill stock reconciler
+func StartStockReconciler() {
+	reconcileOnce.Do(func() {
+		interval := reconcileInterval()
+		if interval < 0 {
+			log.Println("秒杀库存定时对账已关闭")
+			return
+		}
+		reconcileWg.Add(1)
+		go reconcileLoop(interval)
+		log.Printf("秒杀库存对账任务已启动，周期: %v", interval)
+	})
+}
+
+// StopStockReconciler 停止定时对账（用于优雅关闭）
+func StopStockReconciler() {
+	close(reconcileStopChan)
+	reconcileWg.Wait()
+	log.Println("秒杀库存对账任务已停止")
+}
+
+// reconcileLoop 定时对账循环
+func reconcileLoop(interval time.Duration) {
+	defer reconcileWg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-reconcileStopChan:
+			return
+		case <-ticker.C:
+			autoRepair := false
+			if cfg := config.GetConfig(); cfg != nil {
+				autoRepair = cfg.Reconcile.AutoRepair
+			}
+			report, err := runStockReconcile(context.Background(), autoRepair)
+			if err != nil {
+				log.Printf("秒杀库存对账失败: %v", err)
+				continue
+			}
+			if len(report.Discrepancies) > 0 {
+				log.Printf("秒杀库存对账发现 %d 个不一致的秒杀券", len(report.Discrepancies))
+			}
+		}
+	}
+}
+
+// GetStockReconcileReport 获取最近一次对账报告，refresh 为 true 时立即重新对账（只报告不修复）
+// EN: Latest reconcile report (or a fresh report-only run)
+func GetStockReconcileReport(ctx context.Context, refresh bool) *utils.Result {
+	if !refresh {
+		lastReconcileMu.RLock()
+		report := lastReconcileReport
+		lastReconcileMu.RUnlock()
+		if report != nil {
+			return utils.SuccessResultWithData(report)
+		}
+	}
+
+	report, err := runStockReconcile(ctx, false)
+	if err != nil {
+		return utils.ErrorResult("对账失败: " + err.Error())
+	}
+	return utils.SuccessResultWithData(report)
+}
+
+// RepairSeckillStock 立即对账并修复不一致的库存
+// EN: Reconcile now and repair discrepancies under the distributed lock
+func RepairSeckillStock(ctx context.Context) *utils.Result {
+	report, err := runStockReconcile(ctx, true)
+	if err != nil {
+		return utils.ErrorResult("修复失败: " + err.Error())
+	}
+	return utils.SuccessResultWithData(report)
+}
+
+// runStockReconcile 在分布式锁内执行一次对账，多实例下同一时刻只有一个实例对账
+func runStockReconcile(ctx context.Context, repair bool) (*StockReconcileReport, error) {
+	ok, lockVal := utils.TryLockWithTTL(ctx, dao.Redis, reconcileLockKey, reconcileLockTTL)
+	if !ok {
+		return nil, fmt.Errorf("其他实例正在对账，请稍后重试")
+	}
+	defer utils.UnLockSafe(ctx, dao.Redis, reconcileLockKey, lockVal)
+
+	vouchers, err := dao.GetActiveSeckillVouchers(ctx, dao.DB)
+	if err != nil {
+		return nil, fmt.Errorf("查询秒杀券失败: %v", err)
+	}
+
+	// 只对账上架中的秒杀券：下架或商铺已删除的券不接受秒杀，库存缓存过期后也不应被重建
+	ids := make([]uint, 0, len(vouchers))
+	for _, v := range vouchers {
+		ids = append(ids, v.VoucherID)
+	}
+	statuses, err := dao.GetVoucherStatusMap(ctx, dao.DB, ids)
+	if err != nil {
+		return nil, fmt.Errorf("查询优惠券状态失败: %v", err)
+	}
+
+	inFlight, err := orderQueue.InFlightByUser(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("统计在途订单失败: %v", err)
+	}
+
+	report := &StockReconcileReport{
+		CheckedAt:     time.Now(),
+		Discrepancies: []StockDiscrepancy{},
+		Repair:        repair,
+	}
+	for i := range vouchers {
+		if statuses[vouchers[i].VoucherID] != models.VoucherStatusOnShelf {
+			continue
+		}
+		report.Checked++
+		d, err := checkSeckillStock(ctx, &vouchers[i], inFlight[vouchers[i].VoucherID])
+		if err != nil {
+			return nil, fmt.Errorf("对账秒杀券 %d 失败: %v", vouchers[i].VoucherID, err)
+		}
+		if len(d.Issues) == 0 {
+			continue
+		}
+		if repair {
+			if err := repairSeckillStock(ctx, d); err != nil {
+				d.RepairError = err.Error()
+			} else {
+				d.Repaired = true
+			}
+		}
+		log.Printf("秒杀库存不一致: voucherID=%d, issues=%v, repaired=%v", d.VoucherID, d.Issues, d.Repaired)
+		report.Discrepancies = append(report.Discrepancies, *d)
+	}
+
+	lastReconcileMu.Lock()
+	lastReconcileReport = report
+	lastReconcileMu.Unlock()
+	return report, nil
+}
+
+// checkSeckillStock 对账单个秒杀券，inFlight 为该券各用户的在途件数
+func checkSeckillStock(ctx context.Context, v *models.SeckillVoucher, inFlight map[uint]int) (*StockDiscrepancy, error) {
+	redisStock, exists, err := dao.GetSeckillVoucherStockCache(ctx, dao.Redis, v.VoucherID)
+	if err != nil {
+		return nil, fmt.Errorf("读取Redis库存失败: %v", err)
+	}
+	voucherStock, err := dao.GetVoucherStock(ctx, dao.DB, v.VoucherID)
+	if err != nil {
+		return nil, fmt.Errorf("读取优惠券库存失败: %v", err)
+	}
+
+	d := &StockDiscrepancy{
+		VoucherID:    v.VoucherID,
+		MySQLStock:   v.Stock,
+		VoucherStock: voucherStock,
+		Issues:       []string{},
+	}
+	for _, n := range inFlight {
+		d.InFlight += n
+	}
+	if !exists {
+		d.Issues = append(d.Issues, "Redis库存缓存不存在")
+	} else {
+		d.RedisStock = &redisStock
+		d.Diff = redisStock + int64(d.InFlight) - int64(v.Stock)
+		if d.Diff != 0 {
+			d.Issues = append(d.Issues, fmt.Sprintf("Redis库存+在途件数与MySQL相差%d", d.Diff))
+		}
+	}
+	if voucherStock != v.Stock {
+		d.Issues = append(d.Issues, "tb_voucher 与 tb_seckill_voucher 库存不一致")
+	}
+	if err := checkSeckillBought(ctx, d, inFlight); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// checkSeckillBought 核对 Redis 中每个用户的已购数量与订单件数 + 在途件数，限购依赖这份数据，
+// 偏小会让用户超买，偏大会让用户买不到
+func checkSeckillBought(ctx context.Context, d *StockDiscrepancy, inFlight map[uint]int) error {
+	bought, err := dao.GetSeckillVoucherUserBought(ctx, dao.Redis, d.VoucherID)
+	if err != nil {
+		return fmt.Errorf("读取Redis已购数量失败: %v", err)
+	}
+	ordered, err := dao.SumSeckillVoucherOrderQuantityByUser(ctx, dao.DB, d.VoucherID)
+	if err != nil {
+		return fmt.Errorf("统计订单件数失败: %v", err)
+	}
+
+	users := make(map[uint]bool, len(bought)+len(ordered)+len(inFlight))
+	for userID, n := range bought {
+		users[userID] = true
+		d.BoughtQuantity += n
+	}
+	for userID, n := range ordered {
+		users[userID] = true
+		d.SoldQuantity += n
+	}
+	for userID := range inFlight {
+		users[userID] = true
+	}
+	d.BoughtDiff = d.BoughtQuantity - d.SoldQuantity - d.InFlight
+
+	mismatched := 0
+	for userID := range users {
+		m := UserBoughtMismatch{UserID: userID, Bought: bought[userID], Ordered: ordered[userID], InFlight: inFlight[userID]}
+		if m.diff() == 0 {
+			continue
+		}
+		mismatched++
+		if len(d.UserMismatches) < reconcileMaxUserReports {
+			d.UserMismatches = append(d.UserMismatches, m)
+		}
+	}
+	if mismatched > 0 {
+		d.Issues = append(d.Issues, fmt.Sprintf("%d 个用户的Redis已购数量与订单件数+在途件数不一致（合计相差%d）", mismatched, d.BoughtDiff))
+	}
+	return nil
+}
+
+// repairSeckillStock 以 tb_seckill_voucher 为准修复：重新读取确认差异仍然存在后，按差值调整 Redis 库存
+// （用增量而不是覆盖，不会吞掉对账期间新的秒杀扣减），并同步 tb_voucher 库存
+func repairSeckillStock(ctx context.Context, d *StockDiscrepancy) error {
+	voucher, err := dao.GetVoucherByID(ctx, dao.DB, d.VoucherID)
+	if err != nil {
+		return fmt.Errorf("读取优惠券失败: %v", err)
+	}
+	// 对账后被下架的券不再修复，避免重建的缓存把它重新开放秒杀
+	if voucher.Status != models.VoucherStatusOnShelf {
+		return fmt.Errorf("优惠券未上架，跳过修复")
+	}
+	v, err := dao.GetSeckillVoucherByID(d.VoucherID)
+	if err != nil {
+		return fmt.Errorf("读取秒杀券失败: %v", err)
+	}
+	inFlight, err := orderQueue.InFlightByUser(ctx)
+	if err != nil {
+		return fmt.Errorf("统计在途订单失败: %v", err)
+	}
+	latest, err := checkSeckillStock(ctx, v, inFlight[v.VoucherID])
+	if err != nil {
+		return err
+	}
+
+	if latest.VoucherStock != v.Stock {
+		if err := dao.SetVoucherStock(ctx, dao.DB, v.VoucherID, v.Stock); err != nil {
+			return fmt.Errorf("修复优惠券库存失败: %v", err)
+		}
+	}
+
+	switch {
+	case latest.RedisStock == nil:
+		stock := v.Stock - latest.InFlight
+		if stock < 0 {
+			stock = 0
+		}
+		if err := dao.SetSeckillVoucherCache(ctx, dao.Redis, v, stock, voucher.Status); err != nil {
+			return fmt.Errorf("重建Redis库存失败: %v", err)
+		}
+	case latest.Diff != 0:
+		// 两次读取的差异不同说明有订单正在处理，留给下一轮对账
+		if latest.Diff != d.Diff {
+			return fmt.Errorf("库存正在变化，本轮跳过修复")
+		}
+		if err := dao.IncrSeckillVoucherStockCache(ctx, dao.Redis, v.VoucherID, int(-latest.Diff)); err != nil {
+			return fmt.Errorf("修复Redis库存失败: %v", err)
+		}
+	}
+	return repairSeckillBought(ctx, d, latest)
+}
+
+// repairSeckillBought 以订单为准修复用户已购数量：只修复两次读取差值相同的用户，按差值调整
+// （差值变化说明该用户有订单正在处理，留给下一轮对账）；超出报告上限的用户在后续对账中修复
+func repairSeckillBought(ctx context.Context, d, latest *StockDiscrepancy) error {
+	before := make(map[uint]int, len(d.UserMismatches))
+	for _, m := range d.UserMismatches {
+		before[m.UserID] = m.diff()
+	}
+	skipped := 0
+	for _, m := range latest.UserMismatches {
+		if diff, ok := before[m.UserID]; !ok || diff != m.diff() {
+			skipped++
+			continue
+		}
+		if err := dao.AdjustSeckillVoucherUserBought(ctx, dao.Redis, d.VoucherID, m.UserID, -m.diff()); err != nil {
+			return fmt.Errorf("修复用户 %d 的已购数量失败: %v", m.UserID, err)
+		}
+	}
+	if skipped > 0 {
+		return fmt.Errorf("%d 个用户的已购数量正在变化，本轮跳过修复", skipped)
+	}
+	return nil
+}
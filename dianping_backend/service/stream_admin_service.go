@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"dianping/dao"
+	"dianping/utils"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lagScanLimit 旧版本 Redis 没有 lag 字段时，手动统计积压的最大条数
+const lagScanLimit = 10000
+
+// GetStreamInfo 获取订单队列的运行状态：积压、各消费者 pending、最老 pending 时长、死信数量
+// EN: Queue/consumer stats for on-call (lag, pending per consumer, oldest pending age, DLQ size)
+func GetStreamInfo(ctx context.Context) *utils.Result {
+	stats, err := orderQueue.Stats(ctx)
+	if err != nil {
+		return utils.ErrorResult("获取订单队列信息失败: " + err.Error())
+	}
+	stats["backend"] = orderQueue.Name()
+	return utils.SuccessResultWithData(stats)
+}
+
+// ListStreamPending 查看 pending 消息明细（可按消费者过滤）
+// EN: List pending entries with idle time and delivery count
+func ListStreamPending(ctx context.Context, consumer string, count int64) *utils.Result {
+	list, err := orderQueue.Pending(ctx, consumer, count)
+	if err != nil {
+		return utils.ErrorResult("获取pending消息失败: " + err.Error())
+	}
+	return utils.SuccessResultWithData(list)
+}
+
+// ListDeadLetters 查看最近的死信消息（含失败原因）
+// EN: List the most recent dead-lettered messages
+func ListDeadLetters(ctx context.Context, count int64) *utils.Result {
+	list, err := orderQueue.DeadLetters(ctx, count)
+	if err != nil {
+		return utils.ErrorResult("获取死信消息失败: " + err.Error())
+	}
+	return utils.SuccessResultWithData(list)
+}
+
+// ReplayDeadLetter 回放一条死信消息：重新执行秒杀脚本预扣库存并重新投递，成功后从死信队列删除
+// EN: Re-run the seckill reservation for a DLQ entry and enqueue it again
+func ReplayDeadLetter(ctx context.Context, id string) *utils.Result {
+	info, err := orderQueue.GetDeadLetter(ctx, id)
+	if err != nil {
+		return utils.ErrorResult("读取死信消息失败: " + err.Error())
+	}
+	if info == nil {
+		return utils.ErrorResult("死信消息不存在")
+	}
+
+	// 进入死信时已归还库存与下单名额，回放需要重新走一遍预扣
+	quantity, err := info.quantity()
+	if err != nil {
+		return utils.ErrorResult("死信消息格式错误，无法回放: " + err.Error())
+	}
+	r, err := runSeckillScript(ctx, info.VoucherID, info.UserID, info.OrderID, quantity)
+	if err != nil {
+		return utils.ErrorResult("回放失败: " + err.Error())
+	}
+	if r != 0 {
+		return utils.ErrorResult("回放失败: " + seckillFailMessage(r))
+	}
+	if orderQueue.StreamKey() == "" {
+		info.ID = ""
+		if err := orderQueue.Publish(ctx, info); err != nil {
+			failOrderMessage(ctx, info, "投递订单消息失败")
+			return utils.ErrorResult("回放失败: " + err.Error())
+		}
+	}
+
+	if err := orderQueue.RemoveDeadLetter(ctx, id); err != nil {
+		log.Printf("警告: 回放成功但删除死信消息失败: id=%s, error=%v", id, err)
+	}
+	log.Printf("死信消息已回放: id=%s, orderId=%s", id, info.OrderID)
+	return utils.SuccessResult("回放成功")
+}
+
+// TrimStream 裁剪订单队列：订单 Stream 只删除已投递且已确认的消息（仅 Redis Stream 后端），死信队列按最大长度裁剪
+// EN: Trim acknowledged entries from stream.orders, or cap the DLQ length
+func TrimStream(ctx context.Context, target string, maxLen int64) *utils.Result {
+	var removed int64
+	var err error
+
+	switch target {
+	case "stream":
+		if _, ok := orderQueue.(*redisStreamQueue); !ok {
+			return utils.ErrorResult("当前订单队列不支持裁剪: " + orderQueue.Name())
+		}
+		minID, merr := safeTrimMinID(ctx)
+		if merr != nil {
+			return utils.ErrorResult("计算裁剪位置失败: " + merr.Error())
+		}
+		if minID == "" {
+			return utils.SuccessResultWithData(map[string]interface{}{"removed": 0})
+		}
+		removed, err = dao.Redis.XTrimMinID(ctx, streamKey, minID).Result()
+	case "dlq":
+		if maxLen < 0 {
+			return utils.ErrorResult("maxLen 不能小于0")
+		}
+		removed, err = orderQueue.TrimDeadLetters(ctx, maxLen)
+	default:
+		return utils.ErrorResult("不支持的裁剪目标: " + target)
+	}
+	if err != nil {
+		return utils.ErrorResult("裁剪失败: " + err.Error())
+	}
+
+	log.Printf("订单队列裁剪完成: target=%s, removed=%d", target, removed)
+	return utils.SuccessResultWithData(map[string]interface{}{"removed": removed})
+}
+
+// orderGroupInfo 订单消费者组的统计信息
+type orderGroupInfo struct {
+	lastDeliveredID string
+	lag             int64
+}
+
+// getOrderGroupInfo 读取原始 XINFO GROUPS（go-redis v8 无法解析 Redis 7 新增字段），缺少 lag 时手动统计
+func getOrderGroupInfo(ctx context.Context) (*orderGroupInfo, error) {
+	reply, err := dao.Redis.Do(ctx, "XINFO", "GROUPS", streamKey).Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range reply {
+		fields, ok := item.([]interface{})
+		if !ok {
+			continue
+		}
+		g := replyToMap(fields)
+		if name, _ := g["name"].(string); name != groupName {
+			continue
+		}
+
+		info := &orderGroupInfo{}
+		info.lastDeliveredID, _ = g["last-delivered-id"].(string)
+		if lag, ok := g["lag"].(int64); ok {
+			info.lag = lag
+			return info, nil
+		}
+
+		// 旧版本 Redis：统计 last-delivered-id 之后的消息数
+		msgs, err := dao.Redis.XRangeN(ctx, streamKey, "("+info.lastDeliveredID, "+", lagScanLimit).Result()
+		if err != nil {
+			return nil, err
+		}
+		info.lag = int64(len(msgs))
+		return info, nil
+	}
+	return nil, fmt.Errorf("消费者组 %s 不存在", groupName)
+}
+
+// safeTrimMinID 计算可以安全裁剪到的位置：最老的 pending 消息，没有 pending 时为最后投递的消息
+func safeTrimMinID(ctx context.Context) (string, error) {
+	pending, err := dao.Redis.XPending(ctx, streamKey, groupName).Result()
+	if err != nil {
+		return "", err
+	}
+	if pending.Count > 0 {
+		return pending.Lower, nil
+	}
+
+	group, err := getOrderGroupInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+	if group.lastDeliveredID == "" || group.lastDeliveredID == "0-0" {
+		return "", nil
+	}
+	return group.lastDeliveredID, nil
+}
+
+// streamIDLessOrEqual 比较两个 Stream 消息ID（毫秒时间戳-序号）
+func streamIDLessOrEqual(a, b string) bool {
+	aMs, aSeq := splitStreamID(a)
+	bMs, bSeq := splitStreamID(b)
+	if aMs != bMs {
+		return aMs < bMs
+	}
+	return aSeq <= bSeq
+}
+
+// splitStreamID 拆分 Stream 消息ID，格式错误时按 0-0 处理
+func splitStreamID(id string) (uint64, uint64) {
+	parts := strings.SplitN(id, "-", 2)
+	ms, _ := strconv.ParseUint(parts[0], 10, 64)
+	var seq uint64
+	if len(parts) == 2 {
+		seq, _ = strconv.ParseUint(parts[1], 10, 64)
+	}
+	return ms, seq
+}
+
+// streamIDTime 解析 Stream 消息ID中的毫秒时间戳
+func streamIDTime(id string) (time.Time, bool) {
+	ms, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
@@ -5,286 +5,228 @@ import (
 	"dianping/dao"
 	"dianping/models"
 	"dianping/utils"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
-	"sync"
 	"time"
 
-	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// SeckillVoucher 秒杀优惠券
-// EN: Seckill purchase entry. Runs Lua for stock/user checks and publishes to Redis Stream.
-func SeckillVoucher(ctx context.Context, userId, voucherId uint) *utils.Result {
-	// 从文件当中加载脚本（缓存已读内容）
-	script, err := os.ReadFile("script/seckill.lua")
-	if err != nil {
-		log.Printf("读取秒杀脚本失败: %v", err)
-		return utils.ErrorResult("系统错误")
-	}
-	scriptStr := string(script)
+// idWorker 订单号生成器
+var idWorker *utils.RedisIdWorker
 
-	// 生成临时 orderId 并传入 Lua 脚本以便 xadd 中包含 id 字段
-	var orderId string
+// SeckillVoucher 秒杀优惠券
+// EN: Seckill purchase entry. Runs Lua for stock/limit checks and publishes to the order queue.
+func SeckillVoucher(ctx context.Context, userId, voucherId uint, quantity int) *utils.Result {
+	// 生成 orderId 并传入 Lua 脚本以便 xadd 中包含 id 字段，客户端凭它查询订单处理状态
 	if idWorker == nil {
 		idWorker = utils.NewRedisIdWorker(dao.Redis, 16)
 	}
-	if id, err := idWorker.NextId(ctx, "order"); err == nil {
-		orderId = strconv.FormatInt(id, 10)
-	} else {
+	id, err := idWorker.NextId(ctx, "order")
+	if err != nil {
 		log.Printf("生成orderId失败: %v", err)
-		orderId = ""
-		//test
-		println(orderId)
+		return utils.ErrorResult("系统错误")
 	}
+	orderId := strconv.FormatInt(id, 10)
 
 	// 1. 执行Lua脚本
-	result := dao.Redis.Eval(ctx, scriptStr, []string{}, strconv.Itoa(int(voucherId)), strconv.Itoa(int(userId)), orderId)
-	if result.Err() != nil {
-		log.Printf("执行秒杀脚本失败: %v", result.Err())
+	r, err := runSeckillScript(ctx, strconv.Itoa(int(voucherId)), strconv.Itoa(int(userId)), orderId, quantity)
+	if err != nil {
+		log.Printf("执行秒杀脚本失败: %v", err)
 		return utils.ErrorResult("系统错误")
 	}
 
 	// 2. 判断结果是否为 0，0的时候有资格完成
-	r, err := result.Int()
-	if err != nil {
-		log.Printf("获取秒杀脚本返回值失败: %v", err)
-		return utils.ErrorResult("系统错误")
-	}
 	if r != 0 {
-		if r == 1 {
-			return utils.ErrorResult("库存不足")
-		}
-		return utils.ErrorResult("不能重复购买")
+		return utils.ErrorResult(seckillFailMessage(r))
 	}
 
-	// 3. 已经加入到消息队列了
-
-	// 4. 返回订单ID（这里可以生成一个临时ID或者返回成功信息）
-	return utils.SuccessResultWithData("秒杀成功，订单处理中...")
-}
-
-// StreamOrderInfo Redis Stream中的订单信息结构体
-// EN: Order info payload structure stored in Redis Stream
-type StreamOrderInfo struct {
-	UserID    string `json:"userId"`
-	VoucherID string `json:"voucherId"`
-	OrderID   string `json:"id"`
-}
-
-// Stream消费者相关配置
-// EN: Redis Stream consumer configuration
-var (
-	streamKey     = "stream.orders"     // Stream名称
-	groupName     = "order-group"       // 消费者组名称
-	consumerCount = 3                   // 消费者数量
-	streamOnce    sync.Once             // 确保Stream只初始化一次
-	stopChan      = make(chan struct{}) // 停止信号
-	wg            sync.WaitGroup        // 等待组，用于优雅关闭
-	idWorker      *utils.RedisIdWorker
-)
-
-// InitStreamConsumer 初始化Redis Stream消费者
-// EN: Initialize Redis Stream consumers (group + workers)
-func InitStreamConsumer() error {
-	var initErr error
-	streamOnce.Do(func() {
-		ctx := context.Background()
-
-		// 1. 检查Stream是否存在，如果不存在则创建
-		exists, err := checkStreamExists(ctx, streamKey)
-		if err != nil {
-			initErr = fmt.Errorf("检查Stream失败: %v", err)
-			return
+	// 3. Redis Stream 后端已由 Lua 脚本原子写入，其他后端在这里投递
+	if orderQueue.StreamKey() == "" {
+		msg := &OrderMessage{
+			UserID:    strconv.Itoa(int(userId)),
+			VoucherID: strconv.Itoa(int(voucherId)),
+			OrderID:   orderId,
+			Quantity:  strconv.Itoa(quantity),
 		}
-
-		if !exists {
-			// 创建一个空的Stream（通过添加临时消息然后删除）
-			result := dao.Redis.XAdd(ctx, &redis.XAddArgs{
-				Stream: streamKey,
-				ID:     "*",
-				Values: map[string]interface{}{"init": "temp"},
-			})
-			if result.Err() != nil {
-				initErr = fmt.Errorf("创建Stream失败: %v", result.Err())
-				return
-			}
-			// 删除临时消息
-			dao.Redis.XDel(ctx, streamKey, result.Val())
-		}
-
-		// 2. 创建消费者组（如果不存在）
-		err = dao.Redis.XGroupCreateMkStream(ctx, streamKey, groupName, "0").Err()
-		if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
-			initErr = fmt.Errorf("创建消费者组失败: %v", err)
-			return
-		}
-
-		// 3. 启动消费者
-		for i := 0; i < consumerCount; i++ {
-			consumerName := fmt.Sprintf("consumer-%d", i)
-			wg.Add(1)
-			go streamConsumer(consumerName, i)
+		if err := orderQueue.Publish(ctx, msg); err != nil {
+			log.Printf("投递订单消息失败: %v", err)
+			// 投递失败归还预扣的库存与下单名额
+			failOrderMessage(ctx, msg, "投递订单消息失败")
+			return utils.ErrorResult("系统繁忙，请稍后重试")
 		}
+	}
 
-		log.Printf("Redis Stream消费者初始化完成，Stream: %s, 消费者组: %s, 消费者数量: %d",
-			streamKey, groupName, consumerCount)
+	// 4. 返回订单ID（字符串形式，避免超出 JS 安全整数范围），订单由消费者异步创建
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"orderId": orderId,
+		"status":  OrderProcessPending,
+		"message": "秒杀成功，订单处理中...",
 	})
-
-	return initErr
 }
 
-// checkStreamExists 检查Stream是否存在
-// EN: Check if the Stream key exists in Redis
-func checkStreamExists(ctx context.Context, streamKey string) (bool, error) {
-	result := dao.Redis.Exists(ctx, streamKey)
-	if result.Err() != nil {
-		return false, result.Err()
+// runSeckillScript 执行秒杀 Lua 脚本：校验库存与每人限购、预扣库存并写入订单 Stream（如有），返回脚本结果码
+// EN: Run seckill.lua and return its result code (0 = reserved and enqueued)
+func runSeckillScript(ctx context.Context, voucherId, userId, orderId string, quantity int) (int, error) {
+	// 从文件当中加载脚本（缓存已读内容）
+	script, err := os.ReadFile("script/seckill.lua")
+	if err != nil {
+		return 0, fmt.Errorf("读取秒杀脚本失败: %v", err)
 	}
-	return result.Val() > 0, nil
-}
-
-// streamConsumer Stream消费者worker
-// EN: Worker loop that reads and processes Stream messages
-func streamConsumer(consumerName string, workerID int) {
-	defer wg.Done()
-
-	log.Printf("Stream消费者 %s (Worker %d) 启动", consumerName, workerID)
-
-	ctx := context.Background()
-
-	for {
-		select {
-		case <-stopChan:
-			log.Printf("Stream消费者 %s (Worker %d) 收到停止信号，正在退出", consumerName, workerID)
-			return
-		default:
-			// 从Stream中读取消息
-			messages, err := readStreamMessages(ctx, consumerName)
-			if err != nil {
-				log.Printf("消费者 %s 读取消息失败: %v", consumerName, err)
-				time.Sleep(time.Second * 2) // 出错时等待2秒再重试
-				continue
-			}
-
-			// 处理每条消息
-			for _, msg := range messages {
-				err := processStreamMessage(ctx, msg, consumerName)
-				if err != nil {
-					log.Printf("消费者 %s 处理消息失败: msgID=%s, error=%v",
-						consumerName, msg.ID, err)
-				} else {
-					log.Printf("消费者 %s 成功处理消息: msgID=%s", consumerName, msg.ID)
-					// 确认消息已处理
-					dao.Redis.XAck(ctx, streamKey, groupName, msg.ID)
-				}
-			}
 
-			// 如果没有消息，短暂休眠
-			if len(messages) == 0 {
-				time.Sleep(time.Millisecond * 100)
-			}
-		}
+	result := dao.Redis.Eval(ctx, string(script), []string{}, voucherId, userId, orderId, orderQueue.StreamKey(), quantity,
+		int(dao.OrderProcessStatusTTL.Seconds()))
+	if result.Err() != nil {
+		return 0, result.Err()
 	}
+	r, err := result.Int()
+	if err != nil {
+		return 0, fmt.Errorf("获取秒杀脚本返回值失败: %v", err)
+	}
+	return r, nil
 }
 
-// readStreamMessages 从Stream中读取消息
-// EN: Read pending first, then new messages from the Stream
-func readStreamMessages(ctx context.Context, consumerName string) ([]redis.XMessage, error) {
-	// 首先尝试读取pending消息（之前未确认的消息）
-	pendingResult := dao.Redis.XReadGroup(ctx, &redis.XReadGroupArgs{
-		Group:    groupName,
-		Consumer: consumerName,
-		Streams:  []string{streamKey, "0"}, // "0"表示读取pending消息
-		Count:    10,
-		Block:    0, // 不阻塞
-	})
-
-	if pendingResult.Err() == nil && len(pendingResult.Val()) > 0 && len(pendingResult.Val()[0].Messages) > 0 {
-		return pendingResult.Val()[0].Messages, nil
+// seckillFailMessage 秒杀脚本结果码对应的提示
+func seckillFailMessage(code int) string {
+	switch code {
+	case 1:
+		return "库存不足"
+	case 3:
+		return "秒杀尚未开始"
+	case 4:
+		return "秒杀已经结束"
+	case 5:
+		return "秒杀券已下架"
+	case 6:
+		return "秒杀暂不可用，请稍后重试"
+	default:
+		return "超出每人限购数量"
 	}
+}
 
-	// 如果没有pending消息，读取新消息
-	result := dao.Redis.XReadGroup(ctx, &redis.XReadGroupArgs{
-		Group:    groupName,
-		Consumer: consumerName,
-		Streams:  []string{streamKey, ">"}, // ">"表示读取新消息
-		Count:    10,
-		Block:    time.Second * 1, // 阻塞1秒
-	})
+// normalOrderLockTTL 普通券下单锁的过期时间
+const normalOrderLockTTL = 10 * time.Second
 
-	if result.Err() != nil {
-		// 阻塞读取超时等情况，go-redis 可能返回 redis.Nil，视为无消息而不是错误
-		if result.Err() == redis.Nil {
-			return []redis.XMessage{}, nil
+// PurchaseVoucher 购买普通券：同步在一个事务内校验限购、扣减库存并创建订单
+// EN: Synchronous purchase of a normal (non-seckill) voucher
+func PurchaseVoucher(ctx context.Context, userId, voucherId uint, quantity int) *utils.Result {
+	voucher, err := dao.GetVoucherByID(ctx, dao.DB, voucherId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("优惠券不存在")
 		}
-		return nil, result.Err()
+		return utils.ErrorResult("查询优惠券失败")
 	}
-
-	if len(result.Val()) > 0 && len(result.Val()[0].Messages) > 0 {
-		return result.Val()[0].Messages, nil
+	if voucher.Type != 0 {
+		return utils.ErrorResult("该优惠券为秒杀券，请参与秒杀")
 	}
-
-	return []redis.XMessage{}, nil
-}
-
-// processStreamMessage 处理单条Stream消息
-// EN: Parse and dispatch a single Stream message
-func processStreamMessage(ctx context.Context, msg redis.XMessage, consumerName string) error {
-	// 解析消息内容
-	orderInfo, err := parseOrderMessage(msg)
-	if err != nil {
-		return fmt.Errorf("解析消息失败: %v", err)
+	if voucher.Status != models.VoucherStatusOnShelf {
+		return utils.ErrorResult("优惠券已下架")
+	}
+	now := time.Now()
+	if voucher.BeginTime != nil && now.Before(*voucher.BeginTime) {
+		return utils.ErrorResult("优惠券尚未开始售卖")
+	}
+	if voucher.EndTime != nil && now.After(*voucher.EndTime) {
+		return utils.ErrorResult("优惠券已过期")
 	}
 
-	// 转换字符串ID为uint
-	userID, err := strconv.ParseUint(orderInfo.UserID, 10, 32)
-	if err != nil {
-		return fmt.Errorf("解析用户ID失败: %v", err)
+	// 同一用户同一券串行下单，避免并发请求绕过限购
+	lockKey := fmt.Sprintf("lock:order:%d:%d", userId, voucherId)
+	ok, lockVal := utils.TryLockWithTTL(ctx, dao.Redis, lockKey, normalOrderLockTTL)
+	if !ok {
+		return utils.ErrorResult("下单处理中，请勿重复提交")
 	}
+	defer utils.UnLockSafe(ctx, dao.Redis, lockKey, lockVal)
 
-	voucherID, err := strconv.ParseUint(orderInfo.VoucherID, 10, 32)
+	if idWorker == nil {
+		idWorker = utils.NewRedisIdWorker(dao.Redis, 16)
+	}
+	id, err := idWorker.NextId(ctx, "order")
 	if err != nil {
-		return fmt.Errorf("解析优惠券ID失败: %v", err)
+		log.Printf("生成orderId失败: %v", err)
+		return utils.ErrorResult("系统错误")
 	}
 
-	// 处理订单
-	return processStreamOrder(ctx, uint(userID), uint(voucherID), orderInfo.OrderID)
-}
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("系统错误")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			log.Printf("普通券下单发生panic: %v", r)
+		}
+	}()
 
-// parseOrderMessage 解析订单消息
-// EN: Parse order fields from Stream message values
-func parseOrderMessage(msg redis.XMessage) (*StreamOrderInfo, error) {
-	orderInfo := &StreamOrderInfo{}
+	// 1) 检查每人限购数量
+	if voucher.LimitPerUser > 0 {
+		bought, err := dao.SumUserVoucherOrderQuantity(ctx, tx, userId, voucherId, 1)
+		if err != nil {
+			tx.Rollback()
+			return utils.ErrorResult("系统错误")
+		}
+		if bought+quantity > voucher.LimitPerUser {
+			tx.Rollback()
+			return utils.ErrorResult("超出每人限购数量")
+		}
+	}
 
-	// 从消息中提取字段
-	if userID, ok := msg.Values["userId"].(string); ok {
-		orderInfo.UserID = userID
-	} else {
-		return nil, fmt.Errorf("消息中缺少userId字段")
+	// 2) 扣减库存（条件更新，库存不足时不会扣成负数）
+	ok, err = dao.DecreaseVoucherStock(ctx, tx, voucherId, quantity)
+	if err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("系统错误")
+	}
+	if !ok {
+		tx.Rollback()
+		return utils.ErrorResult("库存不足")
 	}
 
-	if voucherID, ok := msg.Values["voucherId"].(string); ok {
-		orderInfo.VoucherID = voucherID
-	} else {
-		return nil, fmt.Errorf("消息中缺少voucherId字段")
+	// 3) 创建订单
+	order := &models.VoucherOrder{
+		OrderID:     uint(id),
+		UserID:      userId,
+		VoucherID:   voucherId,
+		Quantity:    quantity,
+		PayType:     1,
+		Status:      models.OrderStatusUnpaid,
+		CreateTime:  &now,
+		VoucherType: 1, // 普通券类型
+	}
+	if err := dao.CreateVoucherOrder(ctx, tx, order); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("创建订单失败")
 	}
 
-	if orderID, ok := msg.Values["orderId"].(string); ok {
-		orderInfo.OrderID = orderID
-	} else {
-		return nil, fmt.Errorf("消息中缺少orderId字段")
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("创建订单失败")
 	}
 
-	return orderInfo, nil
+	// 登记支付超时任务
+	scheduleOrderPayTimeout(ctx, order)
+
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"orderId": strconv.FormatInt(id, 10),
+		"status":  OrderProcessCreated,
+	})
 }
 
 // processStreamOrder 处理Stream中的订单
 // EN: Transactionally check idempotency, decrement stock and create order
-func processStreamOrder(ctx context.Context, userID, voucherID uint, orderID string) error {
+func processStreamOrder(ctx context.Context, userID, voucherID uint, orderID string, quantity int) error {
+	// 订单号由秒杀入口生成并有唯一索引，是消息重复投递时幂等的依据，缺失时无法创建订单
+	id64, err := strconv.ParseUint(orderID, 10, 64)
+	if err != nil || id64 == 0 {
+		return permanent(fmt.Errorf("无效的订单号: %q", orderID))
+	}
+	orderNo := uint(id64)
+
 	// 开始数据库事务
 	tx := dao.DB.Begin()
 	if tx.Error != nil {
@@ -298,44 +240,87 @@ func processStreamOrder(ctx context.Context, userID, voucherID uint, orderID str
 		}
 	}()
 
-	// 1) 检查用户是否已经有秒杀券订单（防止重复）
-	exists, err := dao.CheckSeckillVoucherOrderExists(ctx, tx, userID, voucherID)
+	// 1) 先锁定秒杀券行：同一优惠券的订单串行创建，之后的读取（一致性快照在加锁后建立）
+	//    能看到其他消费者已提交的订单，避免限购统计读到旧快照
+	var seckillVoucher models.SeckillVoucher
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("voucher_id = ?", voucherID).First(&seckillVoucher).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return permanent(fmt.Errorf("秒杀券不存在"))
+		}
+		return fmt.Errorf("查询秒杀券失败: %v", err)
+	}
+
+	// 2) 同一订单号只创建一次（消息重复投递时幂等）
+	exists, err := dao.CheckVoucherOrderExistsByOrderID(ctx, tx, orderNo)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("检查重复订单失败: %v", err)
 	}
 	if exists {
-		// 用户已下单，直接回滚事务并返回 nil（视为已处理）
+		// 订单已创建，直接回滚事务并返回 nil（视为已处理）
 		tx.Rollback()
-		log.Printf("用户已存在秒杀订单: userID=%d, voucherID=%d", userID, voucherID)
+		log.Printf("订单已存在: orderID=%d", orderNo)
 		return nil
 	}
 
-	// 2) 在事务内扣减秒杀券库存（保证与订单创建在同一事务）
+	// 3) 锁定优惠券行并检查状态：下架与本事务互斥，下架提交后到达的消息不再创建订单，
+	//    进入死信并归还预扣的库存与下单名额
+	var voucher models.Voucher
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "status").Where("id = ?", voucherID).First(&voucher).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return permanent(fmt.Errorf("优惠券不存在"))
+		}
+		return fmt.Errorf("查询优惠券失败: %v", err)
+	}
+	if voucher.Status != models.VoucherStatusOnShelf {
+		tx.Rollback()
+		return permanent(fmt.Errorf("秒杀券已下架: status=%d", voucher.Status))
+	}
+
+	// 4) 检查每人限购数量
+	limit := seckillVoucher.LimitPerUser
+	if limit <= 0 {
+		limit = 1
+	}
+	bought, err := dao.SumSeckillVoucherOrderQuantity(ctx, tx, userID, voucherID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("统计已购数量失败: %v", err)
+	}
+	if bought+quantity > limit {
+		tx.Rollback()
+		return permanent(fmt.Errorf("超出每人限购数量: 已购%d, 本次%d, 限购%d", bought, quantity, limit))
+	}
+
+	// 5) 在事务内扣减秒杀券库存（保证与订单创建在同一事务）
 	// Use raw SQL expression for atomic decrement
 	result := tx.Model(&models.SeckillVoucher{}).
-		Where("voucher_id = ? AND stock >= ?", voucherID, 1).
-		UpdateColumn("stock", gorm.Expr("stock - ?", 1))
+		Where("voucher_id = ? AND stock >= ?", voucherID, quantity).
+		UpdateColumn("stock", gorm.Expr("stock - ?", quantity))
 	if result.Error != nil {
 		tx.Rollback()
 		return fmt.Errorf("更新库存失败: %v", result.Error)
 	}
 	if result.RowsAffected == 0 {
 		tx.Rollback()
-		return fmt.Errorf("库存不足")
+		return permanent(fmt.Errorf("库存不足"))
 	}
 
-	// 3) 同步扣减关联的普通券库存（tb_voucher）——保证与上面操作在同一事务中
+	// 6) 同步扣减关联的普通券库存（tb_voucher）——保证与上面操作在同一事务中
 	vResult := tx.Model(&models.Voucher{}).
-		Where("id = ? AND stock >= ?", voucherID, 1).
-		UpdateColumn("stock", gorm.Expr("stock - ?", 1))
+		Where("id = ? AND stock >= ?", voucherID, quantity).
+		UpdateColumn("stock", gorm.Expr("stock - ?", quantity))
 	if vResult.Error != nil {
 		tx.Rollback()
 		return fmt.Errorf("更新关联券库存失败: %v", vResult.Error)
 	}
 	if vResult.RowsAffected == 0 {
 		tx.Rollback()
-		return fmt.Errorf("关联券库存不足")
+		return permanent(fmt.Errorf("关联券库存不足"))
 	}
 
 	// 创建订单
@@ -343,26 +328,21 @@ func processStreamOrder(ctx context.Context, userID, voucherID uint, orderID str
 	order := &models.VoucherOrder{
 		UserID:      userID,
 		VoucherID:   voucherID,
+		OrderID:     orderNo,
+		Quantity:    quantity,
 		PayType:     1,
 		Status:      1,
 		CreateTime:  &now,
 		VoucherType: 2, // 秒杀券类型
 	}
 
-	// 如果Lua脚本提供了订单ID，可以使用它
-	if orderID != "" {
-		// 尝试将 string orderID 解析为无符号整数并保存到模型的 OrderID 字段
-		if id64, err := strconv.ParseUint(orderID, 10, 64); err == nil {
-			order.OrderID = uint(id64)
-		} else {
-			// 解析失败则记录警告，但不阻止下单
-			log.Printf("警告: 解析 orderId (%s) 为整数失败: %v", orderID, err)
-		}
-	}
-
-	// 创建订单记录
+	// 创建订单记录，订单号唯一键冲突说明已由其他消费者创建（视为已处理）
 	if err := dao.CreateVoucherOrder(ctx, tx, order); err != nil {
 		tx.Rollback()
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			log.Printf("订单已存在: orderID=%d", orderNo)
+			return nil
+		}
 		return fmt.Errorf("创建订单失败: %v", err)
 	}
 
@@ -372,48 +352,295 @@ func processStreamOrder(ctx context.Context, userID, voucherID uint, orderID str
 		return fmt.Errorf("提交事务失败: %v", err)
 	}
 
+	// 登记支付超时任务，超时未支付将自动取消并回补库存
+	scheduleOrderPayTimeout(ctx, order)
+
 	// 记录创建成功：包含 DB 自增主键和原始 orderId 字符串（如果有）
-	log.Printf("成功创建订单: userID=%d, voucherID=%d, dbID=%d, orderID=%s",
-		userID, voucherID, order.ID, orderID)
+	log.Printf("成功创建订单: userID=%d, voucherID=%d, quantity=%d, dbID=%d, orderID=%s",
+		userID, voucherID, quantity, order.ID, orderID)
 
 	return nil
 }
 
-// StopStreamConsumers 停止所有Stream消费者（用于优雅关闭）
-// EN: Gracefully stop all Stream consumer workers
-func StopStreamConsumers() {
-	log.Println("正在停止Stream消费者...")
-	close(stopChan)
-	wg.Wait()
-	log.Println("所有Stream消费者已停止")
+// ================= 订单处理状态查询 =================
+
+// 秒杀订单的异步处理状态
+// EN: Async processing states reported by GetVoucherOrderStatus
+const (
+	OrderProcessPending = "pending" // 已预扣库存，等待消费者创建订单
+	OrderProcessCreated = "created" // 订单已创建
+	OrderProcessFailed  = "failed"  // 订单创建失败，库存与限购名额已归还
+)
+
+// GetVoucherOrderStatus 查询订单处理状态：优先查数据库，未落库时查消费者写入的短期状态
+// EN: Report pending/created/failed for an order number returned by SeckillVoucher
+func GetVoucherOrderStatus(ctx context.Context, userId, orderId uint) *utils.Result {
+	order, err := dao.GetVoucherOrderByOrderID(ctx, dao.DB, orderId)
+	if err == nil {
+		if order.UserID != userId {
+			return utils.ErrorResult("订单不存在")
+		}
+		return utils.SuccessResultWithData(map[string]interface{}{
+			"orderId": strconv.FormatUint(uint64(orderId), 10),
+			"status":  OrderProcessCreated,
+			"order":   order,
+		})
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrorResult("查询订单失败")
+	}
+
+	orderIdStr := strconv.FormatUint(uint64(orderId), 10)
+	status, err := dao.GetOrderProcessStatus(ctx, dao.Redis, orderIdStr)
+	if err != nil {
+		return utils.ErrorResult("查询订单状态失败")
+	}
+	if len(status) == 0 || status["userId"] != strconv.Itoa(int(userId)) {
+		return utils.ErrorResult("订单不存在")
+	}
+
+	data := map[string]interface{}{
+		"orderId": orderIdStr,
+		"status":  status["status"],
+	}
+	if status["status"] == OrderProcessCreated {
+		// 查询数据库与消费者提交交错，按处理中返回，客户端重试即可
+		data["status"] = OrderProcessPending
+	}
+	if status["reason"] != "" {
+		data["reason"] = status["reason"]
+	}
+	return utils.SuccessResultWithData(data)
 }
 
-// GetStreamInfo 获取Stream状态信息（用于监控）
-// EN: Get Stream/groups/consumers info for monitoring
-func GetStreamInfo() (map[string]interface{}, error) {
-	ctx := context.Background()
+// ================= 订单列表 =================
 
-	// 获取Stream基本信息
-	streamInfo, err := dao.Redis.XInfoStream(ctx, streamKey).Result()
+// ListMyVoucherOrders 我的订单列表，按下单时间倒序游标分页
+// EN: Cursor-paginated "my orders" list with voucher title and shop
+func ListMyVoucherOrders(ctx context.Context, userId uint, status, voucherType int, lastId uint, size int) *utils.Result {
+	filter := dao.VoucherOrderFilter{Status: status, VoucherType: voucherType}
+	orders, err := dao.ListUserVoucherOrderDetails(ctx, dao.DB, userId, filter, lastId, size)
 	if err != nil {
-		return nil, fmt.Errorf("获取Stream信息失败: %v", err)
+		return utils.ErrorResult("查询失败")
 	}
 
-	// 获取消费者组信息
-	groupInfo, err := dao.Redis.XInfoGroups(ctx, streamKey).Result()
+	var nextId uint
+	if len(orders) > 0 {
+		nextId = orders[len(orders)-1].ID
+	}
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"list":    orders,
+		"lastId":  nextId,
+		"hasMore": len(orders) == size,
+	})
+}
+
+// ListVoucherOrdersByVoucher 商家查看某优惠券的订单（分页）
+// EN: Merchant-side order list of a voucher
+func ListVoucherOrdersByVoucher(ctx context.Context, voucherId uint, page, size int) *utils.Result {
+	orders, err := dao.GetVoucherOrdersByVoucher(ctx, dao.DB, voucherId, page, size)
 	if err != nil {
-		return nil, fmt.Errorf("获取消费者组信息失败: %v", err)
+		return utils.ErrorResult("查询失败")
 	}
+	total, err := dao.CountVoucherOrdersByVoucher(ctx, dao.DB, voucherId)
+	if err != nil {
+		return utils.ErrorResult("查询失败")
+	}
+
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"list":  orders,
+		"total": total,
+		"page":  page,
+		"size":  size,
+	})
+}
+
+// ================= 订单状态机 =================
+
+// orderTransitions 订单允许的状态迁移：未支付 → 已支付 → 已核销/已退款，未支付 → 已取消
+// EN: Allowed order status transitions
+var orderTransitions = map[int][]int{
+	models.OrderStatusUnpaid: {models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPaid:   {models.OrderStatusUsed, models.OrderStatusRefunded},
+}
+
+// canTransit 判断订单能否从 from 迁移到 to
+func canTransit(from, to int) bool {
+	for _, s := range orderTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// PayVoucherOrder 支付订单
+// EN: Mark an unpaid order as paid
+func PayVoucherOrder(ctx context.Context, userId, orderId uint, payType int) *utils.Result {
+	order, res := getUserVoucherOrder(ctx, userId, orderId)
+	if res != nil {
+		return res
+	}
+	now := time.Now()
+	// 超过支付截止时间的订单不允许再支付，等待超时任务取消并回补库存
+	if order.Status == models.OrderStatusUnpaid && order.CreateTime != nil && now.After(orderPayDeadline(order)) {
+		return utils.ErrorResult("订单已超时，请重新下单")
+	}
+	if err := transitVoucherOrder(ctx, order, models.OrderStatusPaid, map[string]interface{}{
+		"pay_type": payType,
+		"pay_time": &now,
+	}); err != nil {
+		return utils.ErrorResult(err.Error())
+	}
+	return utils.SuccessResult("支付成功")
+}
+
+// UseVoucherOrder 核销订单
+// EN: Mark a paid order as used
+func UseVoucherOrder(ctx context.Context, userId, orderId uint) *utils.Result {
+	order, res := getUserVoucherOrder(ctx, userId, orderId)
+	if res != nil {
+		return res
+	}
+	now := time.Now()
+	if err := transitVoucherOrder(ctx, order, models.OrderStatusUsed, map[string]interface{}{
+		"use_time": &now,
+	}); err != nil {
+		return utils.ErrorResult(err.Error())
+	}
+	return utils.SuccessResult("核销成功")
+}
 
-	// 获取消费者信息
-	consumerInfo, err := dao.Redis.XInfoConsumers(ctx, streamKey, groupName).Result()
+// RefundVoucherOrder 退款（仅已支付未核销的订单），并回补库存
+// EN: Refund a paid order and give the stock back
+func RefundVoucherOrder(ctx context.Context, userId, orderId uint) *utils.Result {
+	order, res := getUserVoucherOrder(ctx, userId, orderId)
+	if res != nil {
+		return res
+	}
+	now := time.Now()
+	if err := transitVoucherOrder(ctx, order, models.OrderStatusRefunded, map[string]interface{}{
+		"refund_time": &now,
+	}); err != nil {
+		return utils.ErrorResult(err.Error())
+	}
+	return utils.SuccessResult("退款成功")
+}
+
+// CancelVoucherOrder 取消未支付订单，并回补库存
+// EN: Cancel an unpaid order and give the stock back
+func CancelVoucherOrder(ctx context.Context, userId, orderId uint) *utils.Result {
+	order, res := getUserVoucherOrder(ctx, userId, orderId)
+	if res != nil {
+		return res
+	}
+	if err := transitVoucherOrder(ctx, order, models.OrderStatusCancelled, map[string]interface{}{}); err != nil {
+		return utils.ErrorResult(err.Error())
+	}
+	return utils.SuccessResult("订单已取消")
+}
+
+// getUserVoucherOrder 查询订单并校验归属
+func getUserVoucherOrder(ctx context.Context, userId, orderId uint) (*models.VoucherOrder, *utils.Result) {
+	order, err := dao.GetVoucherOrderByOrderID(ctx, dao.DB, orderId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrorResult("订单不存在")
+		}
+		return nil, utils.ErrorResult("查询订单失败")
+	}
+	if order.UserID != userId {
+		return nil, utils.ErrorResult("订单不存在")
+	}
+	return order, nil
+}
+
+// transitVoucherOrder 在事务内完成状态迁移；迁移到已取消/已退款时同时回补库存
+// EN: Apply a validated status transition; cancel/refund also returns stock to DB and Redis
+func transitVoucherOrder(ctx context.Context, order *models.VoucherOrder, to int, updates map[string]interface{}) error {
+	if !canTransit(order.Status, to) {
+		return fmt.Errorf("当前订单状态不允许该操作")
+	}
+	releaseStock := to == models.OrderStatusCancelled || to == models.OrderStatusRefunded
+
+	now := time.Now()
+	updates["status"] = to
+	updates["update_time"] = &now
+
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("开始事务失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			log.Printf("订单状态迁移发生panic: %v", r)
+		}
+	}()
+
+	// 1) 以当前状态为条件更新，保证同一迁移只成功一次
+	ok, err := dao.UpdateVoucherOrderStatusFrom(ctx, tx, order.ID, order.Status, updates)
 	if err != nil {
-		return nil, fmt.Errorf("获取消费者信息失败: %v", err)
+		tx.Rollback()
+		return fmt.Errorf("更新订单状态失败")
+	}
+	if !ok {
+		tx.Rollback()
+		return fmt.Errorf("订单状态已变更，请刷新后重试")
+	}
+
+	// 2) 回补数据库库存（与状态更新在同一事务中）
+	quantity := orderQuantity(order)
+	if releaseStock {
+		if err := dao.IncreaseVoucherStock(ctx, tx, order.VoucherID, quantity); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("回补库存失败")
+		}
+		if order.VoucherType == 2 {
+			if err := dao.IncreaseSeckillVoucherStock(ctx, tx, order.VoucherID, quantity); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("回补秒杀库存失败")
+			}
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("提交事务失败")
 	}
+	from := order.Status
+	order.Status = to
 
-	return map[string]interface{}{
-		"stream":    streamInfo,
-		"groups":    groupInfo,
-		"consumers": consumerInfo,
-	}, nil
+	// 已离开未支付状态，移除超时取消任务
+	if from == models.OrderStatusUnpaid {
+		if _, err := dao.RemoveOrderPayTimeout(ctx, dao.Redis, order.OrderID); err != nil {
+			log.Printf("警告: 移除订单超时任务失败, orderID=%d, 错误=%v", order.OrderID, err)
+		}
+	}
+
+	// 3) 事务成功后回补 Redis 库存并释放限购名额（失败只记录日志）
+	if releaseStock && order.VoucherType == 2 {
+		releaseSeckillCache(ctx, order.VoucherID, order.UserID, quantity)
+	}
+
+	log.Printf("订单状态变更: orderID=%d, status=%d", order.OrderID, to)
+	return nil
+}
+
+// orderQuantity 订单购买数量（数量字段上线前的订单按1件处理）
+func orderQuantity(order *models.VoucherOrder) int {
+	if order.Quantity <= 0 {
+		return 1
+	}
+	return order.Quantity
+}
+
+// releaseSeckillCache 回补 Redis 秒杀库存并归还用户的限购名额
+func releaseSeckillCache(ctx context.Context, voucherID, userID uint, quantity int) {
+	if err := dao.IncrSeckillVoucherStockCache(ctx, dao.Redis, voucherID, quantity); err != nil {
+		log.Printf("警告: 回补秒杀库存缓存失败, voucherID=%d, 错误=%v", voucherID, err)
+	}
+	if err := dao.DecrSeckillVoucherUserBought(ctx, dao.Redis, voucherID, userID, quantity); err != nil {
+		log.Printf("警告: 归还秒杀限购名额失败, voucherID=%d, userID=%d, 错误=%v", voucherID, userID, err)
+	}
 }
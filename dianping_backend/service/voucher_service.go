@@ -5,13 +5,19 @@ import (
 	"dianping/dao"
 	"dianping/models"
 	"dianping/utils"
+	"errors"
+	"log"
+	"strconv"
 	"time"
+
+	"gorm.io/gorm"
 )
 
-// GetVoucherList 获取优惠券列表
-func GetVoucherList(shopId uint) *utils.Result {
-	var vouchers []models.Voucher
-	err := dao.DB.Where("shop_id = ? AND status = 1", shopId).Find(&vouchers).Error
+// GetVoucherList 获取优惠券列表（缓存商铺上架中的优惠券，空列表同样缓存）
+func GetVoucherList(ctx context.Context, shopId uint) *utils.Result {
+	vouchers, err := voucherListCache.Get(ctx, strconv.Itoa(int(shopId)), func(ctx context.Context) ([]models.Voucher, error) {
+		return dao.GetShopVouchers(ctx, dao.DB, shopId)
+	})
 	if err != nil {
 		return utils.ErrorResult("查询失败")
 	}
@@ -21,29 +27,31 @@ func GetVoucherList(shopId uint) *utils.Result {
 
 // AddSeckillVoucherRequest 添加秒杀券请求结构
 type AddSeckillVoucherRequest struct {
-	ShopID      uint      `json:"shopId" binding:"required"`
-	Title       string    `json:"title" binding:"required"`
-	SubTitle    string    `json:"subTitle"`
-	Rules       string    `json:"rules"`
-	PayValue    int64     `json:"payValue" binding:"required"`
-	ActualValue int64     `json:"actualValue" binding:"required"`
-	Stock       int       `json:"stock" binding:"required,min=1"`
-	BeginTime   time.Time `json:"beginTime" binding:"required"`
-	EndTime     time.Time `json:"endTime" binding:"required"`
+	ShopID       uint      `json:"shopId" binding:"required"`
+	Title        string    `json:"title" binding:"required"`
+	SubTitle     string    `json:"subTitle"`
+	Rules        string    `json:"rules"`
+	PayValue     int64     `json:"payValue" binding:"required"`
+	ActualValue  int64     `json:"actualValue" binding:"required"`
+	Stock        int       `json:"stock" binding:"required,min=1"`
+	LimitPerUser int       `json:"limitPerUser" binding:"omitempty,min=1"` // 每人限购数量，默认1
+	BeginTime    time.Time `json:"beginTime" binding:"required"`
+	EndTime      time.Time `json:"endTime" binding:"required"`
 }
 
 // AddVoucherRequest 添加普通券请求结构
 // EN: Request payload to create a normal voucher
 type AddVoucherRequest struct {
-    ShopID      uint       `json:"shopId" binding:"required"`
-    Title       string     `json:"title" binding:"required"`
-    SubTitle    string     `json:"subTitle"`
-    Rules       string     `json:"rules"`
-    PayValue    int64      `json:"payValue" binding:"required"`
-    ActualValue int64      `json:"actualValue" binding:"required"`
-    Stock       int        `json:"stock" binding:"required,min=0"`
-    BeginTime   *time.Time `json:"beginTime"` // 可选
-    EndTime     *time.Time `json:"endTime"`   // 可选
+    ShopID       uint       `json:"shopId" binding:"required"`
+    Title        string     `json:"title" binding:"required"`
+    SubTitle     string     `json:"subTitle"`
+    Rules        string     `json:"rules"`
+    PayValue     int64      `json:"payValue" binding:"required"`
+    ActualValue  int64      `json:"actualValue" binding:"required"`
+    Stock        int        `json:"stock" binding:"required,min=0"`
+    LimitPerUser int        `json:"limitPerUser" binding:"omitempty,min=0"` // 每人限购数量，0 表示不限购
+    BeginTime    *time.Time `json:"beginTime"`                              // 可选
+    EndTime      *time.Time `json:"endTime"`                                // 可选
 }
 
 // AddVoucher 添加普通券
@@ -58,17 +66,18 @@ func AddVoucher(ctx context.Context, req *AddVoucherRequest) *utils.Result {
     }
 
     voucher := &models.Voucher{
-        ShopID:      req.ShopID,
-        Title:       req.Title,
-        SubTitle:    req.SubTitle,
-        Rules:       req.Rules,
-        PayValue:    req.PayValue,
-        ActualValue: req.ActualValue,
-        Type:        0, // 0-普通券
-        Status:      1, // 上架
-        Stock:       req.Stock,
-        BeginTime:   req.BeginTime,
-        EndTime:     req.EndTime,
+        ShopID:       req.ShopID,
+        Title:        req.Title,
+        SubTitle:     req.SubTitle,
+        Rules:        req.Rules,
+        PayValue:     req.PayValue,
+        ActualValue:  req.ActualValue,
+        Type:         0, // 0-普通券
+        Status:       1, // 上架
+        Stock:        req.Stock,
+        LimitPerUser: req.LimitPerUser,
+        BeginTime:    req.BeginTime,
+        EndTime:      req.EndTime,
     }
 
     if err := dao.DB.WithContext(ctx).Create(voucher).Error; err != nil {
@@ -97,6 +106,13 @@ func AddSeckillVoucher(ctx context.Context, req *AddSeckillVoucherRequest) *util
 		return utils.ErrorResult("支付金额必须小于实际价值")
 	}
 
+	if req.LimitPerUser == 0 {
+		req.LimitPerUser = 1
+	}
+	if req.LimitPerUser > req.Stock {
+		return utils.ErrorResult("每人限购数量不能超过库存")
+	}
+
 	// 开启事务
 	tx := dao.DB.Begin()
 	if tx.Error != nil {
@@ -130,12 +146,13 @@ func AddSeckillVoucher(ctx context.Context, req *AddSeckillVoucherRequest) *util
 
 	// 2. 创建秒杀券记录
 	seckillVoucher := &models.SeckillVoucher{
-		VoucherID:  voucher.ID,
-		Stock:      req.Stock,
-		CreateTime: time.Now(),
-		BeginTime:  req.BeginTime,
-		EndTime:    req.EndTime,
-		UpdateTime: time.Now(),
+		VoucherID:    voucher.ID,
+		Stock:        req.Stock,
+		LimitPerUser: req.LimitPerUser,
+		CreateTime:   time.Now(),
+		BeginTime:    req.BeginTime,
+		EndTime:      req.EndTime,
+		UpdateTime:   time.Now(),
 	}
 
 	if err := tx.Create(seckillVoucher).Error; err != nil {
@@ -144,7 +161,7 @@ func AddSeckillVoucher(ctx context.Context, req *AddSeckillVoucherRequest) *util
 	}
 
 	// 创建秒杀券缓存
-	if err := dao.SetSeckillVoucherStockCache(ctx, dao.Redis, seckillVoucher.VoucherID, seckillVoucher.Stock); err != nil {
+	if err := dao.SetSeckillVoucherCache(ctx, dao.Redis, seckillVoucher, seckillVoucher.Stock, voucher.Status); err != nil {
 		tx.Rollback()
 		return utils.ErrorResult("创建秒杀券缓存失败")
 	}
@@ -187,3 +204,304 @@ func GetSeckillVoucher(voucherID uint) *utils.Result {
 
 	return utils.SuccessResultWithData(result)
 }
+
+// ================= 秒杀券生命周期管理 =================
+
+// UpdateSeckillVoucherRequest 编辑秒杀券请求结构，未传的字段保持不变
+// EN: Partial update of a seckill voucher
+type UpdateSeckillVoucherRequest struct {
+	Title        *string    `json:"title" binding:"omitempty,min=1"`
+	SubTitle     *string    `json:"subTitle"`
+	Rules        *string    `json:"rules"`
+	PayValue     *int64     `json:"payValue" binding:"omitempty,min=1"`
+	ActualValue  *int64     `json:"actualValue" binding:"omitempty,min=1"`
+	LimitPerUser *int       `json:"limitPerUser" binding:"omitempty,min=1"`
+	BeginTime    *time.Time `json:"beginTime"`
+	EndTime      *time.Time `json:"endTime"`
+	Force        bool       `json:"force"` // 秒杀进行中也强制修改
+}
+
+// UpdateSeckillVoucher 编辑秒杀券，同步更新 MySQL 与 Redis 元数据
+// EN: Edit a seckill voucher and refresh the cached limit/time window
+func UpdateSeckillVoucher(ctx context.Context, voucherID uint, req *UpdateSeckillVoucherRequest) *utils.Result {
+	voucher, seckillVoucher, res := getSeckillVoucherForUpdate(voucherID, req.Force)
+	if res != nil {
+		return res
+	}
+
+	updates := map[string]interface{}{}
+	if req.Title != nil {
+		updates["title"] = *req.Title
+	}
+	if req.SubTitle != nil {
+		updates["sub_title"] = *req.SubTitle
+	}
+	if req.Rules != nil {
+		updates["rules"] = *req.Rules
+	}
+	if req.PayValue != nil {
+		voucher.PayValue = *req.PayValue
+		updates["pay_value"] = *req.PayValue
+	}
+	if req.ActualValue != nil {
+		voucher.ActualValue = *req.ActualValue
+		updates["actual_value"] = *req.ActualValue
+	}
+	if req.LimitPerUser != nil {
+		seckillVoucher.LimitPerUser = *req.LimitPerUser
+	}
+	if req.BeginTime != nil {
+		seckillVoucher.BeginTime = *req.BeginTime
+		updates["begin_time"] = *req.BeginTime
+	}
+	if req.EndTime != nil {
+		seckillVoucher.EndTime = *req.EndTime
+		updates["end_time"] = *req.EndTime
+	}
+
+	// 校验修改后的数据
+	if voucher.PayValue >= voucher.ActualValue {
+		return utils.ErrorResult("支付金额必须小于实际价值")
+	}
+	if seckillVoucher.EndTime.Before(seckillVoucher.BeginTime) {
+		return utils.ErrorResult("结束时间不能早于开始时间")
+	}
+
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if len(updates) > 0 {
+		if err := dao.UpdateVoucherFields(ctx, tx, voucherID, updates); err != nil {
+			tx.Rollback()
+			return utils.ErrorResult("更新优惠券失败")
+		}
+	}
+	seckillVoucher.UpdateTime = time.Now()
+	if err := dao.UpdateSeckillVoucher(ctx, tx, seckillVoucher); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("更新秒杀券失败")
+	}
+
+	// 更新限购与时间窗缓存，失败时回滚数据库
+	if err := dao.SetSeckillVoucherMetaCache(ctx, dao.Redis, seckillVoucher); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("更新秒杀券缓存失败")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return utils.ErrorResult("事务提交失败")
+	}
+	return utils.SuccessResult("秒杀券更新成功")
+}
+
+// SetSeckillVoucherStatus 上架/下架秒杀券（1-上架，2-下架）
+// EN: Put a seckill voucher on or off the shelf
+func SetSeckillVoucherStatus(ctx context.Context, voucherID uint, status int, force bool) *utils.Result {
+	voucher, seckillVoucher, res := getSeckillVoucherForUpdate(voucherID, force)
+	if res != nil {
+		return res
+	}
+	if voucher.Status == models.VoucherStatusShopDeleted {
+		return utils.ErrorResult("商铺已删除，恢复商铺后优惠券自动上架")
+	}
+	if voucher.Status == status {
+		return utils.SuccessResult("状态未变化")
+	}
+
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := dao.UpdateVoucherFields(ctx, tx, voucherID, map[string]interface{}{"status": status}); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("更新状态失败")
+	}
+
+	// 重新上架时库存缓存可能已过期，按数据库库存扣除在途订单重建
+	if status == models.VoucherStatusOnShelf {
+		if _, exists, err := dao.GetSeckillVoucherStockCache(ctx, dao.Redis, voucherID); err != nil || !exists {
+			if err := rebuildSeckillStockCache(ctx, seckillVoucher, status); err != nil {
+				tx.Rollback()
+				return utils.ErrorResult("重建秒杀库存缓存失败")
+			}
+		}
+	}
+	if err := dao.SetSeckillVoucherStatusCache(ctx, dao.Redis, voucherID, status); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("更新秒杀券缓存失败")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		// 数据库未更新，恢复缓存中的状态
+		if err := dao.SetSeckillVoucherStatusCache(ctx, dao.Redis, voucherID, voucher.Status); err != nil {
+			log.Printf("警告: 恢复秒杀券状态缓存失败, voucherID=%d, 错误=%v", voucherID, err)
+		}
+		return utils.ErrorResult("事务提交失败")
+	}
+	return utils.SuccessResult("状态更新成功")
+}
+
+// RestockSeckillVoucher 调整秒杀券库存（delta 为正补货，为负减库存），同时调整 tb_voucher 与 Redis 库存
+// 按增量调整，不影响进行中的秒杀，因此不需要 force
+// EN: Add (or remove) stock in MySQL and Redis atomically per voucher
+func RestockSeckillVoucher(ctx context.Context, voucherID uint, delta int) *utils.Result {
+	if _, err := dao.GetSeckillVoucherByID(voucherID); err != nil {
+		return utils.ErrorResult("秒杀券不存在")
+	}
+	voucher, err := dao.GetVoucherByID(ctx, dao.DB, voucherID)
+	if err != nil {
+		return utils.ErrorResult("优惠券不存在")
+	}
+
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if delta > 0 {
+		if err := dao.IncreaseSeckillVoucherStock(ctx, tx, voucherID, delta); err != nil {
+			tx.Rollback()
+			return utils.ErrorResult("更新秒杀库存失败")
+		}
+		if err := dao.IncreaseVoucherStock(ctx, tx, voucherID, delta); err != nil {
+			tx.Rollback()
+			return utils.ErrorResult("更新优惠券库存失败")
+		}
+	} else {
+		if err := dao.UpdateSeckillVoucherStock(ctx, tx, voucherID, -delta); err != nil {
+			tx.Rollback()
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.ErrorResult("库存不足，无法扣减")
+			}
+			return utils.ErrorResult("更新秒杀库存失败")
+		}
+		ok, err := dao.DecreaseVoucherStock(ctx, tx, voucherID, -delta)
+		if err != nil || !ok {
+			tx.Rollback()
+			return utils.ErrorResult("更新优惠券库存失败")
+		}
+	}
+
+	// Redis 库存按同样的增量调整；缓存不存在时按数据库库存重建
+	_, exists, err := dao.AdjustSeckillVoucherStockCache(ctx, dao.Redis, voucherID, delta)
+	if err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("调整Redis库存失败: " + err.Error())
+	}
+	if !exists {
+		// 在事务内加锁重新读取调整后的库存：消费者创建订单时锁同一行，
+		// 此后提交的订单都还在在途件数中，重建不会漏扣
+		latest, err := dao.GetSeckillVoucherForUpdate(ctx, tx, voucherID)
+		if err != nil {
+			tx.Rollback()
+			return utils.ErrorResult("读取秒杀库存失败")
+		}
+		if err := rebuildSeckillStockCache(ctx, latest, voucher.Status); err != nil {
+			tx.Rollback()
+			return utils.ErrorResult("重建秒杀库存缓存失败")
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		// 数据库未更新，撤销 Redis 的调整
+		if _, _, err := dao.AdjustSeckillVoucherStockCache(ctx, dao.Redis, voucherID, -delta); err != nil {
+			log.Printf("警告: 撤销Redis库存调整失败, voucherID=%d, 错误=%v", voucherID, err)
+		}
+		return utils.ErrorResult("事务提交失败")
+	}
+	return utils.SuccessResult("库存调整成功")
+}
+
+// DeleteSeckillVoucher 删除秒杀券：软删除优惠券、删除秒杀券记录并清理 Redis 缓存
+// 布隆过滤器不支持删除，之后的查询会穿透到数据库并得到"不存在"
+// EN: Delete a seckill voucher and its caches (bloom filter entries cannot be removed)
+func DeleteSeckillVoucher(ctx context.Context, voucherID uint, force bool) *utils.Result {
+	if _, _, res := getSeckillVoucherForUpdate(voucherID, force); res != nil {
+		return res
+	}
+
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := dao.DeleteSeckillVoucher(ctx, tx, voucherID); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("删除秒杀券失败")
+	}
+	if err := dao.DeleteVoucher(ctx, tx, voucherID); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("删除优惠券失败")
+	}
+
+	// 先标记下架阻止新的秒杀，提交成功后再删除缓存
+	if err := dao.SetSeckillVoucherStatusCache(ctx, dao.Redis, voucherID, models.VoucherStatusOffShelf); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("更新秒杀券缓存失败")
+	}
+	if err := tx.Commit().Error; err != nil {
+		return utils.ErrorResult("事务提交失败")
+	}
+	if err := dao.DeleteSeckillVoucherCache(ctx, dao.Redis, voucherID); err != nil {
+		log.Printf("警告: 删除秒杀券缓存失败, voucherID=%d, 错误=%v", voucherID, err)
+	}
+	return utils.SuccessResult("秒杀券已删除")
+}
+
+// getSeckillVoucherForUpdate 查询秒杀券并检查是否允许修改：上架且在秒杀时间内的券需要 force
+func getSeckillVoucherForUpdate(voucherID uint, force bool) (*models.Voucher, *models.SeckillVoucher, *utils.Result) {
+	var voucher models.Voucher
+	if err := dao.DB.First(&voucher, voucherID).Error; err != nil {
+		return nil, nil, utils.ErrorResult("优惠券不存在")
+	}
+	if voucher.Type != 1 {
+		return nil, nil, utils.ErrorResult("该优惠券不是秒杀券")
+	}
+	seckillVoucher, err := dao.GetSeckillVoucherByID(voucherID)
+	if err != nil {
+		return nil, nil, utils.ErrorResult("秒杀券信息获取失败")
+	}
+
+	now := time.Now()
+	inProgress := voucher.Status == models.VoucherStatusOnShelf && !now.Before(seckillVoucher.BeginTime) && !now.After(seckillVoucher.EndTime)
+	if inProgress && !force {
+		return nil, nil, utils.ErrorResult("秒杀进行中，不允许修改（如需修改请设置 force）")
+	}
+	return &voucher, seckillVoucher, nil
+}
+
+// rebuildSeckillStockCache 按数据库库存扣除在途订单重建 Redis 库存与元数据，status 为 tb_voucher 的上下架状态
+func rebuildSeckillStockCache(ctx context.Context, v *models.SeckillVoucher, status int) error {
+	inFlight, err := orderQueue.InFlight(ctx)
+	if err != nil {
+		return err
+	}
+	stock := v.Stock - inFlight[v.VoucherID]
+	if stock < 0 {
+		stock = 0
+	}
+	return dao.SetSeckillVoucherCache(ctx, dao.Redis, v, stock, status)
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
@@ -14,6 +15,7 @@ import (
 // BloomFilterConfig 布隆过滤器配置
 type BloomFilterConfig struct {
 	Key        string  // 过滤器键名
+	Type       string  // 过滤器类型：bloom（默认）或 cuckoo（支持删除）
 	ErrorRate  float64 // 误判率
 	Capacity   uint    // 初始容量
 	Expansion  uint    // 扩容倍数，默认2
@@ -22,8 +24,9 @@ type BloomFilterConfig struct {
 
 // BloomFilter 布隆过滤器操作接口
 type BloomFilter struct {
-	config BloomFilterConfig
-	rdb    *redis.Client
+	config  BloomFilterConfig
+	rdb     *redis.Client
+	backend bloomBackend // 存储后端：RedisBloom、Redis 位图或进程内位图
 }
 
 // NewBloomFilter 创建新的布隆过滤器实例
@@ -38,78 +41,39 @@ func NewBloomFilter(rdb *redis.Client, config BloomFilterConfig) *BloomFilter {
 	if config.Expansion == 0 {
 		config.Expansion = 2 // 默认2倍扩容
 	}
+	// 只有 RedisBloom 支持布谷鸟过滤器，其他后端退化为布隆过滤器
+	if config.Type == "" || CurrentBloomBackend() != BloomBackendRedisBloom {
+		config.Type = BloomTypeBloom
+	}
 
 	return &BloomFilter{
-		config: config,
-		rdb:    rdb,
+		config:  config,
+		rdb:     rdb,
+		backend: newBloomBackend(rdb, config),
 	}
 }
 
 // Reserve 创建布隆过滤器
 func (bf *BloomFilter) Reserve(ctx context.Context) error {
-	args := []interface{}{"BF.RESERVE", bf.config.Key, bf.config.ErrorRate, bf.config.Capacity}
-
-	// 添加可选参数
-	if bf.config.Expansion != 2 {
-		args = append(args, "EXPANSION", bf.config.Expansion)
-	}
-	if bf.config.NonScaling {
-		args = append(args, "NONSCALING")
-	}
-
-	err := bf.rdb.Do(ctx, args...).Err()
-	if err != nil {
-		// 如果过滤器已存在，忽略错误
-		if err.Error() == "ERR item exists" {
-			return nil
-		}
-		return fmt.Errorf("创建布隆过滤器失败: %v", err)
-	}
-	return nil
+	return bf.backend.reserve(ctx, bf.config.Key)
 }
 
-// Add 添加单个元素到布隆过滤器
+// Add 添加单个元素到布隆过滤器（重建期间同时写入新过滤器）
 func (bf *BloomFilter) Add(ctx context.Context, item string) (bool, error) {
-	result, err := bf.rdb.Do(ctx, "BF.ADD", bf.config.Key, item).Int()
-	if err != nil {
-		return false, fmt.Errorf("添加元素到布隆过滤器失败: %v", err)
-	}
-	return result == 1, nil
+	return bf.backend.add(ctx, bf.config.Key, bf.rebuildKey(), item)
 }
 
-// AddMulti 批量添加元素到布隆过滤器
+// AddMulti 批量添加元素到布隆过滤器（重建期间同时写入新过滤器）
 func (bf *BloomFilter) AddMulti(ctx context.Context, items []string) ([]bool, error) {
 	if len(items) == 0 {
 		return []bool{}, nil
 	}
-
-	args := []interface{}{"BF.MADD", bf.config.Key}
-	for _, item := range items {
-		args = append(args, item)
-	}
-
-	results, err := bf.rdb.Do(ctx, args...).Slice()
-	if err != nil {
-		return nil, fmt.Errorf("批量添加元素到布隆过滤器失败: %v", err)
-	}
-
-	boolResults := make([]bool, len(results))
-	for i, result := range results {
-		if val, ok := result.(int64); ok {
-			boolResults[i] = val == 1
-		}
-	}
-
-	return boolResults, nil
+	return bf.backend.addMulti(ctx, bf.config.Key, bf.rebuildKey(), items)
 }
 
 // Exists 检查单个元素是否存在于布隆过滤器中
 func (bf *BloomFilter) Exists(ctx context.Context, item string) (bool, error) {
-	result, err := bf.rdb.Do(ctx, "BF.EXISTS", bf.config.Key, item).Int()
-	if err != nil {
-		return false, fmt.Errorf("检查布隆过滤器元素失败: %v", err)
-	}
-	return result == 1, nil
+	return bf.backend.exists(ctx, bf.config.Key, item)
 }
 
 // ExistsMulti 批量检查元素是否存在于布隆过滤器中
@@ -117,53 +81,17 @@ func (bf *BloomFilter) ExistsMulti(ctx context.Context, items []string) ([]bool,
 	if len(items) == 0 {
 		return []bool{}, nil
 	}
-
-	args := []interface{}{"BF.MEXISTS", bf.config.Key}
-	for _, item := range items {
-		args = append(args, item)
-	}
-
-	results, err := bf.rdb.Do(ctx, args...).Slice()
-	if err != nil {
-		return nil, fmt.Errorf("批量检查布隆过滤器元素失败: %v", err)
-	}
-
-	boolResults := make([]bool, len(results))
-	for i, result := range results {
-		if val, ok := result.(int64); ok {
-			boolResults[i] = val == 1
-		}
-	}
-
-	return boolResults, nil
+	return bf.backend.existsMulti(ctx, bf.config.Key, items)
 }
 
 // Info 获取布隆过滤器信息
 func (bf *BloomFilter) Info(ctx context.Context) (map[string]interface{}, error) {
-	results, err := bf.rdb.Do(ctx, "BF.INFO", bf.config.Key).Slice()
-	if err != nil {
-		return nil, fmt.Errorf("获取布隆过滤器信息失败: %v", err)
-	}
-
-	info := make(map[string]interface{})
-	for i := 0; i < len(results); i += 2 {
-		if i+1 < len(results) {
-			key := fmt.Sprintf("%v", results[i])
-			value := results[i+1]
-			info[key] = value
-		}
-	}
-
-	return info, nil
+	return bf.backend.info(ctx, bf.config.Key)
 }
 
 // Delete 删除布隆过滤器
 func (bf *BloomFilter) Delete(ctx context.Context) error {
-	err := bf.rdb.Del(ctx, bf.config.Key).Err()
-	if err != nil {
-		return fmt.Errorf("删除布隆过滤器失败: %v", err)
-	}
-	return nil
+	return bf.backend.del(ctx, bf.config.Key)
 }
 
 // 便利函数：将数字ID转换为字符串
@@ -283,42 +211,9 @@ func (bi *BloomInitializer) initBloomFilterWithIDs(ctx context.Context, config B
 	if getIDsFunc == nil {
 		return fmt.Errorf("getIDsFunc不能为空")
 	}
-	
-	// 创建布隆过滤器
-	bf := NewBloomFilter(bi.rdb, config)
-	
-	// 创建或重置布隆过滤器
-	if err := bf.Reserve(ctx); err != nil {
-		return fmt.Errorf("创建布隆过滤器失败: %v", err)
-	}
-	
-	// 获取所有ID
-	ids, err := getIDsFunc(ctx, bi.db)
-	if err != nil {
-		return fmt.Errorf("获取ID列表失败: %v", err)
-	}
-	
-	if len(ids) == 0 {
-		log.Printf("警告: %s 没有找到任何数据", config.Key)
-		return nil
-	}
-	
-	// 批量添加ID到布隆过滤器
-	results, err := bf.AddIDs(ctx, ids)
-	if err != nil {
-		return fmt.Errorf("批量添加ID到布隆过滤器失败: %v", err)
-	}
-	
-	// 统计添加结果
-	addedCount := 0
-	for _, added := range results {
-		if added {
-			addedCount++
-		}
-	}
-	
-	log.Printf("布隆过滤器 %s 初始化完成: 总数据量=%d, 新增=%d", config.Key, len(ids), addedCount)
-	return nil
+	return bi.rebuildBloomFilter(ctx, config, func(ctx context.Context) ([]uint, error) {
+		return getIDsFunc(ctx, bi.db)
+	})
 }
 
 // initBloomFilterWithUserIDs 用户布隆过滤器初始化方法（无context参数）
@@ -326,42 +221,9 @@ func (bi *BloomInitializer) initBloomFilterWithUserIDs(ctx context.Context, conf
 	if getIDsFunc == nil {
 		return fmt.Errorf("getIDsFunc不能为空")
 	}
-	
-	// 创建布隆过滤器
-	bf := NewBloomFilter(bi.rdb, config)
-	
-	// 创建或重置布隆过滤器
-	if err := bf.Reserve(ctx); err != nil {
-		return fmt.Errorf("创建布隆过滤器失败: %v", err)
-	}
-	
-	// 获取所有ID
-	ids, err := getIDsFunc()
-	if err != nil {
-		return fmt.Errorf("获取ID列表失败: %v", err)
-	}
-	
-	if len(ids) == 0 {
-		log.Printf("警告: %s 没有找到任何数据", config.Key)
-		return nil
-	}
-	
-	// 批量添加ID到布隆过滤器
-	results, err := bf.AddIDs(ctx, ids)
-	if err != nil {
-		return fmt.Errorf("批量添加ID到布隆过滤器失败: %v", err)
-	}
-	
-	// 统计添加结果
-	addedCount := 0
-	for _, added := range results {
-		if added {
-			addedCount++
-		}
-	}
-	
-	log.Printf("布隆过滤器 %s 初始化完成: 总数据量=%d, 新增=%d", config.Key, len(ids), addedCount)
-	return nil
+	return bi.rebuildBloomFilter(ctx, config, func(context.Context) ([]uint, error) {
+		return getIDsFunc()
+	})
 }
 
 // initBloomFilterWithVoucherIDs 优惠券布隆过滤器初始化方法（无context参数）
@@ -369,41 +231,28 @@ func (bi *BloomInitializer) initBloomFilterWithVoucherIDs(ctx context.Context, c
 	if getIDsFunc == nil {
 		return fmt.Errorf("getIDsFunc不能为空")
 	}
-	
-	// 创建布隆过滤器
+	return bi.rebuildBloomFilter(ctx, config, func(context.Context) ([]uint, error) {
+		return getIDsFunc()
+	})
+}
+
+// rebuildBloomFilter 从数据库全量重建过滤器并原子替换，已有的过滤器（包括类型不同的）会被整体替换；
+// 其他实例正在重建时跳过
+func (bi *BloomInitializer) rebuildBloomFilter(ctx context.Context, config BloomFilterConfig, loadIDs func(context.Context) ([]uint, error)) error {
 	bf := NewBloomFilter(bi.rdb, config)
-	
-	// 创建或重置布隆过滤器
-	if err := bf.Reserve(ctx); err != nil {
-		return fmt.Errorf("创建布隆过滤器失败: %v", err)
-	}
-	
-	// 获取所有ID
-	ids, err := getIDsFunc()
-	if err != nil {
-		return fmt.Errorf("获取ID列表失败: %v", err)
-	}
-	
-	if len(ids) == 0 {
-		log.Printf("警告: %s 没有找到任何数据", config.Key)
+	result, err := bf.Rebuild(ctx, loadIDs)
+	if errors.Is(err, ErrBloomRebuilding) {
+		log.Printf("布隆过滤器 %s 正在由其他实例重建，跳过", config.Key)
 		return nil
 	}
-	
-	// 批量添加ID到布隆过滤器
-	results, err := bf.AddIDs(ctx, ids)
 	if err != nil {
-		return fmt.Errorf("批量添加ID到布隆过滤器失败: %v", err)
+		return err
 	}
-	
-	// 统计添加结果
-	addedCount := 0
-	for _, added := range results {
-		if added {
-			addedCount++
-		}
+	if result.Items == 0 {
+		log.Printf("警告: %s 没有找到任何数据", config.Key)
 	}
-	
-	log.Printf("布隆过滤器 %s 初始化完成: 总数据量=%d, 新增=%d", config.Key, len(ids), addedCount)
+
+	log.Printf("布隆过滤器 %s 初始化完成: 类型=%s, 总数据量=%d, 容量=%d", config.Key, result.Type, result.Items, result.Capacity)
 	return nil
 }
 
@@ -440,7 +289,7 @@ func (bi *BloomInitializer) InitAllBloomFilters(ctx context.Context,
 	return nil
 }
 
-// CheckBloomFilterHealth 检查布隆过滤器健康状态
+// CheckBloomFilterHealth 检查布隆过滤器健康状态（INFO、类型、上次重建信息、待清理元素数量）
 func (bi *BloomInitializer) CheckBloomFilterHealth(ctx context.Context) map[string]interface{} {
 	health := make(map[string]interface{})
 	
@@ -448,17 +297,16 @@ func (bi *BloomInitializer) CheckBloomFilterHealth(ctx context.Context) map[stri
 	
 	for _, config := range configs {
 		bf := NewBloomFilter(bi.rdb, config)
-		info, err := bf.Info(ctx)
+		stats, err := bf.Stats(ctx)
 		if err != nil {
 			health[config.Key] = map[string]interface{}{
 				"status": "error",
+				"type":   bf.config.Type,
 				"error":  err.Error(),
 			}
 		} else {
-			health[config.Key] = map[string]interface{}{
-				"status": "healthy",
-				"info":   info,
-			}
+			stats["status"] = "healthy"
+			health[config.Key] = stats
 		}
 	}
 	
@@ -519,24 +367,25 @@ func CheckIDExists(filterType string, id uint) bool {
 
 // CheckIDExistsWithRedis 检查ID是否存在于指定布隆过滤器中（带Redis连接）
 func CheckIDExistsWithRedis(ctx context.Context, rdb *redis.Client, filterType string, id uint) (bool, error) {
-	var key string
+	var config BloomFilterConfig
 	
 	switch filterType {
 	case "shop":
-		key = ShopBloomConfig.Key
+		config = ShopBloomConfig
 	case "user":
-		key = UserBloomConfig.Key
+		config = UserBloomConfig
 	case "voucher":
-		key = VoucherBloomConfig.Key
+		config = VoucherBloomConfig
 	default:
 		return false, fmt.Errorf("不支持的过滤器类型: %s", filterType)
 	}
 	
-	// 将ID转换为字符串
-	idStr := strconv.FormatUint(uint64(id), 10)
+	if rdb == nil {
+		return false, fmt.Errorf("Redis客户端不能为空")
+	}
 	
-	// 使用通用函数检查
-	return CheckStringExistsInBloomFilter(ctx, rdb, key, idStr)
+	// 按过滤器类型（布隆/布谷鸟）检查
+	return NewBloomFilter(rdb, config).ExistsID(ctx, id)
 }
 
 // CheckStringExistsInBloomFilter 通用函数：检查字符串是否存在于指定key的布隆过滤器中
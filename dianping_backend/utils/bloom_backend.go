@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 过滤器存储后端
+const (
+	BloomBackendAuto       = "auto"       // 启动时探测：Redis 支持 BF.* 命令时使用 redisbloom，否则使用 bitmap
+	BloomBackendRedisBloom = "redisbloom" // RedisBloom 模块（redis-stack），支持布谷鸟过滤器和自动扩容
+	BloomBackendBitmap     = "bitmap"     // 普通 Redis 的 SETBIT/GETBIT，自行计算哈希，不支持删除和自动扩容
+	BloomBackendMemory     = "memory"     // 进程内位图，仅用于单机开发和测试
+)
+
+// bloomBackend 过滤器底层存储。shadowKey 为重建中的临时 key，存在时写操作需要同时写入
+type bloomBackend interface {
+	reserve(ctx context.Context, key string) error
+	add(ctx context.Context, key, shadowKey, item string) (bool, error)
+	addMulti(ctx context.Context, key, shadowKey string, items []string) ([]bool, error)
+	exists(ctx context.Context, key, item string) (bool, error)
+	existsMulti(ctx context.Context, key string, items []string) ([]bool, error)
+	remove(ctx context.Context, key, shadowKey, item string) (bool, error)
+	info(ctx context.Context, key string) (map[string]interface{}, error)
+	keyExists(ctx context.Context, key string) (bool, error)
+	del(ctx context.Context, key string) error
+	rename(ctx context.Context, from, to string) error
+}
+
+var (
+	bloomBackendMu   sync.RWMutex
+	bloomBackendName = BloomBackendRedisBloom
+)
+
+// SetBloomBackend 设置过滤器存储后端（redisbloom、bitmap、memory），需要在初始化过滤器之前调用
+func SetBloomBackend(name string) {
+	bloomBackendMu.Lock()
+	defer bloomBackendMu.Unlock()
+	bloomBackendName = name
+}
+
+// CurrentBloomBackend 当前使用的过滤器存储后端
+func CurrentBloomBackend() string {
+	bloomBackendMu.RLock()
+	defer bloomBackendMu.RUnlock()
+	return bloomBackendName
+}
+
+// DetectBloomBackend 探测 Redis 是否加载了 RedisBloom 模块：支持 BF.EXISTS 时返回 redisbloom，
+// 命令不存在时返回 bitmap；其他错误（如连接失败）原样返回
+// EN: Probe for the RedisBloom module and fall back to plain-Redis bitmaps when it is missing
+func DetectBloomBackend(ctx context.Context, rdb *redis.Client) (string, error) {
+	err := rdb.Do(ctx, "BF.EXISTS", "bloom:probe", "0").Err()
+	if err == nil {
+		return BloomBackendRedisBloom, nil
+	}
+	if strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+		return BloomBackendBitmap, nil
+	}
+	return "", err
+}
+
+// newBloomBackend 按当前后端创建过滤器存储
+func newBloomBackend(rdb *redis.Client, config BloomFilterConfig) bloomBackend {
+	switch CurrentBloomBackend() {
+	case BloomBackendBitmap:
+		return &bitmapBloomBackend{rdb: rdb, config: config}
+	case BloomBackendMemory:
+		return &memoryBloomBackend{config: config}
+	}
+	return &redisBloomBackend{rdb: rdb, config: config}
+}
+
+// bloomParams 按容量和误判率计算位数组长度 m 与哈希函数个数 k：
+// m = -n·ln(p) / (ln2)²，k = m/n·ln2；m 最大 2^32（Redis 字符串上限 512MB）
+func bloomParams(capacity uint, errorRate float64) (bits uint64, hashes int) {
+	n := float64(capacity)
+	m := math.Ceil(-n * math.Log(errorRate) / (math.Ln2 * math.Ln2))
+	if m > math.MaxUint32 {
+		m = math.MaxUint32
+	}
+	if m < 64 {
+		m = 64
+	}
+	k := int(math.Round(m / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return uint64(m), k
+}
+
+// bloomHashes 计算元素的两个基础哈希（双重哈希：第 i 个位置为 h1 + i·h2 mod m），
+// 取 64 位 FNV-1a 的高低 32 位，h2 保证为奇数
+func bloomHashes(item string) (h1, h2 uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	sum := h.Sum64()
+	return sum & math.MaxUint32, (sum >> 32) | 1
+}
+
+// bloomOffsets 计算元素在长度为 m 的位数组上的 k 个位置
+func bloomOffsets(item string, bits uint64, hashes int) []uint64 {
+	h1, h2 := bloomHashes(item)
+	offsets := make([]uint64, hashes)
+	for i := range offsets {
+		offsets[i] = (h1 + uint64(i)*h2) % bits
+	}
+	return offsets
+}
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// bitmapAddScript 设置元素对应的 k 个位并返回是否为新元素，重建期间同时写入临时过滤器
+// KEYS[1] 位图，KEYS[2] 参数 hash，KEYS[3] 临时位图，KEYS[4] 临时参数 hash；ARGV 为每个元素的 h1、h2
+var bitmapAddScript = redis.NewScript(`
+local function params(key)
+	local p = redis.call('HMGET', key, 'bits', 'hashes')
+	return tonumber(p[1]), tonumber(p[2])
+end
+
+local function add(bits, paramsKey, m, k, h1, h2)
+	local added = 0
+	for i = 0, k - 1 do
+		if redis.call('SETBIT', bits, (h1 + i * h2) % m, 1) == 0 then
+			added = 1
+		end
+	end
+	if added == 1 then
+		redis.call('HINCRBY', paramsKey, 'items', 1)
+	end
+	return added
+end
+
+local m, k = params(KEYS[2])
+if not m or not k then
+	return redis.error_reply('ERR bloom filter not found')
+end
+local sm, sk = params(KEYS[4])
+
+local results = {}
+for i = 1, #ARGV, 2 do
+	local h1, h2 = tonumber(ARGV[i]), tonumber(ARGV[i + 1])
+	results[#results + 1] = add(KEYS[1], KEYS[2], m, k, h1, h2)
+	if sm and sk then
+		add(KEYS[3], KEYS[4], sm, sk, h1, h2)
+	end
+end
+return results
+`)
+
+// bitmapExistsScript 检查元素对应的 k 个位是否全部为 1
+// KEYS[1] 位图，KEYS[2] 参数 hash；ARGV 为每个元素的 h1、h2
+var bitmapExistsScript = redis.NewScript(`
+local p = redis.call('HMGET', KEYS[2], 'bits', 'hashes')
+local m, k = tonumber(p[1]), tonumber(p[2])
+if not m or not k then
+	return redis.error_reply('ERR bloom filter not found')
+end
+
+local results = {}
+for i = 1, #ARGV, 2 do
+	local h1, h2 = tonumber(ARGV[i]), tonumber(ARGV[i + 1])
+	local found = 1
+	for j = 0, k - 1 do
+		if redis.call('GETBIT', KEYS[1], (h1 + j * h2) % m) == 0 then
+			found = 0
+			break
+		end
+	end
+	results[#results + 1] = found
+end
+return results
+`)
+
+// bitmapBloomBackend 基于普通 Redis 位图（SETBIT/GETBIT）的布隆过滤器，用于没有 RedisBloom 模块的环境。
+// 位数组长度和哈希函数个数按容量和误判率计算后保存在 <key>:params 中，不支持删除和自动扩容，
+// 超出容量后误判率上升，由定期重建按当前数据量重新分配
+type bitmapBloomBackend struct {
+	rdb    *redis.Client
+	config BloomFilterConfig
+}
+
+func bitmapParamsKey(key string) string {
+	return key + ":params"
+}
+
+// hashArgs 计算每个元素的两个基础哈希作为脚本参数，位置在脚本中计算，保证与 memory 后端一致
+func (b *bitmapBloomBackend) hashArgs(items []string) []interface{} {
+	args := make([]interface{}, 0, 2*len(items))
+	for _, item := range items {
+		h1, h2 := bloomHashes(item)
+		args = append(args, h1, h2)
+	}
+	return args
+}
+
+func (b *bitmapBloomBackend) reserve(ctx context.Context, key string) error {
+	n, err := b.rdb.Exists(ctx, bitmapParamsKey(key)).Result()
+	if err != nil {
+		return fmt.Errorf("创建布隆过滤器失败: %v", err)
+	}
+	if n == 1 {
+		return nil
+	}
+
+	bits, hashes := bloomParams(b.config.Capacity, b.config.ErrorRate)
+	_, err = b.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, bitmapParamsKey(key), map[string]interface{}{
+			"bits":      bits,
+			"hashes":    hashes,
+			"capacity":  b.config.Capacity,
+			"errorRate": b.config.ErrorRate,
+			"items":     0,
+		})
+		// 预先分配整个位图，避免运行时逐步扩展字符串
+		pipe.SetBit(ctx, key, int64(bits-1), 0)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("创建布隆过滤器失败: %v", err)
+	}
+	return nil
+}
+
+func (b *bitmapBloomBackend) add(ctx context.Context, key, shadowKey, item string) (bool, error) {
+	results, err := b.run(ctx, key, shadowKey, []string{item})
+	if err != nil {
+		return false, fmt.Errorf("添加元素到布隆过滤器失败: %v", err)
+	}
+	return results[0], nil
+}
+
+func (b *bitmapBloomBackend) addMulti(ctx context.Context, key, shadowKey string, items []string) ([]bool, error) {
+	results, err := b.run(ctx, key, shadowKey, items)
+	if err != nil {
+		return nil, fmt.Errorf("批量添加元素到布隆过滤器失败: %v", err)
+	}
+	return results, nil
+}
+
+func (b *bitmapBloomBackend) run(ctx context.Context, key, shadowKey string, items []string) ([]bool, error) {
+	keys := []string{key, bitmapParamsKey(key), shadowKey, bitmapParamsKey(shadowKey)}
+	results, err := bitmapAddScript.Run(ctx, b.rdb, keys, b.hashArgs(items)...).Slice()
+	if err != nil {
+		return nil, err
+	}
+	return int64sToBools(results), nil
+}
+
+func (b *bitmapBloomBackend) exists(ctx context.Context, key, item string) (bool, error) {
+	results, err := b.existsMulti(ctx, key, []string{item})
+	if err != nil {
+		return false, err
+	}
+	return results[0], nil
+}
+
+func (b *bitmapBloomBackend) existsMulti(ctx context.Context, key string, items []string) ([]bool, error) {
+	keys := []string{key, bitmapParamsKey(key)}
+	results, err := bitmapExistsScript.Run(ctx, b.rdb, keys, b.hashArgs(items)...).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("检查布隆过滤器元素失败: %v", err)
+	}
+	return int64sToBools(results), nil
+}
+
+func (b *bitmapBloomBackend) remove(ctx context.Context, key, shadowKey, item string) (bool, error) {
+	return false, ErrBloomDeleteUnsupported
+}
+
+// info 返回与 BF.INFO 同名的字段，便于统一展示
+func (b *bitmapBloomBackend) info(ctx context.Context, key string) (map[string]interface{}, error) {
+	params, err := b.rdb.HGetAll(ctx, bitmapParamsKey(key)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取布隆过滤器信息失败: %v", err)
+	}
+	if len(params) == 0 {
+		return nil, errors.New("获取布隆过滤器信息失败: 过滤器不存在")
+	}
+
+	bits, _ := strconv.ParseInt(params["bits"], 10, 64)
+	hashes, _ := strconv.ParseInt(params["hashes"], 10, 64)
+	capacity, _ := strconv.ParseInt(params["capacity"], 10, 64)
+	items, _ := strconv.ParseInt(params["items"], 10, 64)
+	return map[string]interface{}{
+		"Capacity":                 capacity,
+		"Size":                     bits / 8,
+		"Number of bits":           bits,
+		"Number of hash functions": hashes,
+		"Number of items inserted": items,
+		"Error rate":               params["errorRate"],
+	}, nil
+}
+
+func (b *bitmapBloomBackend) keyExists(ctx context.Context, key string) (bool, error) {
+	n, err := b.rdb.Exists(ctx, bitmapParamsKey(key)).Result()
+	return n == 1, err
+}
+
+func (b *bitmapBloomBackend) del(ctx context.Context, key string) error {
+	if err := b.rdb.Del(ctx, key, bitmapParamsKey(key)).Err(); err != nil {
+		return fmt.Errorf("删除布隆过滤器失败: %v", err)
+	}
+	return nil
+}
+
+// rename 位图与参数在同一个事务中替换
+func (b *bitmapBloomBackend) rename(ctx context.Context, from, to string) error {
+	_, err := b.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Rename(ctx, from, to)
+		pipe.Rename(ctx, bitmapParamsKey(from), bitmapParamsKey(to))
+		return nil
+	})
+	return err
+}
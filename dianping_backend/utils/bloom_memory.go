@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// memoryBloomFilters 进程内过滤器存储，所有 memory 后端的过滤器实例共享
+var memoryBloomFilters = struct {
+	sync.Mutex
+	filters map[string]*memoryBloom
+}{filters: map[string]*memoryBloom{}}
+
+// memoryBloom 进程内位图布隆过滤器，位置计算与 bitmap 后端相同
+type memoryBloom struct {
+	bits      []uint64
+	m         uint64
+	k         int
+	capacity  uint
+	errorRate float64
+	items     int64
+}
+
+func newMemoryBloom(capacity uint, errorRate float64) *memoryBloom {
+	m, k := bloomParams(capacity, errorRate)
+	return &memoryBloom{
+		bits:      make([]uint64, (m+63)/64),
+		m:         m,
+		k:         k,
+		capacity:  capacity,
+		errorRate: errorRate,
+	}
+}
+
+// add 设置元素对应的 k 个位，返回是否为新元素
+func (f *memoryBloom) add(item string) bool {
+	added := false
+	for _, off := range bloomOffsets(item, f.m, f.k) {
+		word, mask := off/64, uint64(1)<<(off%64)
+		if f.bits[word]&mask == 0 {
+			f.bits[word] |= mask
+			added = true
+		}
+	}
+	if added {
+		f.items++
+	}
+	return added
+}
+
+// test 检查元素对应的 k 个位是否全部为 1
+func (f *memoryBloom) test(item string) bool {
+	for _, off := range bloomOffsets(item, f.m, f.k) {
+		if f.bits[off/64]&(uint64(1)<<(off%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// memoryBloomBackend 进程内布隆过滤器，不依赖 Redis，仅用于单机开发和测试；
+// 数据不在实例间共享，重启后需要重新加载
+type memoryBloomBackend struct {
+	config BloomFilterConfig
+}
+
+var errMemoryBloomNotFound = errors.New("过滤器不存在")
+
+func (b *memoryBloomBackend) reserve(ctx context.Context, key string) error {
+	memoryBloomFilters.Lock()
+	defer memoryBloomFilters.Unlock()
+
+	if _, ok := memoryBloomFilters.filters[key]; !ok {
+		memoryBloomFilters.filters[key] = newMemoryBloom(b.config.Capacity, b.config.ErrorRate)
+	}
+	return nil
+}
+
+func (b *memoryBloomBackend) add(ctx context.Context, key, shadowKey, item string) (bool, error) {
+	results, err := b.addMulti(ctx, key, shadowKey, []string{item})
+	if err != nil {
+		return false, err
+	}
+	return results[0], nil
+}
+
+func (b *memoryBloomBackend) addMulti(ctx context.Context, key, shadowKey string, items []string) ([]bool, error) {
+	memoryBloomFilters.Lock()
+	defer memoryBloomFilters.Unlock()
+
+	f, ok := memoryBloomFilters.filters[key]
+	if !ok {
+		return nil, errMemoryBloomNotFound
+	}
+	shadow := memoryBloomFilters.filters[shadowKey]
+	results := make([]bool, len(items))
+	for i, item := range items {
+		results[i] = f.add(item)
+		if shadow != nil {
+			shadow.add(item)
+		}
+	}
+	return results, nil
+}
+
+func (b *memoryBloomBackend) exists(ctx context.Context, key, item string) (bool, error) {
+	results, err := b.existsMulti(ctx, key, []string{item})
+	if err != nil {
+		return false, err
+	}
+	return results[0], nil
+}
+
+func (b *memoryBloomBackend) existsMulti(ctx context.Context, key string, items []string) ([]bool, error) {
+	memoryBloomFilters.Lock()
+	defer memoryBloomFilters.Unlock()
+
+	f, ok := memoryBloomFilters.filters[key]
+	if !ok {
+		return nil, errMemoryBloomNotFound
+	}
+	results := make([]bool, len(items))
+	for i, item := range items {
+		results[i] = f.test(item)
+	}
+	return results, nil
+}
+
+func (b *memoryBloomBackend) remove(ctx context.Context, key, shadowKey, item string) (bool, error) {
+	return false, ErrBloomDeleteUnsupported
+}
+
+func (b *memoryBloomBackend) info(ctx context.Context, key string) (map[string]interface{}, error) {
+	memoryBloomFilters.Lock()
+	defer memoryBloomFilters.Unlock()
+
+	f, ok := memoryBloomFilters.filters[key]
+	if !ok {
+		return nil, errMemoryBloomNotFound
+	}
+	return map[string]interface{}{
+		"Capacity":                 int64(f.capacity),
+		"Size":                     int64(len(f.bits) * 8),
+		"Number of bits":           int64(f.m),
+		"Number of hash functions": int64(f.k),
+		"Number of items inserted": f.items,
+		"Error rate":               f.errorRate,
+	}, nil
+}
+
+func (b *memoryBloomBackend) keyExists(ctx context.Context, key string) (bool, error) {
+	memoryBloomFilters.Lock()
+	defer memoryBloomFilters.Unlock()
+
+	_, ok := memoryBloomFilters.filters[key]
+	return ok, nil
+}
+
+func (b *memoryBloomBackend) del(ctx context.Context, key string) error {
+	memoryBloomFilters.Lock()
+	defer memoryBloomFilters.Unlock()
+
+	delete(memoryBloomFilters.filters, key)
+	return nil
+}
+
+func (b *memoryBloomBackend) rename(ctx context.Context, from, to string) error {
+	memoryBloomFilters.Lock()
+	defer memoryBloomFilters.Unlock()
+
+	f, ok := memoryBloomFilters.filters[from]
+	if !ok {
+		return errMemoryBloomNotFound
+	}
+	memoryBloomFilters.filters[to] = f
+	delete(memoryBloomFilters.filters, from)
+	return nil
+}
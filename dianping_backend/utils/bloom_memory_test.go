@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// newTestMemoryBloom 切换到 memory 后端并创建过滤器，测试结束后恢复后端并清理本测试用到的 key
+func newTestMemoryBloom(t *testing.T, capacity uint) *BloomFilter {
+	t.Helper()
+	backend := CurrentBloomBackend()
+	SetBloomBackend(BloomBackendMemory)
+	t.Cleanup(func() { SetBloomBackend(backend) })
+
+	bf := NewBloomFilter(nil, BloomFilterConfig{Key: "bloom:test:" + t.Name(), Capacity: capacity})
+	t.Cleanup(func() {
+		memoryBloomFilters.Lock()
+		defer memoryBloomFilters.Unlock()
+		delete(memoryBloomFilters.filters, bf.config.Key)
+		delete(memoryBloomFilters.filters, bf.rebuildKey())
+	})
+	if err := bf.Reserve(context.Background()); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	return bf
+}
+
+func TestBloomParams(t *testing.T) {
+	tests := []struct {
+		capacity  uint
+		errorRate float64
+		bits      uint64
+		hashes    int
+	}{
+		{1000000, 0.01, 9585059, 7},
+		{10000, 0.01, 95851, 7},
+		{10000, 0.001, 143776, 10},
+		{1, 0.01, 64, 44},                  // 位数下限 64
+		{1 << 40, 0.01, math.MaxUint32, 1}, // 位数上限 2^32-1，k 至少为 1
+	}
+	for _, tt := range tests {
+		bits, hashes := bloomParams(tt.capacity, tt.errorRate)
+		if bits != tt.bits || hashes != tt.hashes {
+			t.Errorf("bloomParams(%d, %v) = (%d, %d), want (%d, %d)",
+				tt.capacity, tt.errorRate, bits, hashes, tt.bits, tt.hashes)
+		}
+	}
+}
+
+// TestBloomOffsetsMatchBitmapScript memory 后端与 bitmap 后端必须落在相同的位上：
+// bitmap 脚本收到 hashArgs 的 h1、h2 后用 Lua 的 double 运算 (h1 + i*h2) % m
+func TestBloomOffsetsMatchBitmapScript(t *testing.T) {
+	bits, hashes := bloomParams(1000000, 0.01)
+	b := &bitmapBloomBackend{}
+	for i := 0; i < 1000; i++ {
+		item := fmt.Sprint(i)
+		args := b.hashArgs([]string{item})
+		h1, h2 := args[0].(uint64), args[1].(uint64)
+		if h1 > math.MaxUint32 || h2 > math.MaxUint32 || h2%2 == 0 {
+			t.Fatalf("bloomHashes(%q) = (%d, %d), want two 32-bit values with odd h2", item, h1, h2)
+		}
+
+		offsets := bloomOffsets(item, bits, hashes)
+		for j, off := range offsets {
+			lua := math.Mod(float64(h1)+float64(j)*float64(h2), float64(bits))
+			if float64(off) != lua {
+				t.Fatalf("offset %d of %q = %d, bitmap script computes %v", j, item, off, lua)
+			}
+		}
+
+		f := newMemoryBloom(1000000, 0.01)
+		f.add(item)
+		for _, off := range offsets {
+			if f.bits[off/64]&(uint64(1)<<(off%64)) == 0 {
+				t.Fatalf("memory filter did not set bit %d for %q", off, item)
+			}
+		}
+	}
+}
+
+func TestMemoryBloomAddExists(t *testing.T) {
+	ctx := context.Background()
+	bf := newTestMemoryBloom(t, 10000)
+
+	added, err := bf.AddID(ctx, 1)
+	if err != nil || !added {
+		t.Fatalf("AddID(1) = %v, %v; want true", added, err)
+	}
+	if added, _ := bf.AddID(ctx, 1); added {
+		t.Fatal("AddID(1) reported a new item twice")
+	}
+	if _, err := bf.AddIDs(ctx, []uint{2, 3}); err != nil {
+		t.Fatalf("AddIDs: %v", err)
+	}
+
+	found, err := bf.ExistsIDs(ctx, []uint{1, 2, 3, 4})
+	if err != nil {
+		t.Fatalf("ExistsIDs: %v", err)
+	}
+	if want := []bool{true, true, true, false}; fmt.Sprint(found) != fmt.Sprint(want) {
+		t.Fatalf("ExistsIDs = %v, want %v", found, want)
+	}
+
+	info, err := bf.Info(ctx)
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if n := info["Number of items inserted"]; n != int64(3) {
+		t.Fatalf("items inserted = %v, want 3", n)
+	}
+
+	if _, err := bf.RemoveID(ctx, 1); !errors.Is(err, ErrBloomDeleteUnsupported) {
+		t.Fatalf("RemoveID error = %v, want ErrBloomDeleteUnsupported", err)
+	}
+}
+
+func TestMemoryBloomNotFound(t *testing.T) {
+	ctx := context.Background()
+	b := &memoryBloomBackend{config: BloomFilterConfig{Capacity: 100, ErrorRate: 0.01}}
+	key := "bloom:test:" + t.Name()
+
+	if _, err := b.add(ctx, key, "", "1"); !errors.Is(err, errMemoryBloomNotFound) {
+		t.Fatalf("add error = %v, want errMemoryBloomNotFound", err)
+	}
+	if _, err := b.exists(ctx, key, "1"); !errors.Is(err, errMemoryBloomNotFound) {
+		t.Fatalf("exists error = %v, want errMemoryBloomNotFound", err)
+	}
+	if _, err := b.info(ctx, key); !errors.Is(err, errMemoryBloomNotFound) {
+		t.Fatalf("info error = %v, want errMemoryBloomNotFound", err)
+	}
+	if err := b.rename(ctx, key, key+":to"); !errors.Is(err, errMemoryBloomNotFound) {
+		t.Fatalf("rename error = %v, want errMemoryBloomNotFound", err)
+	}
+	if ok, _ := b.keyExists(ctx, key); ok {
+		t.Fatal("keyExists reported a filter that was never reserved")
+	}
+}
+
+func TestMemoryBloomAddWritesShadow(t *testing.T) {
+	ctx := context.Background()
+	bf := newTestMemoryBloom(t, 10000)
+	b := bf.backend.(*memoryBloomBackend)
+	if err := b.reserve(ctx, bf.rebuildKey()); err != nil {
+		t.Fatalf("reserve shadow: %v", err)
+	}
+
+	if _, err := bf.AddID(ctx, 42); err != nil {
+		t.Fatalf("AddID: %v", err)
+	}
+	if ok, _ := b.exists(ctx, bf.rebuildKey(), "42"); !ok {
+		t.Fatal("item added during rebuild is missing from the shadow filter")
+	}
+}
+
+func TestMemoryBloomRebuild(t *testing.T) {
+	ctx := context.Background()
+	bf := newTestMemoryBloom(t, 10000)
+	if _, err := bf.AddIDs(ctx, []uint{1, 2, 3}); err != nil {
+		t.Fatalf("AddIDs: %v", err)
+	}
+
+	result, err := bf.Rebuild(ctx, func(ctx context.Context) ([]uint, error) {
+		// 加载期间的新增应同时写入临时过滤器
+		if _, err := bf.AddID(ctx, 5); err != nil {
+			return nil, err
+		}
+		return []uint{2, 3, 4}, nil
+	})
+	if err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+	if result.Items != 3 {
+		t.Fatalf("rebuilt %d items, want 3", result.Items)
+	}
+
+	found, err := bf.ExistsIDs(ctx, []uint{1, 2, 3, 4, 5})
+	if err != nil {
+		t.Fatalf("ExistsIDs: %v", err)
+	}
+	if want := []bool{false, true, true, true, true}; fmt.Sprint(found) != fmt.Sprint(want) {
+		t.Fatalf("ExistsIDs after rebuild = %v, want %v", found, want)
+	}
+	if ok, _ := bf.backend.keyExists(ctx, bf.rebuildKey()); ok {
+		t.Fatal("rebuild key still exists after the swap")
+	}
+
+	if err := bf.Delete(ctx); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if ok, _ := bf.backend.keyExists(ctx, bf.config.Key); ok {
+		t.Fatal("filter still exists after Delete")
+	}
+}
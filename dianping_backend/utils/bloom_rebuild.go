@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 过滤器类型
+const (
+	BloomTypeBloom  = "bloom"  // 布隆过滤器（BF.*），不支持删除，已删除的元素在下次重建时清理
+	BloomTypeCuckoo = "cuckoo" // 布谷鸟过滤器（CF.*），支持删除元素
+)
+
+var (
+	// ErrBloomDeleteUnsupported 布隆过滤器不支持删除元素
+	ErrBloomDeleteUnsupported = errors.New("布隆过滤器不支持删除元素，等待重建后清理")
+	// ErrBloomRebuilding 其他实例正在重建同一个过滤器
+	ErrBloomRebuilding = errors.New("过滤器正在重建中")
+)
+
+const (
+	bloomRebuildBatch   = 1000             // 重建时每批写入的元素数量
+	bloomRebuildLockTTL = 10 * time.Minute // 重建锁的过期时间
+)
+
+// BloomRebuildResult 过滤器重建结果
+type BloomRebuildResult struct {
+	Key      string `json:"key"`
+	Type     string `json:"type"`
+	Items    int    `json:"items"`
+	Capacity uint   `json:"capacity"`
+	Duration string `json:"duration"`
+}
+
+// SetDeletableBloomType 设置商铺、优惠券过滤器的类型（bloom 或 cuckoo），需要在初始化过滤器之前调用；
+// 用户不会被删除，始终使用布隆过滤器
+func SetDeletableBloomType(filterType string) {
+	if filterType != BloomTypeCuckoo {
+		filterType = BloomTypeBloom
+	}
+	ShopBloomConfig.Type = filterType
+	VoucherBloomConfig.Type = filterType
+}
+
+// BloomConfigByName 按名称（shop、user、voucher）获取过滤器配置
+func BloomConfigByName(name string) (BloomFilterConfig, error) {
+	switch name {
+	case "shop":
+		return ShopBloomConfig, nil
+	case "user":
+		return UserBloomConfig, nil
+	case "voucher":
+		return VoucherBloomConfig, nil
+	}
+	return BloomFilterConfig{}, fmt.Errorf("不支持的过滤器类型: %s", name)
+}
+
+// rebuildKey 重建时使用的临时 key
+func (bf *BloomFilter) rebuildKey() string {
+	return bf.config.Key + ":rebuild"
+}
+
+// metaKey 记录上次重建信息和待清理元素数量的 hash
+func (bf *BloomFilter) metaKey() string {
+	return bf.config.Key + ":meta"
+}
+
+// Remove 从过滤器中删除元素。只有布谷鸟过滤器支持删除；
+// 布隆过滤器只记录一次待清理元素并返回 ErrBloomDeleteUnsupported，元素在下次重建时被清理
+func (bf *BloomFilter) Remove(ctx context.Context, item string) (bool, error) {
+	removed, err := bf.backend.remove(ctx, bf.config.Key, bf.rebuildKey(), item)
+	if errors.Is(err, ErrBloomDeleteUnsupported) && bf.rdb != nil {
+		if err := bf.rdb.HIncrBy(ctx, bf.metaKey(), "stale", 1).Err(); err != nil {
+			return false, fmt.Errorf("记录待清理元素失败: %v", err)
+		}
+	}
+	return removed, err
+}
+
+// RemoveID 从过滤器中删除数字ID
+func (bf *BloomFilter) RemoveID(ctx context.Context, id uint) (bool, error) {
+	return bf.Remove(ctx, strconv.FormatUint(uint64(id), 10))
+}
+
+// Rebuild 重建过滤器：在临时 key 上按当前数据量创建新过滤器，分批写入 loadIDs 返回的全部ID，
+// 再用 RENAME 原子替换线上 key。重建期间线上过滤器照常读写，新的写入会同时进入临时过滤器。
+// 同一过滤器同一时间只允许一个实例重建，拿不到锁时返回 ErrBloomRebuilding（memory 后端不加锁）
+// EN: Rebuild into a fresh key sized for the current data set and atomically swap it in
+func (bf *BloomFilter) Rebuild(ctx context.Context, loadIDs func(context.Context) ([]uint, error)) (*BloomRebuildResult, error) {
+	start := time.Now()
+	if bf.rdb != nil {
+		lockKey := "lock:" + bf.rebuildKey()
+		ok, lockValue := TryLockWithTTL(ctx, bf.rdb, lockKey, bloomRebuildLockTTL)
+		if !ok {
+			return nil, ErrBloomRebuilding
+		}
+		defer UnLockSafe(context.Background(), bf.rdb, lockKey, lockValue)
+	}
+
+	// 临时过滤器必须在加载数据之前创建，之后的新增才会被同时写入
+	config := bf.config
+	config.Key = bf.rebuildKey()
+	config.Capacity = bf.rebuildCapacity(ctx)
+	next := NewBloomFilter(bf.rdb, config)
+	if err := next.Delete(ctx); err != nil {
+		return nil, err
+	}
+	if err := next.Reserve(ctx); err != nil {
+		return nil, err
+	}
+
+	ids, err := loadIDs(ctx)
+	if err != nil {
+		next.Delete(context.Background())
+		return nil, fmt.Errorf("获取ID列表失败: %v", err)
+	}
+	for i := 0; i < len(ids); i += bloomRebuildBatch {
+		end := i + bloomRebuildBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if _, err := next.AddIDs(ctx, ids[i:end]); err != nil {
+			next.Delete(context.Background())
+			return nil, err
+		}
+	}
+
+	if err := bf.backend.rename(ctx, next.config.Key, bf.config.Key); err != nil {
+		next.Delete(context.Background())
+		return nil, fmt.Errorf("切换过滤器失败: %v", err)
+	}
+
+	duration := time.Since(start)
+	if bf.rdb != nil {
+		if err := bf.rdb.HSet(ctx, bf.metaKey(), map[string]interface{}{
+			"type":          bf.config.Type,
+			"backend":       CurrentBloomBackend(),
+			"lastRebuildAt": start.Unix(),
+			"items":         len(ids),
+			"capacity":      config.Capacity,
+			"durationMs":    duration.Milliseconds(),
+			"stale":         0,
+		}).Err(); err != nil {
+			return nil, fmt.Errorf("记录重建信息失败: %v", err)
+		}
+	}
+
+	return &BloomRebuildResult{
+		Key:      bf.config.Key,
+		Type:     bf.config.Type,
+		Items:    len(ids),
+		Capacity: config.Capacity,
+		Duration: duration.String(),
+	}, nil
+}
+
+// rebuildCapacity 新过滤器的容量：配置容量与线上元素数量两倍中的较大值，避免重建后很快又超出容量
+func (bf *BloomFilter) rebuildCapacity(ctx context.Context) uint {
+	capacity := bf.config.Capacity
+	info, err := bf.Info(ctx)
+	if err != nil {
+		return capacity
+	}
+	if n, ok := info["Number of items inserted"].(int64); ok && uint(2*n) > capacity {
+		capacity = uint(2 * n)
+	}
+	return capacity
+}
+
+// LastRebuildAt 上次重建完成的时间，从未重建过时返回零值
+func (bf *BloomFilter) LastRebuildAt(ctx context.Context) (time.Time, error) {
+	if bf.rdb == nil {
+		return time.Time{}, nil
+	}
+	ts, err := bf.rdb.HGet(ctx, bf.metaKey(), "lastRebuildAt").Int64()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts, 0), nil
+}
+
+// Stats 过滤器统计：存储后端、INFO、上次重建信息、重建后删除的待清理元素数量，以及是否正在重建
+func (bf *BloomFilter) Stats(ctx context.Context) (map[string]interface{}, error) {
+	info, err := bf.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	meta := map[string]string{}
+	if bf.rdb != nil {
+		if meta, err = bf.rdb.HGetAll(ctx, bf.metaKey()).Result(); err != nil {
+			return nil, fmt.Errorf("获取过滤器重建信息失败: %v", err)
+		}
+	}
+	rebuilding, err := bf.backend.keyExists(ctx, bf.rebuildKey())
+	if err != nil {
+		return nil, fmt.Errorf("获取过滤器重建状态失败: %v", err)
+	}
+	return map[string]interface{}{
+		"type":       bf.config.Type,
+		"backend":    CurrentBloomBackend(),
+		"info":       info,
+		"rebuild":    meta,
+		"rebuilding": rebuilding,
+	}, nil
+}
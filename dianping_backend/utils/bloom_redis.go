@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// bloomWriteScript 写入线上过滤器，重建期间（临时 key 存在）同时写入临时过滤器，
+// 保证重建过程中新增、删除的元素在切换后不会丢失
+// KEYS[1] 线上 key，KEYS[2] 重建用的临时 key；ARGV[1] 命令，其余为命令参数（单次不超过几千个）
+var bloomWriteScript = redis.NewScript(`
+local r = redis.call(ARGV[1], KEYS[1], unpack(ARGV, 2))
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	redis.pcall(ARGV[1], KEYS[2], unpack(ARGV, 2))
+end
+return r
+`)
+
+// redisBloomBackend 基于 RedisBloom 模块（BF.*、CF.*）的过滤器，需要 redis-stack
+type redisBloomBackend struct {
+	rdb    *redis.Client
+	config BloomFilterConfig
+}
+
+func (b *redisBloomBackend) isCuckoo() bool {
+	return b.config.Type == BloomTypeCuckoo
+}
+
+// cmd 按过滤器类型返回命令，name 为不带前缀的命令名（EXISTS、MEXISTS、INFO 等）
+func (b *redisBloomBackend) cmd(name string) string {
+	if b.isCuckoo() {
+		return "CF." + name
+	}
+	return "BF." + name
+}
+
+func (b *redisBloomBackend) reserve(ctx context.Context, key string) error {
+	args := []interface{}{"BF.RESERVE", key, b.config.ErrorRate, b.config.Capacity}
+
+	// 添加可选参数
+	if b.config.Expansion != 2 {
+		args = append(args, "EXPANSION", b.config.Expansion)
+	}
+	if b.config.NonScaling {
+		args = append(args, "NONSCALING")
+	}
+	// 布谷鸟过滤器没有误判率参数，扩容倍数默认为1
+	if b.isCuckoo() {
+		args = []interface{}{"CF.RESERVE", key, b.config.Capacity}
+		if !b.config.NonScaling {
+			args = append(args, "EXPANSION", b.config.Expansion)
+		}
+	}
+
+	err := b.rdb.Do(ctx, args...).Err()
+	if err != nil {
+		// 如果过滤器已存在，忽略错误
+		if err.Error() == "ERR item exists" {
+			return nil
+		}
+		return fmt.Errorf("创建布隆过滤器失败: %v", err)
+	}
+	return nil
+}
+
+func (b *redisBloomBackend) add(ctx context.Context, key, shadowKey, item string) (bool, error) {
+	cmd := "BF.ADD"
+	if b.isCuckoo() {
+		cmd = "CF.ADDNX"
+	}
+	result, err := bloomWriteScript.Run(ctx, b.rdb, []string{key, shadowKey}, cmd, item).Int()
+	if err != nil {
+		return false, fmt.Errorf("添加元素到布隆过滤器失败: %v", err)
+	}
+	return result == 1, nil
+}
+
+func (b *redisBloomBackend) addMulti(ctx context.Context, key, shadowKey string, items []string) ([]bool, error) {
+	args := []interface{}{"BF.MADD"}
+	if b.isCuckoo() {
+		args = []interface{}{"CF.INSERTNX", "ITEMS"}
+	}
+	for _, item := range items {
+		args = append(args, item)
+	}
+
+	results, err := bloomWriteScript.Run(ctx, b.rdb, []string{key, shadowKey}, args...).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("批量添加元素到布隆过滤器失败: %v", err)
+	}
+	return int64sToBools(results), nil
+}
+
+func (b *redisBloomBackend) exists(ctx context.Context, key, item string) (bool, error) {
+	result, err := b.rdb.Do(ctx, b.cmd("EXISTS"), key, item).Int()
+	if err != nil {
+		return false, fmt.Errorf("检查布隆过滤器元素失败: %v", err)
+	}
+	return result == 1, nil
+}
+
+func (b *redisBloomBackend) existsMulti(ctx context.Context, key string, items []string) ([]bool, error) {
+	args := []interface{}{b.cmd("MEXISTS"), key}
+	for _, item := range items {
+		args = append(args, item)
+	}
+
+	results, err := b.rdb.Do(ctx, args...).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("批量检查布隆过滤器元素失败: %v", err)
+	}
+	return int64sToBools(results), nil
+}
+
+func (b *redisBloomBackend) remove(ctx context.Context, key, shadowKey, item string) (bool, error) {
+	if !b.isCuckoo() {
+		return false, ErrBloomDeleteUnsupported
+	}
+	result, err := bloomWriteScript.Run(ctx, b.rdb, []string{key, shadowKey}, "CF.DEL", item).Int()
+	if err != nil {
+		return false, fmt.Errorf("从过滤器删除元素失败: %v", err)
+	}
+	return result == 1, nil
+}
+
+func (b *redisBloomBackend) info(ctx context.Context, key string) (map[string]interface{}, error) {
+	results, err := b.rdb.Do(ctx, b.cmd("INFO"), key).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("获取布隆过滤器信息失败: %v", err)
+	}
+
+	info := make(map[string]interface{})
+	for i := 0; i+1 < len(results); i += 2 {
+		info[fmt.Sprintf("%v", results[i])] = results[i+1]
+	}
+	return info, nil
+}
+
+func (b *redisBloomBackend) keyExists(ctx context.Context, key string) (bool, error) {
+	n, err := b.rdb.Exists(ctx, key).Result()
+	return n == 1, err
+}
+
+func (b *redisBloomBackend) del(ctx context.Context, key string) error {
+	if err := b.rdb.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("删除布隆过滤器失败: %v", err)
+	}
+	return nil
+}
+
+func (b *redisBloomBackend) rename(ctx context.Context, from, to string) error {
+	return b.rdb.Rename(ctx, from, to).Err()
+}
+
+// int64sToBools 将 RedisBloom 批量命令返回的 0/1 数组转换为布尔数组
+func int64sToBools(results []interface{}) []bool {
+	boolResults := make([]bool, len(results))
+	for i, result := range results {
+		if val, ok := result.(int64); ok {
+			boolResults[i] = val == 1
+		}
+	}
+	return boolResults
+}
@@ -0,0 +1,552 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// ErrCacheNotFound 数据不存在（数据库无记录或命中空值缓存）
+// EN: Returned when the data does not exist (DB miss or cached null)
+var ErrCacheNotFound = errors.New("数据不存在")
+
+// errCacheBusy 互斥重建时等待超时
+var errCacheBusy = errors.New("服务繁忙")
+
+// cacheNullValue 空值缓存标记，用于防止缓存穿透
+const cacheNullValue = ""
+
+// CacheInvalidateChannel 本地缓存跨实例失效通知频道，消息内容为完整缓存 key
+const CacheInvalidateChannel = "cache:invalidate"
+
+// CacheLoader 缓存未命中时的数据加载函数，数据不存在时返回 ErrCacheNotFound 或 gorm.ErrRecordNotFound
+type CacheLoader[T any] func(ctx context.Context) (T, error)
+
+// CacheOptions 缓存客户端配置，零值字段使用默认值
+// EN: Cache client options; zero values fall back to defaults
+type CacheOptions struct {
+	TTL         time.Duration // 缓存过期时间，逻辑过期模式下为逻辑过期时间
+	Jitter      time.Duration // 过期时间的随机抖动上限，避免大量 key 同时过期
+	NullTTL     time.Duration // 空值缓存的过期时间
+	PhysicalTTL time.Duration // 逻辑过期模式下 key 的真实过期时间
+	LockTTL     time.Duration // 重建锁的过期时间
+	MaxWait     time.Duration // 互斥模式下未拿到锁时的最长等待时间
+	LocalSize   int           // 进程内 L1 缓存容量，大于0时启用
+	LocalTTL    time.Duration // L1 缓存存活时间，决定 pub/sub 通知丢失时的最长不一致时间
+}
+
+// withDefaults 填充默认配置
+func (o CacheOptions) withDefaults() CacheOptions {
+	if o.TTL <= 0 {
+		o.TTL = 30 * time.Minute
+	}
+	if o.NullTTL <= 0 {
+		o.NullTTL = 2 * time.Minute
+	}
+	if o.PhysicalTTL <= 0 {
+		o.PhysicalTTL = 24 * time.Hour
+	}
+	if o.LockTTL <= 0 {
+		o.LockTTL = 5 * time.Second
+	}
+	if o.MaxWait <= 0 {
+		o.MaxWait = 500 * time.Millisecond
+	}
+	if o.LocalTTL <= 0 {
+		o.LocalTTL = 10 * time.Second
+	}
+	return o
+}
+
+// CacheClient 泛型旁路缓存客户端，提供三种读取策略：
+//   - Get：缓存穿透保护（空值缓存）
+//   - GetWithMutex：互斥锁重建，防止缓存击穿
+//   - GetWithLogicalExpire：逻辑过期，过期后返回旧值并异步重建
+//
+// 同一进程内对同一 key 的并发加载通过 singleflight 合并。
+// 配置 LocalSize 后在 Redis（L2）前增加进程内 LRU（L1），Delete 通过 pub/sub 通知所有实例清除 L1
+// EN: Typed cache-aside client with pass-through, mutex and logical-expire strategies, plus an optional L1 LRU
+type CacheClient[T any] struct {
+	rds    *redis.Client
+	prefix string
+	opts   CacheOptions
+	sf     SingleflightGroup
+
+	local  *LRUCache[string, T]
+	cancel context.CancelFunc
+
+	l1Hits   atomic.Int64
+	l1Misses atomic.Int64
+	l2Hits   atomic.Int64
+	l2Misses atomic.Int64
+	loads    atomic.Int64
+}
+
+// CacheStats 缓存各级命中统计
+// EN: Per-level hit/miss counters
+type CacheStats struct {
+	Prefix    string `json:"prefix"`
+	L1Enabled bool   `json:"l1Enabled"`
+	L1Size    int    `json:"l1Size"`
+	L1Hits    int64  `json:"l1Hits"`
+	L1Misses  int64  `json:"l1Misses"`
+	L2Hits    int64  `json:"l2Hits"`   // Redis 命中（含空值）
+	L2Misses  int64  `json:"l2Misses"` // Redis 未命中
+	Loads     int64  `json:"loads"`    // 调用加载函数（查询数据库）的次数
+}
+
+// logicalCacheEntry 逻辑过期缓存的存储结构
+type logicalCacheEntry[T any] struct {
+	Data     T     `json:"data"`
+	ExpireAt int64 `json:"expireAt"`
+}
+
+// NewCacheClient 创建缓存客户端，prefix 为缓存 key 前缀
+func NewCacheClient[T any](rds *redis.Client, prefix string, opts CacheOptions) *CacheClient[T] {
+	c := &CacheClient[T]{
+		rds:    rds,
+		prefix: prefix,
+		opts:   opts.withDefaults(),
+	}
+	if c.opts.LocalSize > 0 {
+		c.local = NewLRUCache[string, T](c.opts.LocalSize, c.opts.LocalTTL)
+		ctx, cancel := context.WithCancel(context.Background())
+		c.cancel = cancel
+		go c.listenInvalidation(ctx)
+	}
+	return c
+}
+
+// Close 停止失效通知订阅
+func (c *CacheClient[T]) Close() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// Stats 返回缓存命中统计
+func (c *CacheClient[T]) Stats() CacheStats {
+	s := CacheStats{
+		Prefix:   c.prefix,
+		L1Hits:   c.l1Hits.Load(),
+		L1Misses: c.l1Misses.Load(),
+		L2Hits:   c.l2Hits.Load(),
+		L2Misses: c.l2Misses.Load(),
+		Loads:    c.loads.Load(),
+	}
+	if c.local != nil {
+		s.L1Enabled = true
+		s.L1Size = c.local.Len()
+	}
+	return s
+}
+
+// Key 返回完整的缓存 key
+func (c *CacheClient[T]) Key(key string) string {
+	return c.prefix + key
+}
+
+// Get 旁路缓存读取：未命中时加载并回写，数据不存在时缓存空值
+// EN: Cache-aside read with null caching against penetration
+func (c *CacheClient[T]) Get(ctx context.Context, key string, loader CacheLoader[T]) (T, error) {
+	if val, ok := c.getLocal(key); ok {
+		return val, nil
+	}
+	if val, hit, err := c.read(ctx, key); c.countL2(hit) || err != nil {
+		return c.remember(key, val, err)
+	}
+	val, err := c.load(ctx, key, func() (T, error) {
+		if val, hit, err := c.read(ctx, key); hit || err != nil {
+			return val, err
+		}
+		return c.loadAndSet(ctx, key, loader)
+	})
+	return c.remember(key, val, err)
+}
+
+// GetWithMutex 互斥锁读取：未命中时只有拿到分布式锁的实例查询数据库，其他实例等待后重读缓存
+// EN: Cache-aside read where only the lock holder rebuilds the cache
+func (c *CacheClient[T]) GetWithMutex(ctx context.Context, key string, loader CacheLoader[T]) (T, error) {
+	if val, ok := c.getLocal(key); ok {
+		return val, nil
+	}
+	if val, hit, err := c.read(ctx, key); c.countL2(hit) || err != nil {
+		return c.remember(key, val, err)
+	}
+	val, err := c.load(ctx, key, func() (T, error) {
+		return c.lockAndLoad(ctx, key, c.read, func() (T, error) {
+			// 双重检查：拿到锁后缓存可能已被其他实例回写
+			if val, hit, err := c.read(ctx, key); hit || err != nil {
+				return val, err
+			}
+			return c.loadAndSet(ctx, key, loader)
+		})
+	})
+	return c.remember(key, val, err)
+}
+
+// GetWithLogicalExpire 逻辑过期读取：缓存过期时返回旧值并异步重建，缓存不存在时互斥加载
+// EN: Read with logical expiration; stale values are served while rebuilding in background
+func (c *CacheClient[T]) GetWithLogicalExpire(ctx context.Context, key string, loader CacheLoader[T]) (T, error) {
+	if val, ok := c.getLocal(key); ok {
+		return val, nil
+	}
+	val, hit, fresh, err := c.readLogical(ctx, key)
+	c.countL2(hit)
+	if err != nil {
+		return val, err
+	}
+	if hit {
+		if !fresh {
+			// 过期的旧值不放入 L1，重建完成后其他请求即可读到新值
+			go c.rebuildLogical(key, loader)
+			return val, nil
+		}
+		return c.remember(key, val, nil)
+	}
+
+	val, err = c.load(ctx, key, func() (T, error) {
+		readAny := func(ctx context.Context, key string) (T, bool, error) {
+			val, hit, _, err := c.readLogical(ctx, key)
+			return val, hit, err
+		}
+		return c.lockAndLoad(ctx, key, readAny, func() (T, error) {
+			// 双重检查：拿到锁后缓存可能已被其他实例重建
+			if val, hit, fresh, err := c.readLogical(ctx, key); err != nil || (hit && fresh) {
+				return val, err
+			}
+			return c.loadAndSetLogical(ctx, key, loader)
+		})
+	})
+	return c.remember(key, val, err)
+}
+
+// Prewarm 预热缓存：key 不存在或剩余过期时间小于 ahead 时重新加载并写入，返回是否执行了加载
+// EN: Reload the key when it is missing or about to expire
+func (c *CacheClient[T]) Prewarm(ctx context.Context, key string, loader CacheLoader[T], ahead time.Duration) (bool, error) {
+	needed := func() bool {
+		ttl, err := c.rds.PTTL(ctx, c.Key(key)).Result()
+		// -2 表示 key 不存在，-1 表示未设置过期时间
+		return err == nil && ttl != -1 && ttl < ahead
+	}
+	return c.prewarm(ctx, key, needed, func() error {
+		_, err := c.loadAndSet(ctx, key, loader)
+		return err
+	})
+}
+
+// PrewarmLogical 预热逻辑过期缓存：缓存不存在或逻辑过期时间在 ahead 之内时提前重建，热点 key 不会出现过期后的旧值
+// EN: Rebuild a logical-expire entry ahead of its expiration
+func (c *CacheClient[T]) PrewarmLogical(ctx context.Context, key string, loader CacheLoader[T], ahead time.Duration) (bool, error) {
+	needed := func() bool {
+		str, err := c.rds.Get(ctx, c.Key(key)).Result()
+		if errors.Is(err, redis.Nil) {
+			return true
+		}
+		if err != nil || str == cacheNullValue {
+			return false
+		}
+		var entry logicalCacheEntry[T]
+		if err := json.Unmarshal([]byte(str), &entry); err != nil {
+			return true
+		}
+		return time.Until(time.Unix(entry.ExpireAt, 0)) < ahead
+	}
+	return c.prewarm(ctx, key, needed, func() error {
+		_, err := c.loadAndSetLogical(ctx, key, loader)
+		return err
+	})
+}
+
+// prewarm 在重建锁内检查并执行预热，多实例同时预热时只有一个实例加载
+func (c *CacheClient[T]) prewarm(ctx context.Context, key string, needed func() bool, load func() error) (bool, error) {
+	if !needed() {
+		return false, nil
+	}
+	lockKey := "lock:" + c.Key(key)
+	ok, lockVal := TryLockWithTTL(ctx, c.rds, lockKey, c.opts.LockTTL)
+	if !ok {
+		return false, nil
+	}
+	defer UnLockSafe(ctx, c.rds, lockKey, lockVal)
+
+	if !needed() {
+		return false, nil
+	}
+	if err := load(); err != nil && !errors.Is(err, ErrCacheNotFound) {
+		return false, err
+	}
+	return true, nil
+}
+
+// Set 写入缓存
+func (c *CacheClient[T]) Set(ctx context.Context, key string, val T) error {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Errorf("缓存序列化失败: %w", err)
+	}
+	return c.rds.Set(ctx, c.Key(key), b, c.ttl()).Err()
+}
+
+// SetWithLogicalExpire 写入带逻辑过期时间的缓存
+func (c *CacheClient[T]) SetWithLogicalExpire(ctx context.Context, key string, val T) error {
+	entry := logicalCacheEntry[T]{Data: val, ExpireAt: time.Now().Add(c.ttl()).Unix()}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("缓存序列化失败: %w", err)
+	}
+	return c.rds.Set(ctx, c.Key(key), b, c.opts.PhysicalTTL).Err()
+}
+
+// Delete 删除缓存，同时通知所有实例清除本地缓存
+func (c *CacheClient[T]) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	full := make([]string, len(keys))
+	for i, k := range keys {
+		full[i] = c.Key(k)
+		if c.local != nil {
+			c.local.Delete(k)
+		}
+	}
+	return DeleteCacheKeys(ctx, c.rds, full...)
+}
+
+// DeleteCacheKeys 按完整 key 删除 Redis 缓存，并通知所有实例清除对应的 L1 本地缓存
+// EN: Delete cache keys in Redis and broadcast the invalidation to every instance's L1
+func DeleteCacheKeys(ctx context.Context, rds *redis.Client, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := rds.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := rds.Publish(ctx, CacheInvalidateChannel, key).Err(); err != nil {
+			return fmt.Errorf("发布缓存失效通知失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// getLocal 读取 L1 缓存
+func (c *CacheClient[T]) getLocal(key string) (T, bool) {
+	if c.local == nil {
+		var zero T
+		return zero, false
+	}
+	val, ok := c.local.Get(key)
+	if ok {
+		c.l1Hits.Add(1)
+	} else {
+		c.l1Misses.Add(1)
+	}
+	return val, ok
+}
+
+// remember 读取成功时写入 L1 缓存（空值不进入 L1）
+func (c *CacheClient[T]) remember(key string, val T, err error) (T, error) {
+	if err == nil && c.local != nil {
+		c.local.Set(key, val)
+	}
+	return val, err
+}
+
+// countL2 记录 Redis 命中情况
+func (c *CacheClient[T]) countL2(hit bool) bool {
+	if hit {
+		c.l2Hits.Add(1)
+	} else {
+		c.l2Misses.Add(1)
+	}
+	return hit
+}
+
+// listenInvalidation 订阅失效通知并清除 L1 中对应的 key；
+// 每次（重新）订阅成功时清空 L1，避免断线期间丢失的通知导致长期脏读
+func (c *CacheClient[T]) listenInvalidation(ctx context.Context) {
+	sub := c.rds.Subscribe(ctx, CacheInvalidateChannel)
+	defer sub.Close()
+
+	ch := sub.ChannelWithSubscriptions(ctx, 100)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				if m.Kind == "subscribe" {
+					c.local.Purge()
+				}
+			case *redis.Message:
+				if strings.HasPrefix(m.Payload, c.prefix) {
+					c.local.Delete(strings.TrimPrefix(m.Payload, c.prefix))
+				}
+			}
+		}
+	}
+}
+
+// read 读取普通缓存，hit 为 true 表示命中（包括空值）
+func (c *CacheClient[T]) read(ctx context.Context, key string) (T, bool, error) {
+	var zero T
+	str, err := c.rds.Get(ctx, c.Key(key)).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			// Redis 故障时降级为未命中，由加载函数兜底
+			log.Printf("读取缓存失败: key=%s, err=%v", c.Key(key), err)
+		}
+		return zero, false, nil
+	}
+	if str == cacheNullValue {
+		return zero, true, ErrCacheNotFound
+	}
+	var val T
+	if err := json.Unmarshal([]byte(str), &val); err != nil {
+		// 缓存数据损坏，按未命中处理并重建
+		return zero, false, nil
+	}
+	return val, true, nil
+}
+
+// readLogical 读取逻辑过期缓存，fresh 表示未过期
+func (c *CacheClient[T]) readLogical(ctx context.Context, key string) (T, bool, bool, error) {
+	var zero T
+	str, err := c.rds.Get(ctx, c.Key(key)).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("读取缓存失败: key=%s, err=%v", c.Key(key), err)
+		}
+		return zero, false, false, nil
+	}
+	if str == cacheNullValue {
+		return zero, true, true, ErrCacheNotFound
+	}
+	var entry logicalCacheEntry[T]
+	if err := json.Unmarshal([]byte(str), &entry); err != nil || entry.ExpireAt == 0 {
+		return zero, false, false, nil
+	}
+	return entry.Data, true, time.Now().Unix() <= entry.ExpireAt, nil
+}
+
+// load 使用 singleflight 合并同一 key 的并发加载
+func (c *CacheClient[T]) load(ctx context.Context, key string, fn func() (T, error)) (T, error) {
+	v, err := c.sf.Do(c.Key(key), func() (interface{}, error) {
+		return fn()
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v.(T), nil
+}
+
+// lockAndLoad 获取重建锁后执行 fn；未拿到锁时指数退避等待其他实例回写缓存
+func (c *CacheClient[T]) lockAndLoad(ctx context.Context, key string,
+	reread func(ctx context.Context, key string) (T, bool, error), fn func() (T, error)) (T, error) {
+	lockKey := "lock:" + c.Key(key)
+	ok, lockVal := TryLockWithTTL(ctx, c.rds, lockKey, c.opts.LockTTL)
+	if !ok {
+		base := 50 * time.Millisecond
+		waited := time.Duration(0)
+		for waited < c.opts.MaxWait {
+			time.Sleep(base)
+			waited += base
+			if val, hit, err := reread(ctx, key); hit || err != nil {
+				return val, err
+			}
+			base *= 2
+			if base > 200*time.Millisecond {
+				base = 200 * time.Millisecond
+			}
+		}
+		if ok, lockVal = TryLockWithTTL(ctx, c.rds, lockKey, c.opts.LockTTL); !ok {
+			if val, hit, err := reread(ctx, key); hit || err != nil {
+				return val, err
+			}
+			var zero T
+			return zero, errCacheBusy
+		}
+	}
+	defer UnLockSafe(ctx, c.rds, lockKey, lockVal)
+	return fn()
+}
+
+// rebuildLogical 异步重建逻辑过期缓存，同一时刻只有拿到锁的实例执行
+func (c *CacheClient[T]) rebuildLogical(key string, loader CacheLoader[T]) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.LockTTL)
+	defer cancel()
+
+	lockKey := "lock:" + c.Key(key)
+	ok, lockVal := TryLockWithTTL(ctx, c.rds, lockKey, c.opts.LockTTL)
+	if !ok {
+		return
+	}
+	defer UnLockSafe(ctx, c.rds, lockKey, lockVal)
+
+	if _, _, fresh, _ := c.readLogical(ctx, key); fresh {
+		return
+	}
+	if _, err := c.loadAndSetLogical(ctx, key, loader); err != nil && !errors.Is(err, ErrCacheNotFound) {
+		log.Printf("异步重建缓存失败: key=%s, err=%v", c.Key(key), err)
+	}
+}
+
+// loadAndSet 调用加载函数并写入普通缓存
+func (c *CacheClient[T]) loadAndSet(ctx context.Context, key string, loader CacheLoader[T]) (T, error) {
+	c.loads.Add(1)
+	val, err := loader(ctx)
+	if err != nil {
+		return val, c.handleLoadError(ctx, key, err)
+	}
+	if err := c.Set(ctx, key, val); err != nil {
+		log.Printf("写入缓存失败: key=%s, err=%v", c.Key(key), err)
+	}
+	return val, nil
+}
+
+// loadAndSetLogical 调用加载函数并写入逻辑过期缓存
+func (c *CacheClient[T]) loadAndSetLogical(ctx context.Context, key string, loader CacheLoader[T]) (T, error) {
+	c.loads.Add(1)
+	val, err := loader(ctx)
+	if err != nil {
+		return val, c.handleLoadError(ctx, key, err)
+	}
+	if err := c.SetWithLogicalExpire(ctx, key, val); err != nil {
+		log.Printf("写入缓存失败: key=%s, err=%v", c.Key(key), err)
+	}
+	return val, nil
+}
+
+// handleLoadError 数据不存在时写入空值缓存，统一返回 ErrCacheNotFound
+func (c *CacheClient[T]) handleLoadError(ctx context.Context, key string, err error) error {
+	if !errors.Is(err, ErrCacheNotFound) && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err := c.rds.Set(ctx, c.Key(key), cacheNullValue, c.opts.NullTTL).Err(); err != nil {
+		log.Printf("写入空值缓存失败: key=%s, err=%v", c.Key(key), err)
+	}
+	return ErrCacheNotFound
+}
+
+// ttl 返回带随机抖动的过期时间
+func (c *CacheClient[T]) ttl() time.Duration {
+	if c.opts.Jitter <= 0 {
+		return c.opts.TTL
+	}
+	return c.opts.TTL + time.Duration(rand.Int64N(int64(c.opts.Jitter)))
+}
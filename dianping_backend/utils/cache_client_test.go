@@ -0,0 +1,279 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type testCacheItem struct {
+	Name string `json:"name"`
+	N    int    `json:"n"`
+}
+
+// waitUntil 轮询等待条件成立，超时后测试失败
+func waitUntil(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// countingLoader 返回固定结果的加载函数及其调用次数
+func countingLoader(val testCacheItem, err error) (CacheLoader[testCacheItem], *atomic.Int64) {
+	var calls atomic.Int64
+	return func(ctx context.Context) (testCacheItem, error) {
+		calls.Add(1)
+		return val, err
+	}, &calls
+}
+
+func TestCacheClientGetLoadsOnceAndHits(t *testing.T) {
+	srv, rdb := newFakeRedis(t)
+	c := NewCacheClient[testCacheItem](rdb, "cache:test:", CacheOptions{TTL: time.Minute})
+	ctx := context.Background()
+	loader, calls := countingLoader(testCacheItem{Name: "shop", N: 1}, nil)
+
+	for i := 0; i < 3; i++ {
+		got, err := c.Get(ctx, "1", loader)
+		if err != nil || got.Name != "shop" {
+			t.Fatalf("Get #%d = %+v, %v; want shop, nil", i, got, err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader called %d times, want 1", n)
+	}
+	if _, ok := srv.Get("cache:test:1"); !ok {
+		t.Fatal("loaded value was not written to redis")
+	}
+	if ttl := srv.TTL("cache:test:1"); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("cache ttl = %v, want within (0, 1m]", ttl)
+	}
+	s := c.Stats()
+	if s.L1Enabled || s.L2Hits != 2 || s.L2Misses != 1 || s.Loads != 1 {
+		t.Fatalf("Stats = %+v, want 2 L2 hits, 1 miss, 1 load, L1 disabled", s)
+	}
+}
+
+func TestCacheClientNullHit(t *testing.T) {
+	srv, rdb := newFakeRedis(t)
+	c := NewCacheClient[testCacheItem](rdb, "cache:test:", CacheOptions{NullTTL: time.Minute})
+	ctx := context.Background()
+	loader, calls := countingLoader(testCacheItem{}, gorm.ErrRecordNotFound)
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Get(ctx, "404", loader); !errors.Is(err, ErrCacheNotFound) {
+			t.Fatalf("Get #%d err = %v, want ErrCacheNotFound", i, err)
+		}
+	}
+	// 空值缓存命中后不再访问数据库
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader called %d times, want 1", n)
+	}
+	if v, ok := srv.Get("cache:test:404"); !ok || v != cacheNullValue {
+		t.Fatalf("null value = %q, %v; want empty marker", v, ok)
+	}
+	if ttl := srv.TTL("cache:test:404"); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("null ttl = %v, want within (0, 1m]", ttl)
+	}
+
+	// 其他错误原样返回，不写入空值
+	boom := errors.New("boom")
+	failing, _ := countingLoader(testCacheItem{}, boom)
+	if _, err := c.Get(ctx, "500", failing); !errors.Is(err, boom) {
+		t.Fatalf("Get err = %v, want loader error", err)
+	}
+	if _, ok := srv.Get("cache:test:500"); ok {
+		t.Fatal("loader error was cached as a null value")
+	}
+}
+
+func TestCacheClientExpiry(t *testing.T) {
+	_, rdb := newFakeRedis(t)
+	c := NewCacheClient[testCacheItem](rdb, "cache:test:", CacheOptions{TTL: time.Second})
+	ctx := context.Background()
+	loader, calls := countingLoader(testCacheItem{Name: "shop"}, nil)
+
+	if _, err := c.Get(ctx, "1", loader); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := c.Get(ctx, "1", loader); err != nil {
+		t.Fatalf("Get after expiry: %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("loader called %d times, want a reload after expiry", n)
+	}
+}
+
+func TestCacheClientJitterTTL(t *testing.T) {
+	srv, rdb := newFakeRedis(t)
+	c := NewCacheClient[testCacheItem](rdb, "cache:test:", CacheOptions{TTL: time.Minute, Jitter: 10 * time.Second})
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		if d := c.ttl(); d < time.Minute || d >= time.Minute+10*time.Second {
+			t.Fatalf("ttl = %v, want within [1m, 1m10s)", d)
+		}
+	}
+	if err := c.Set(ctx, "1", testCacheItem{Name: "shop"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if ttl := srv.TTL("cache:test:1"); ttl <= 50*time.Second || ttl > time.Minute+10*time.Second {
+		t.Fatalf("redis ttl = %v, want about 1m plus jitter", ttl)
+	}
+}
+
+func TestCacheClientGetWithMutexLoadsOnce(t *testing.T) {
+	_, rdb := newFakeRedis(t)
+	c := NewCacheClient[testCacheItem](rdb, "cache:test:", CacheOptions{})
+	ctx := context.Background()
+
+	var calls atomic.Int64
+	loader := func(ctx context.Context) (testCacheItem, error) {
+		calls.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return testCacheItem{Name: "hot"}, nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := c.GetWithMutex(ctx, "1", loader)
+			if err == nil && got.Name != "hot" {
+				err = errors.New("unexpected value " + got.Name)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("GetWithMutex: %v", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader called %d times, want 1", n)
+	}
+}
+
+func TestCacheClientGetWithMutexWaitsForLockHolder(t *testing.T) {
+	srv, rdb := newFakeRedis(t)
+	c := NewCacheClient[testCacheItem](rdb, "cache:test:", CacheOptions{MaxWait: time.Second})
+	ctx := context.Background()
+	loader, calls := countingLoader(testCacheItem{Name: "db"}, nil)
+
+	// 模拟其他实例持有重建锁，稍后回写缓存
+	srv.Set("lock:cache:test:1", "other")
+	go func() {
+		time.Sleep(80 * time.Millisecond)
+		b, _ := json.Marshal(testCacheItem{Name: "other"})
+		srv.Set("cache:test:1", string(b))
+	}()
+
+	got, err := c.GetWithMutex(ctx, "1", loader)
+	if err != nil || got.Name != "other" {
+		t.Fatalf("GetWithMutex = %+v, %v; want the value written by the lock holder", got, err)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("loader called %d times while another instance held the lock", n)
+	}
+	if v, _ := srv.Get("lock:cache:test:1"); v != "other" {
+		t.Fatalf("lock value = %q, another instance's lock must not be released", v)
+	}
+}
+
+func TestCacheClientLogicalExpireServesStale(t *testing.T) {
+	srv, rdb := newFakeRedis(t)
+	c := NewCacheClient[testCacheItem](rdb, "cache:test:", CacheOptions{TTL: time.Minute})
+	ctx := context.Background()
+	loader, calls := countingLoader(testCacheItem{Name: "new"}, nil)
+
+	b, _ := json.Marshal(logicalCacheEntry[testCacheItem]{
+		Data:     testCacheItem{Name: "old"},
+		ExpireAt: time.Now().Add(-time.Second).Unix(),
+	})
+	srv.Set("cache:test:1", string(b))
+
+	got, err := c.GetWithLogicalExpire(ctx, "1", loader)
+	if err != nil || got.Name != "old" {
+		t.Fatalf("GetWithLogicalExpire = %+v, %v; want the stale value", got, err)
+	}
+	// 后台重建完成后读到新值
+	waitUntil(t, func() bool {
+		got, err := c.GetWithLogicalExpire(ctx, "1", loader)
+		return err == nil && got.Name == "new"
+	}, "logical expire rebuild")
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader called %d times, want 1", n)
+	}
+	if ttl := srv.TTL("cache:test:1"); ttl < time.Hour {
+		t.Fatalf("physical ttl = %v, want the 24h default", ttl)
+	}
+}
+
+func TestCacheClientLogicalExpireMissLoads(t *testing.T) {
+	_, rdb := newFakeRedis(t)
+	c := NewCacheClient[testCacheItem](rdb, "cache:test:", CacheOptions{})
+	ctx := context.Background()
+	loader, calls := countingLoader(testCacheItem{}, ErrCacheNotFound)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetWithLogicalExpire(ctx, "404", loader); !errors.Is(err, ErrCacheNotFound) {
+			t.Fatalf("GetWithLogicalExpire #%d err = %v, want ErrCacheNotFound", i, err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("loader called %d times, want the null value cached", n)
+	}
+}
+
+func TestCacheClientLocalCacheInvalidation(t *testing.T) {
+	srv, rdb := newFakeRedis(t)
+	c := NewCacheClient[testCacheItem](rdb, "cache:test:", CacheOptions{LocalSize: 8, LocalTTL: time.Minute})
+	t.Cleanup(c.Close)
+	ctx := context.Background()
+	waitUntil(t, func() bool { return srv.Subscribers(CacheInvalidateChannel) >= 1 }, "invalidation subscription")
+
+	loader, _ := countingLoader(testCacheItem{Name: "v1"}, nil)
+	if _, err := c.Get(ctx, "1", loader); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	// Redis 中的值被直接修改时，L1 仍返回本地副本
+	b, _ := json.Marshal(testCacheItem{Name: "v2"})
+	srv.Set("cache:test:1", string(b))
+	got, err := c.Get(ctx, "1", loader)
+	if err != nil || got.Name != "v1" {
+		t.Fatalf("Get = %+v, %v; want the L1 copy v1", got, err)
+	}
+	if s := c.Stats(); !s.L1Enabled || s.L1Hits != 1 || s.L1Size != 1 {
+		t.Fatalf("Stats = %+v, want one L1 hit", s)
+	}
+
+	// 其他实例删除缓存后，通过 pub/sub 清除本实例的 L1
+	srv.Set("cache:test:1", string(b))
+	if err := DeleteCacheKeys(ctx, rdb, "cache:test:1"); err != nil {
+		t.Fatalf("DeleteCacheKeys: %v", err)
+	}
+	waitUntil(t, func() bool { return c.Stats().L1Size == 0 }, "L1 invalidation")
+
+	reload, _ := countingLoader(testCacheItem{Name: "v3"}, nil)
+	if got, err := c.Get(ctx, "1", reload); err != nil || got.Name != "v3" {
+		t.Fatalf("Get after invalidation = %+v, %v; want reloaded v3", got, err)
+	}
+}
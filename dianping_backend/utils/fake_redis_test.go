@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// fakeRedis 测试用的进程内 Redis：实现 RESP2 协议和缓存客户端用到的少量命令
+// （GET、SET、DEL、PTTL、PUBLISH、SUBSCRIBE，以及分布式锁的解锁脚本），不依赖外部 Redis
+type fakeRedis struct {
+	ln net.Listener
+
+	mu   sync.Mutex
+	data map[string]fakeRedisValue
+	subs map[string]map[*fakeRedisConn]bool
+}
+
+type fakeRedisValue struct {
+	val      string
+	expireAt time.Time // 零值表示不过期
+}
+
+type fakeRedisConn struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// newFakeRedis 启动 fakeRedis 并返回连接到它的客户端，测试结束时关闭
+func newFakeRedis(t *testing.T) (*fakeRedis, *redis.Client) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeRedis{
+		ln:   ln,
+		data: map[string]fakeRedisValue{},
+		subs: map[string]map[*fakeRedisConn]bool{},
+	}
+	go s.serve()
+
+	rdb := redis.NewClient(&redis.Options{Addr: ln.Addr().String()})
+	t.Cleanup(func() {
+		rdb.Close()
+		ln.Close()
+	})
+	return s, rdb
+}
+
+// Get 直接读取 key（不经过客户端）
+func (s *fakeRedis) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.lookup(key)
+	return v.val, ok
+}
+
+// TTL 直接读取 key 的剩余过期时间，不过期时返回 0
+func (s *fakeRedis) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.lookup(key)
+	if !ok || v.expireAt.IsZero() {
+		return 0
+	}
+	return time.Until(v.expireAt)
+}
+
+// Set 直接写入 key（不经过客户端，不发布通知）
+func (s *fakeRedis) Set(key, val string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = fakeRedisValue{val: val}
+}
+
+// Subscribers 频道当前的订阅连接数
+func (s *fakeRedis) Subscribers(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs[channel])
+}
+
+func (s *fakeRedis) lookup(key string) (fakeRedisValue, bool) {
+	v, ok := s.data[key]
+	if ok && !v.expireAt.IsZero() && time.Now().After(v.expireAt) {
+		delete(s.data, key)
+		return fakeRedisValue{}, false
+	}
+	return v, ok
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	c := &fakeRedisConn{w: bufio.NewWriter(conn)}
+	defer s.unsubscribeAll(c)
+
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		reply := s.exec(c, args)
+		c.mu.Lock()
+		c.w.WriteString(reply)
+		err = c.w.Flush()
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeRedis) exec(c *fakeRedisConn, args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		if s.subscribed(c) {
+			return respArray("pong", "")
+		}
+		return "+PONG\r\n"
+	case "GET":
+		if v, ok := s.lookup(args[1]); ok {
+			return respBulk(v.val)
+		}
+		return "$-1\r\n"
+	case "SET":
+		return s.set(args[1:])
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := s.lookup(key); ok {
+				delete(s.data, key)
+				n++
+			}
+		}
+		return respInt(n)
+	case "PTTL":
+		v, ok := s.lookup(args[1])
+		switch {
+		case !ok:
+			return respInt(-2)
+		case v.expireAt.IsZero():
+			return respInt(-1)
+		}
+		return respInt(int(time.Until(v.expireAt).Milliseconds()))
+	case "PUBLISH":
+		n := 0
+		for sub := range s.subs[args[1]] {
+			go sub.push(respArray("message", args[1], args[2]))
+			n++
+		}
+		return respInt(n)
+	case "SUBSCRIBE":
+		var b strings.Builder
+		for _, ch := range args[1:] {
+			if s.subs[ch] == nil {
+				s.subs[ch] = map[*fakeRedisConn]bool{}
+			}
+			s.subs[ch][c] = true
+			b.WriteString("*3\r\n" + respBulk("subscribe") + respBulk(ch) + respInt(len(s.subs[ch])))
+		}
+		return b.String()
+	case "EVAL":
+		// 只支持 UnLockSafe 的“值相同才删除”脚本
+		if !strings.Contains(args[1], `redis.call("get", KEYS[1]) == ARGV[1]`) {
+			return "-ERR fake redis does not support this script\r\n"
+		}
+		key, value := args[3], args[4]
+		if v, ok := s.lookup(key); ok && v.val == value {
+			delete(s.data, key)
+			return respInt(1)
+		}
+		return respInt(0)
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+}
+
+// set 支持 SET key value [EX seconds|PX milliseconds] [NX]
+func (s *fakeRedis) set(args []string) string {
+	key, val := args[0], args[1]
+	var ttl time.Duration
+	nx := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "EX":
+			n, _ := strconv.Atoi(args[i+1])
+			ttl = time.Duration(n) * time.Second
+			i++
+		case "PX":
+			n, _ := strconv.Atoi(args[i+1])
+			ttl = time.Duration(n) * time.Millisecond
+			i++
+		case "NX":
+			nx = true
+		}
+	}
+	if _, ok := s.lookup(key); ok && nx {
+		return "$-1\r\n"
+	}
+	v := fakeRedisValue{val: val}
+	if ttl > 0 {
+		v.expireAt = time.Now().Add(ttl)
+	}
+	s.data[key] = v
+	return "+OK\r\n"
+}
+
+func (s *fakeRedis) subscribed(c *fakeRedisConn) bool {
+	for _, conns := range s.subs {
+		if conns[c] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fakeRedis) unsubscribeAll(c *fakeRedisConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conns := range s.subs {
+		delete(conns, c)
+	}
+}
+
+func (c *fakeRedisConn) push(msg string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.w.WriteString(msg)
+	c.w.Flush()
+}
+
+// readRESPCommand 读取一条 RESP 数组格式的命令
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected command line %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func respBulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+func respInt(n int) string {
+	return ":" + strconv.Itoa(n) + "\r\n"
+}
+
+func respArray(items ...string) string {
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(items)) + "\r\n")
+	for _, item := range items {
+		b.WriteString(respBulk(item))
+	}
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxHotKeysPerBucket 单个时间桶最多记录的 key 数量，超过后新 key 不再计数，避免内存无限增长
+const maxHotKeysPerBucket = 10000
+
+// HotKey 热点 key 及其在窗口内的估算访问次数
+type HotKey struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// HotKeyDetector 基于采样计数和滑动窗口的进程内热点 key 探测器：
+// 窗口被切分为若干个时间桶，每次访问按 sampleRate 概率计数，统计时按采样率放大
+// EN: In-process hot-key detector using sampled counters over a sliding window of time buckets
+type HotKeyDetector struct {
+	mu         sync.Mutex
+	bucketSize time.Duration
+	sampleRate float64
+	buckets    []map[string]int64
+	starts     []int64 // 每个桶对应的起始时间（bucketSize 的整数倍）
+	now        func() time.Time
+}
+
+// NewHotKeyDetector 创建热点探测器，窗口长度为 window，划分为 buckets 个时间桶，sampleRate 取值 (0, 1]
+func NewHotKeyDetector(window time.Duration, buckets int, sampleRate float64) *HotKeyDetector {
+	if buckets <= 0 {
+		buckets = 6
+	}
+	if sampleRate <= 0 || sampleRate > 1 {
+		sampleRate = 1
+	}
+	bucketSize := window / time.Duration(buckets)
+	if bucketSize <= 0 {
+		bucketSize = time.Second
+	}
+	d := &HotKeyDetector{
+		bucketSize: bucketSize,
+		sampleRate: sampleRate,
+		buckets:    make([]map[string]int64, buckets),
+		starts:     make([]int64, buckets),
+		now:        time.Now,
+	}
+	for i := range d.buckets {
+		d.buckets[i] = map[string]int64{}
+	}
+	return d
+}
+
+// Record 记录一次访问
+func (d *HotKeyDetector) Record(key string) {
+	if d.sampleRate < 1 && rand.Float64() >= d.sampleRate {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	slot := d.slot(d.now())
+	bucket := d.buckets[slot]
+	if _, ok := bucket[key]; !ok && len(bucket) >= maxHotKeysPerBucket {
+		return
+	}
+	bucket[key]++
+}
+
+// TopN 返回窗口内访问次数最多的 n 个 key（次数为按采样率放大后的估算值）
+func (d *HotKeyDetector) TopN(n int) []HotKey {
+	d.mu.Lock()
+	now := d.now()
+	oldest := d.bucketStart(now) - int64(len(d.buckets)-1)*int64(d.bucketSize)
+	totals := map[string]int64{}
+	for i, bucket := range d.buckets {
+		if d.starts[i] < oldest {
+			continue
+		}
+		for k, c := range bucket {
+			totals[k] += c
+		}
+	}
+	d.mu.Unlock()
+
+	hot := make([]HotKey, 0, len(totals))
+	for k, c := range totals {
+		hot = append(hot, HotKey{Key: k, Count: int64(float64(c) / d.sampleRate)})
+	}
+	sort.Slice(hot, func(i, j int) bool {
+		if hot[i].Count != hot[j].Count {
+			return hot[i].Count > hot[j].Count
+		}
+		return hot[i].Key < hot[j].Key
+	})
+	if n > 0 && len(hot) > n {
+		hot = hot[:n]
+	}
+	return hot
+}
+
+// slot 返回当前时间所在的桶下标，桶过期时先清空（调用方需持有锁）
+func (d *HotKeyDetector) slot(now time.Time) int {
+	start := d.bucketStart(now)
+	i := int((start / int64(d.bucketSize)) % int64(len(d.buckets)))
+	if d.starts[i] != start {
+		d.starts[i] = start
+		d.buckets[i] = map[string]int64{}
+	}
+	return i
+}
+
+// bucketStart 返回时间所在桶的起始时间（纳秒）
+func (d *HotKeyDetector) bucketStart(now time.Time) int64 {
+	ns := now.UnixNano()
+	return ns - ns%int64(d.bucketSize)
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestHotKeyDetector 创建使用可控时钟的热点探测器，返回推进时钟的函数
+func newTestHotKeyDetector(window time.Duration, buckets int, sampleRate float64) (*HotKeyDetector, func(time.Duration)) {
+	d := NewHotKeyDetector(window, buckets, sampleRate)
+	now := time.Unix(1700000000, 0)
+	d.now = func() time.Time { return now }
+	return d, func(delta time.Duration) { now = now.Add(delta) }
+}
+
+func TestHotKeyTopN(t *testing.T) {
+	d, _ := newTestHotKeyDetector(time.Minute, 6, 1)
+	for key, n := range map[string]int{"a": 5, "b": 3, "c": 3, "d": 1} {
+		for i := 0; i < n; i++ {
+			d.Record(key)
+		}
+	}
+
+	got := fmt.Sprint(d.TopN(3))
+	if want := "[{a 5} {b 3} {c 3}]"; got != want {
+		t.Fatalf("TopN(3) = %s, want %s", got, want)
+	}
+	if all := d.TopN(0); len(all) != 4 {
+		t.Fatalf("TopN(0) returned %d keys, want all 4", len(all))
+	}
+}
+
+func TestHotKeySlidingWindow(t *testing.T) {
+	// 3 个 10 秒的桶
+	d, advance := newTestHotKeyDetector(30*time.Second, 3, 1)
+
+	d.Record("old")
+	advance(10 * time.Second)
+	d.Record("mid")
+	d.Record("old")
+	advance(10 * time.Second)
+	d.Record("new")
+
+	if got, want := fmt.Sprint(d.TopN(0)), "[{old 2} {mid 1} {new 1}]"; got != want {
+		t.Fatalf("TopN within window = %s, want %s", got, want)
+	}
+
+	// 第一个桶滑出窗口：只剩下后两个桶的计数
+	advance(10 * time.Second)
+	if got, want := fmt.Sprint(d.TopN(0)), "[{mid 1} {new 1} {old 1}]"; got != want {
+		t.Fatalf("TopN after first bucket expired = %s, want %s", got, want)
+	}
+
+	// 复用过期桶时先清空旧计数
+	d.Record("new")
+	if got, want := fmt.Sprint(d.TopN(0)), "[{new 2} {mid 1} {old 1}]"; got != want {
+		t.Fatalf("TopN after bucket rotation = %s, want %s", got, want)
+	}
+
+	// 整个窗口都过期
+	advance(time.Minute)
+	if hot := d.TopN(0); len(hot) != 0 {
+		t.Fatalf("TopN after window expired = %v, want empty", hot)
+	}
+}
+
+func TestHotKeySamplingScalesCounts(t *testing.T) {
+	d, _ := newTestHotKeyDetector(time.Minute, 6, 0.25)
+	const n = 20000
+	for i := 0; i < n; i++ {
+		d.Record("hot")
+	}
+
+	hot := d.TopN(1)
+	if len(hot) != 1 {
+		t.Fatalf("TopN(1) = %v, want the sampled key", hot)
+	}
+	// 采样计数按 1/sampleRate 放大，估算值应接近真实访问次数
+	if hot[0].Count < n*9/10 || hot[0].Count > n*11/10 {
+		t.Fatalf("estimated count = %d, want about %d", hot[0].Count, n)
+	}
+	if hot[0].Count%4 != 0 {
+		t.Fatalf("estimated count = %d, want a multiple of 1/sampleRate", hot[0].Count)
+	}
+}
+
+func TestHotKeyBucketLimit(t *testing.T) {
+	d, _ := newTestHotKeyDetector(time.Minute, 6, 1)
+	for i := 0; i < maxHotKeysPerBucket+10; i++ {
+		d.Record(fmt.Sprint(i))
+	}
+	// 已记录的 key 超过上限后仍然计数
+	d.Record("0")
+
+	hot := d.TopN(0)
+	if len(hot) != maxHotKeysPerBucket {
+		t.Fatalf("tracked %d keys, want %d", len(hot), maxHotKeysPerBucket)
+	}
+	if hot[0].Key != "0" || hot[0].Count != 2 {
+		t.Fatalf("top key = %+v, want {0 2}", hot[0])
+	}
+}
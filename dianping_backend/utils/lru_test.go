@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRUCacheGetSet(t *testing.T) {
+	c := NewLRUCache[string, int](4, time.Minute)
+	c.Set("a", 1)
+	c.Set("a", 2)
+
+	if v, ok := c.Get("a"); !ok || v != 2 {
+		t.Fatalf("Get(a) = %d, %v; want 2, true", v, ok)
+	}
+	if _, ok := c.Get("missing"); ok {
+		t.Fatal("Get(missing) reported a hit")
+	}
+	if n := c.Len(); n != 1 {
+		t.Fatalf("Len = %d after overwriting a key, want 1", n)
+	}
+}
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRUCache[string, int](3, time.Minute)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	// 访问 a 后，b 成为最久未使用的元素
+	c.Get("a")
+	c.Set("d", 4)
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("least recently used key b was not evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := c.Get(key); !ok {
+			t.Fatalf("key %s was evicted, want b evicted", key)
+		}
+	}
+	if n := c.Len(); n != 3 {
+		t.Fatalf("Len = %d, want capacity 3", n)
+	}
+}
+
+func TestLRUCacheExpiry(t *testing.T) {
+	c := NewLRUCache[string, int](4, 20*time.Millisecond)
+	c.Set("a", 1)
+	time.Sleep(30 * time.Millisecond)
+	c.Set("b", 2)
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("expired key a is still returned")
+	}
+	if n := c.Len(); n != 1 {
+		t.Fatalf("Len = %d, want the expired entry removed on Get", n)
+	}
+	if v, ok := c.Get("b"); !ok || v != 2 {
+		t.Fatalf("Get(b) = %d, %v; want 2, true", v, ok)
+	}
+
+	// 重新写入会刷新过期时间
+	time.Sleep(15 * time.Millisecond)
+	c.Set("b", 3)
+	time.Sleep(15 * time.Millisecond)
+	if v, ok := c.Get("b"); !ok || v != 3 {
+		t.Fatalf("Get(b) after refresh = %d, %v; want 3, true", v, ok)
+	}
+}
+
+func TestLRUCacheDeleteAndPurge(t *testing.T) {
+	c := NewLRUCache[string, int](4, time.Minute)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	c.Delete("a")
+	c.Delete("missing")
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("deleted key a is still returned")
+	}
+
+	c.Purge()
+	if n := c.Len(); n != 0 {
+		t.Fatalf("Len = %d after Purge, want 0", n)
+	}
+	c.Set("c", 3)
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Fatalf("Get(c) after Purge = %d, %v; want 3, true", v, ok)
+	}
+}
+
+func TestLRUCacheConcurrentAccess(t *testing.T) {
+	c := NewLRUCache[string, int](16, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprint((i + j) % 32)
+				c.Set(key, j)
+				c.Get(key)
+				if j%100 == 0 {
+					c.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := c.Len(); n > 16 {
+		t.Fatalf("Len = %d, want at most the capacity 16", n)
+	}
+}
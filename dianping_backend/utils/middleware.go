@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"dianping/config"
 	"dianping/dao"
 	"fmt"
 	"net/http"
@@ -92,6 +93,55 @@ func JWTMiddleware() gin.HandlerFunc {
 	}
 }
 
+// OptionalJWTMiddleware 可选登录中间件：携带有效 token 时与 JWTMiddleware 一样设置 userID，
+// 未携带、格式错误、已登出或无效时按未登录继续处理，不拦截请求
+// EN: Set userID when a valid token is present, otherwise continue anonymously
+func OptionalJWTMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorization := c.GetHeader("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			c.Next()
+			return
+		}
+
+		token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer"))
+		if blacklisted, err := dao.IsTokenStringBlacklisted(c.Request.Context(), token); err == nil && blacklisted {
+			c.Next()
+			return
+		}
+		if claims, err := ParseToken(token); err == nil {
+			c.Set("userID", claims.UserID)
+		}
+		c.Next()
+	}
+}
+
+// AdminMiddleware 管理员鉴权中间件，需放在 JWTMiddleware 之后
+// EN: Allow only user IDs listed in admin.user_ids
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			ErrorResponse(c, http.StatusUnauthorized, "请先登录")
+			c.Abort()
+			return
+		}
+
+		cfg := config.GetConfig()
+		if cfg != nil {
+			for _, id := range cfg.Admin.UserIDs {
+				if id == userID.(uint) {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		ErrorResponse(c, http.StatusForbidden, "无管理员权限")
+		c.Abort()
+	}
+}
+
 // RecoveryMiddleware 恢复中间件
 // EN: Panic recovery to unified error response
 func RecoveryMiddleware() gin.HandlerFunc {